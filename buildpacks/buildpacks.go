@@ -0,0 +1,26 @@
+// The buildpacks package contains the buildpacks built in to Sous. Each
+// buildpack registers itself with sous.RegisteredBuildpacks when this package
+// is imported.
+package buildpacks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/opentable/sous/sous"
+)
+
+// readJSON reads the JSON file at path relative to the source directory of s
+// into v. It returns false if the file does not exist.
+func readJSON(s *sous.SourceContext, path string, v interface{}) (bool, error) {
+	f, err := os.Open(filepath.Join(s.SourceDir(), path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return true, json.NewDecoder(f).Decode(v)
+}
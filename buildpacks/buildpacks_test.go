@@ -0,0 +1,166 @@
+package buildpacks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opentable/sous/sous"
+)
+
+// fixture returns a build context for the source tree in testdata/name, with
+// all of its files considered tracked.
+func fixture(t *testing.T, name string) *sous.BuildContext {
+	root := filepath.Join("testdata", name)
+	files := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sous.BuildContext{
+		Source: sous.SourceContext{RootDir: root, OffsetDir: ".", Files: files},
+	}
+}
+
+func TestDetect(t *testing.T) {
+	cases := map[string][]string{
+		"nodejs":       {"nodejs"},
+		"golang":       {"go"},
+		"vendoredonly": {},
+		"empty":        {},
+	}
+	for name, expected := range cases {
+		c := fixture(t, name)
+		bs, err := sous.RegisteredBuildpacks.Detect(&c.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := bs.SortedKeys()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: got buildpacks %v; want %v", name, actual, expected)
+		}
+	}
+}
+
+func TestNodeJSPlan(t *testing.T) {
+	p, err := sous.RegisteredBuildpacks.Plan(fixture(t, "nodejs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Compile.From != "node:4" {
+		t.Errorf("got compile base image %q; want %q", p.Compile.From, "node:4")
+	}
+	if p.App.From != "node:4-slim" {
+		t.Errorf("got app base image %q; want %q", p.App.From, "node:4-slim")
+	}
+	assertContains(t, p.Compile.String(), `COPY ["source/","/srv/app/"]`)
+	assertContains(t, p.App.String(), `COPY ["artefacts/","/srv/app/"]`)
+	assertContains(t, p.App.String(), `CMD ["npm","start"]`)
+}
+
+func TestNodeVersion(t *testing.T) {
+	cases := map[string]string{
+		"":                 "6",
+		"4.2.1":            "4",
+		"v5":               "5",
+		"6.x":              "6",
+		">=4.2.1":          "4",
+		">=4 <7":           "4",
+		">4 <7":            "4",
+		"^6.2":             "6",
+		"~5.1.0":           "5",
+		"<=5 >=4.9":        "4",
+		">6.9.9":           "6",
+		">=7.0.0 || ^4.4":  "4",
+		"<4 || >=6.1 <6.2": "0",
+		"*":                "0",
+	}
+	dir, err := ioutil.TempDir("", "sous-nodejs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := &NodeJS{DefaultVersion: "6"}
+	for engine, expected := range cases {
+		writeEngine(t, dir, engine)
+		actual, err := n.nodeVersion(&sous.SourceContext{RootDir: dir, OffsetDir: "."})
+		if err != nil {
+			t.Errorf("%q: %s", engine, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("%q: got version %q; want %q", engine, actual, expected)
+		}
+	}
+	for _, engine := range []string{"4 - 6", ">=4 <4", "latest"} {
+		writeEngine(t, dir, engine)
+		if _, err := n.nodeVersion(&sous.SourceContext{RootDir: dir, OffsetDir: "."}); err == nil {
+			t.Errorf("%q: got nil error", engine)
+		}
+	}
+}
+
+func writeEngine(t *testing.T, dir, engine string) {
+	b, err := json.Marshal(map[string]interface{}{
+		"engines": map[string]string{"node": engine},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "package.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoPlan(t *testing.T) {
+	p, err := sous.RegisteredBuildpacks.Plan(fixture(t, "golang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Compile.From != "golang:1.5" {
+		t.Errorf("got compile base image %q; want %q", p.Compile.From, "golang:1.5")
+	}
+	assertContains(t, p.Compile.String(), "go\",\"build\",\"-o\",\"/artefacts/app\"")
+	assertContains(t, p.App.String(), `COPY ["artefacts/app","/app"]`)
+	if p.ArtefactDir != sous.DefaultArtefactDir {
+		t.Errorf("got artefact dir %q; want %q", p.ArtefactDir, sous.DefaultArtefactDir)
+	}
+}
+
+func TestPlanNoBuildpack(t *testing.T) {
+	_, err := sous.RegisteredBuildpacks.Plan(fixture(t, "empty"))
+	if _, ok := err.(sous.NoBuildpackError); !ok {
+		t.Fatalf("got error %v; want a sous.NoBuildpackError", err)
+	}
+}
+
+func TestPlanAllowed(t *testing.T) {
+	_, err := sous.RegisteredBuildpacks.Allowed([]string{"nodejs"}).Plan(fixture(t, "golang"))
+	nbe, ok := err.(sous.NoBuildpackError)
+	if !ok {
+		t.Fatalf("got error %v; want a sous.NoBuildpackError", err)
+	}
+	if len(nbe.Tried) != 1 || nbe.Tried[0] != "nodejs" {
+		t.Errorf("tried %v; want [nodejs]", nbe.Tried)
+	}
+	if _, err := sous.RegisteredBuildpacks.Allowed(nil).Plan(fixture(t, "golang")); err != nil {
+		t.Errorf("with no allowed buildpacks named, got error %v", err)
+	}
+}
+
+func assertContains(t *testing.T, dockerfile, line string) {
+	if !strings.Contains(dockerfile, line) {
+		t.Errorf("expected Dockerfile to contain %q; got:\n%s", line, dockerfile)
+	}
+}
@@ -0,0 +1,110 @@
+package buildpacks
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/sous"
+	"github.com/samsalisbury/semv"
+)
+
+type (
+	// Go builds Go projects which have at least one .go file outside of
+	// vendored dependencies. The resultant binary is statically linked.
+	Go struct {
+		// DefaultVersion is the version of Go used if the project does not
+		// specify one in Godeps/Godeps.json.
+		DefaultVersion string
+		// RuntimeImage is the base image of the app image.
+		RuntimeImage string
+	}
+	godepsJSON struct {
+		GoVersion string
+	}
+)
+
+func init() {
+	sous.RegisteredBuildpacks["go"] = &Go{
+		DefaultVersion: "1.6",
+		RuntimeImage:   "alpine:3.3",
+	}
+}
+
+const (
+	goAppDir = "/go/src/app"
+	goBinary = "app"
+)
+
+// Detect returns true if there are any .go files, ignoring vendored packages
+// and test data.
+func (g *Go) Detect(s *sous.SourceContext) (bool, error) {
+	for _, f := range s.Files {
+		if filepath.Ext(f) != ".go" {
+			continue
+		}
+		if !hasPathElem(f, "vendor", "Godeps", "testdata") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BuildImage copies the source code into GOPATH, and configures the compile
+// container to build a static binary into the artefact dir.
+func (g *Go) BuildImage(c *sous.BuildContext, f *docker.File) error {
+	v, err := g.goVersion(&c.Source)
+	if err != nil {
+		return err
+	}
+	f.From = "golang:" + v
+	f.RUN("mkdir", "-p", sous.DefaultArtefactDir)
+	f.WORKDIR(goAppDir)
+	f.COPY(goAppDir+"/", sous.CompileSourceDir+"/")
+	f.CMD("env", "CGO_ENABLED=0", "go", "build", "-o",
+		sous.DefaultArtefactDir+"/"+goBinary, ".")
+	return nil
+}
+
+// BuildContainer copies the binary into RuntimeImage, and runs it.
+func (g *Go) BuildContainer(c *sous.BuildContext, f *docker.File) error {
+	f.From = g.RuntimeImage
+	f.COPY("/"+goBinary, sous.AppArtefactDir+"/"+goBinary)
+	f.CMD("/" + goBinary)
+	return nil
+}
+
+// TestCommand runs go test on all packages.
+func (g *Go) TestCommand(c *sous.BuildContext) []string {
+	return []string{"go", "test", "./..."}
+}
+
+// goVersion returns the version of Go specified in Godeps/Godeps.json, or
+// DefaultVersion if there is none.
+func (g *Go) goVersion(s *sous.SourceContext) (string, error) {
+	var gd godepsJSON
+	if _, err := readJSON(s, "Godeps/Godeps.json", &gd); err != nil {
+		return "", fmt.Errorf("reading Godeps/Godeps.json: %s", err)
+	}
+	if gd.GoVersion == "" {
+		return g.DefaultVersion, nil
+	}
+	v, err := semv.ParseAny(gd.GoVersion)
+	if err != nil {
+		return "", fmt.Errorf("Godeps/Godeps.json GoVersion: %s", err)
+	}
+	return v.Format(semv.MajorMinor), nil
+}
+
+// hasPathElem returns true if any directory in path is one of names.
+func hasPathElem(path string, names ...string) bool {
+	for _, elem := range strings.Split(filepath.Dir(path), string(filepath.Separator)) {
+		for _, n := range names {
+			if elem == n {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package buildpacks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/sous"
+	"github.com/samsalisbury/semv"
+)
+
+type (
+	// NodeJS builds NodeJS projects which have a package.json file.
+	NodeJS struct {
+		// DefaultVersion is the version of NodeJS used if package.json does
+		// not specify one in engines.node.
+		DefaultVersion string
+	}
+	packageJSON struct {
+		Engines struct {
+			Node string
+		}
+	}
+)
+
+func init() { sous.RegisteredBuildpacks["nodejs"] = &NodeJS{DefaultVersion: "6"} }
+
+const nodeAppDir = "/srv/app"
+
+// Detect returns true if there is a package.json file.
+func (n *NodeJS) Detect(s *sous.SourceContext) (bool, error) {
+	return s.HasFile("package.json"), nil
+}
+
+// BuildImage installs all dependencies, and runs the build script if there is
+// one. The compile container then removes dev dependencies, and copies the
+// project to the artefact dir.
+func (n *NodeJS) BuildImage(c *sous.BuildContext, f *docker.File) error {
+	v, err := n.nodeVersion(&c.Source)
+	if err != nil {
+		return err
+	}
+	f.From = "node:" + v
+	f.RUN("mkdir", "-p", sous.DefaultArtefactDir)
+	f.WORKDIR(nodeAppDir)
+	f.COPY(nodeAppDir+"/", sous.CompileSourceDir+"/")
+	f.RUN("npm", "install")
+	f.RUN("npm", "run", "build", "--if-present")
+	f.CMD("sh", "-c", fmt.Sprintf("npm prune --production && cp -R %s/. %s",
+		nodeAppDir, sous.DefaultArtefactDir))
+	return nil
+}
+
+// BuildContainer copies the artefacts into a slim NodeJS image, and runs them
+// with npm start.
+func (n *NodeJS) BuildContainer(c *sous.BuildContext, f *docker.File) error {
+	v, err := n.nodeVersion(&c.Source)
+	if err != nil {
+		return err
+	}
+	f.From = "node:" + v + "-slim"
+	f.WORKDIR(nodeAppDir)
+	f.COPY(nodeAppDir+"/", sous.AppArtefactDir+"/")
+	f.CMD("npm", "start")
+	return nil
+}
+
+// TestCommand runs npm test.
+func (n *NodeJS) TestCommand(c *sous.BuildContext) []string {
+	return []string{"npm", "test"}
+}
+
+// nodeVersion returns the major version of NodeJS required by package.json,
+// or DefaultVersion if none is specified. If engines.node is a range, it is
+// the least major version that satisfies it.
+func (n *NodeJS) nodeVersion(s *sous.SourceContext) (string, error) {
+	var p packageJSON
+	if _, err := readJSON(s, "package.json", &p); err != nil {
+		return "", fmt.Errorf("reading package.json: %s", err)
+	}
+	if p.Engines.Node == "" {
+		return n.DefaultVersion, nil
+	}
+	r, err := parseNodeRange(p.Engines.Node)
+	if err != nil {
+		return "", fmt.Errorf("package.json engines.node: %s", err)
+	}
+	found := false
+	var min semv.Version
+	for _, v := range r.candidates() {
+		if r.satisfiedBy(v) && (!found || v.Major < min.Major) {
+			min, found = v, true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("package.json engines.node: no version satisfies %q", p.Engines.Node)
+	}
+	return fmt.Sprint(min.Major), nil
+}
+
+// nodeRange is an npm version range: a set of alternatives separated by "||",
+// each of which is a space separated list of comparators that must all hold.
+type nodeRange [][]semv.Range
+
+// parseNodeRange parses the npm range syntax used by engines.node. Hyphen
+// ranges are not supported.
+func parseNodeRange(s string) (nodeRange, error) {
+	var r nodeRange
+	for _, alt := range strings.Split(s, "||") {
+		var set []semv.Range
+		for _, c := range strings.Fields(alt) {
+			c = strings.TrimPrefix(c, "v")
+			if c == "*" || c == "x" || c == "X" {
+				c = ">=0"
+			}
+			cr, err := semv.ParseRange(c)
+			if err != nil {
+				return nil, fmt.Errorf("unsupported version range %q", s)
+			}
+			set = append(set, cr)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("unsupported version range %q", s)
+		}
+		r = append(r, set)
+	}
+	return r, nil
+}
+
+func (r nodeRange) satisfiedBy(v semv.Version) bool {
+	for _, set := range r {
+		ok := true
+		for _, c := range set {
+			if !c.SatisfiedBy(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns the versions that bound r. Within any major version, the
+// least version satisfying r is either x.0.0, or a bound of one of r's
+// comparators, or just above one, so these are enough to find every major
+// version that satisfies r.
+func (r nodeRange) candidates() []semv.Version {
+	vs := []semv.Version{semv.NewMajorMinorPatch(0, 0, 0)}
+	for _, set := range r {
+		for _, c := range set {
+			for _, b := range []*semv.Version{c.Min, c.MinEqual, c.Max, c.MaxEqual} {
+				if b == nil {
+					continue
+				}
+				vs = append(vs, *b, b.IncrementPatch(),
+					semv.NewMajorMinorPatch(b.Major, 0, 0))
+			}
+		}
+	}
+	return vs
+}
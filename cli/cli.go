@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/opentable/sous/sous"
 	"github.com/opentable/sous/util/cmdr"
 	"github.com/samsalisbury/semv"
 )
@@ -14,16 +15,29 @@ import (
 var (
 	Successf          = cmdr.Successf
 	Success           = cmdr.Success
+	SuccessData       = cmdr.SuccessData
 	UsageErrorf       = cmdr.UsageErrorf
 	OSErrorf          = cmdr.OSErrorf
 	IOErrorf          = cmdr.IOErrorf
+	DataErrorf        = cmdr.DataErrorf
 	InternalErrorf    = cmdr.InternalErrorf
 	EnsureErrorResult = cmdr.EnsureErrorResult
 )
 
-func NewSousCLI(v semv.Version, out, errout io.Writer) (*cmdr.CLI, error) {
+// SousCLI is the Sous command line interface.
+type SousCLI struct {
+	*cmdr.CLI
+	sous *Sous
+}
+
+func NewSousCLI(v semv.Version, out, errout io.Writer) (*SousCLI, error) {
 
-	s := &Sous{Version: v}
+	// If sous was run by another sous, continue its trace.
+	m := sous.NewMessenger("sous")
+	if traceparent := os.Getenv("TRACEPARENT"); traceparent != "" {
+		m = m.Join(traceparent, "sous")
+	}
+	s := &Sous{Version: v, messenger: m, errout: errout}
 
 	stdout := cmdr.NewOutput(out)
 	stderr := cmdr.NewOutput(errout)
@@ -48,5 +62,11 @@ func NewSousCLI(v semv.Version, out, errout io.Writer) (*cmdr.CLI, error) {
 	// graph.
 	c.Hooks.PreExecute = func(c cmdr.Command) error { return g.Inject(c) }
 
-	return c, nil
+	return &SousCLI{c, s}, nil
+}
+
+// Close delivers any messages which are still queued, and closes the files
+// they are written to. Call it after Invoke, before exiting.
+func (c *SousCLI) Close() error {
+	return c.sous.messenger.Close()
 }
@@ -1,11 +1,154 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
 	"github.com/opentable/sous/util/configloader"
 )
 
-func newDefaultConfig(u *User) (*sous.Config, error) {
+const (
+	// SystemConfigFile is the system-wide sous configuration file, without
+	// its extension, which may be .json, .yaml, .yml or .toml.
+	SystemConfigFile = "/etc/sous/config"
+	// RepoConfigFile is the path of the per-repository sous configuration
+	// file relative to the repository root, without its extension.
+	RepoConfigFile = ".sous/config"
+)
+
+// configFlags are config values passed on the command line using -config,
+// keyed by config key.
+type configFlags map[string]string
+
+func (cf configFlags) String() string {
+	s := make([]string, 0, len(cf))
+	for k, v := range cf {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (cf configFlags) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("%q is not in the form key=value", s)
+	}
+	cf[kv[0]] = kv[1]
+	return nil
+}
+
+// newDefaultConfig loads the sous configuration from each layer returned by
+// configLayers, and returns the config along with the source of each value.
+func newDefaultConfig(u *User, workDir string, flags configFlags, cl configloader.ConfigLoader) (*sous.Config, configloader.Sources, error) {
+	paths := map[string]string{}
+	for key, value := range flags {
+		f, err := configField(&sous.Config{}, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths[f.Path] = value
+	}
 	var config sous.Config
-	return &config, configloader.New().Load(&config, u.ConfigDir())
+	sources, err := cl.LoadLayers(&config, configLayers(u, workDir, paths)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &config, sources, nil
+}
+
+// configLayers returns the layers sous configuration is loaded from, in order
+// of precedence, lowest first: built-in defaults, the system file, the user
+// file, the repo file, environment variables, and finally -config flags.
+func configLayers(u *User, workDir string, flags map[string]string) []configloader.Layer {
+	return []configloader.Layer{
+		configloader.Defaults(),
+		configloader.Values("default", map[string]string{
+			"BuildStateDir":      filepath.Join(u.ConfigDir(), "builds"),
+			"ContractRecordsDir": filepath.Join(u.ConfigDir(), "contracts"),
+			"EventLog":           filepath.Join(u.ConfigDir(), "events.log"),
+		}),
+		configloader.File("system file", configloader.FindFile(SystemConfigFile)),
+		configloader.File("user file", u.ConfigFile()),
+		configloader.File("repo file", repoConfigFile(workDir)),
+		configloader.Env(),
+		configloader.Values("flags", flags),
+	}
+}
+
+// repoConfigFile returns the path of RepoConfigFile in the git repository
+// containing dir, or the empty string if dir is not inside a repository.
+func repoConfigFile(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return configloader.FindFile(filepath.Join(dir, RepoConfigFile))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configLogger returns a config loader which logs to out, according to v.
+func configLogger(out ErrOut, v cmdr.Verbosity) configloader.ConfigLoader {
+	cl := configloader.New()
+	log := func(m string) { out.Println(m) }
+	switch v {
+	case cmdr.Debug:
+		cl.Debug, cl.Info, cl.Warn = log, log, log
+	case cmdr.Loud:
+		cl.Info, cl.Warn = log, log
+	case cmdr.Normal:
+		cl.Warn = log
+	}
+	return cl
+}
+
+// configField returns the field of c named by key. Keys are matched
+// case-insensitively against the names listed by sous config, the field paths,
+// and environment variable names.
+func configField(c *sous.Config, key string) (configloader.Field, cmdr.ErrorResult) {
+	fields, err := configloader.Fields(c)
+	if err != nil {
+		return configloader.Field{}, EnsureErrorResult(err)
+	}
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = configKey(f)
+		for _, name := range []string{keys[i], f.Path, f.Env} {
+			if name != "" && strings.EqualFold(name, key) {
+				return f, nil
+			}
+		}
+	}
+	return configloader.Field{}, UsageErrorf("unknown config key %q", key).WithTip(
+		"available keys: " + strings.Join(keys, ", "))
+}
+
+// configKey returns the name of a config key shown to the user.
+func configKey(f configloader.Field) string {
+	if f.Env != "" {
+		return strings.ToLower(strings.Replace(f.Env, "_", "-", -1))
+	}
+	return strings.ToLower(camelToKebab(f.Path))
+}
+
+// camelToKebab inserts a hyphen before each upper case letter following a
+// lower case one, e.g. RequiredLabels becomes Required-Labels.
+func camelToKebab(s string) string {
+	out := make([]rune, 0, len(s))
+	var prev rune
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' && prev >= 'a' && prev <= 'z' {
+			out = append(out, '-')
+		}
+		out = append(out, r)
+		prev = r
+	}
+	return string(out)
 }
@@ -1,14 +1,21 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
 	"github.com/opentable/sous/ext/git"
+	// Imported for the singularity cluster kind it registers.
+	_ "github.com/opentable/sous/ext/singularity"
+	"github.com/opentable/sous/server"
 	"github.com/opentable/sous/sous"
 	"github.com/opentable/sous/util/cmdr"
+	"github.com/opentable/sous/util/configloader"
 	"github.com/opentable/sous/util/shell"
 	"github.com/samsalisbury/psyringe"
 	"github.com/samsalisbury/semv"
@@ -33,7 +40,12 @@ type (
 	// LocalUser is the currently logged in user.
 	LocalUser struct{ *User }
 	// LocalSousConfig is the configuration for Sous.
-	LocalSousConfig struct{ *sous.Config }
+	LocalSousConfig struct {
+		*sous.Config
+		// Sources maps each config field path to the name of the layer
+		// which supplied its value, e.g. "user file".
+		Sources configloader.Sources
+	}
 	// WorkDir is the user's current working directory when they invoke Sous.
 	LocalWorkDir string
 	// WorkdirShell is a shell for working in the user's current working
@@ -62,12 +74,21 @@ func BuildGraph(s *Sous, c *cmdr.CLI) (*SousCLIGraph, error) {
 		newErrOut,
 		newLocalUser,
 		newLocalSousConfig,
+		newMessenger,
 		newLocalWorkDir,
 		newLocalWorkDirShell,
 		newScratchDirShell,
 		newLocalGitClient,
 		newLocalGitRepo,
 		newSourceContext,
+		newBuildContext,
+		newBuildState,
+		newContractRecords,
+		newEngine,
+		newServerClient,
+		newSharedConfig,
+		newAPI,
+		newStateRepo,
 	)
 }
 
@@ -83,6 +104,118 @@ func newSourceContext(g LocalGitRepo) (*sous.SourceContext, error) {
 	return g.SourceContext()
 }
 
+func newBuildContext(v *Sous, u LocalUser, s *sous.SourceContext, scratch ScratchDirShell) (*sous.BuildContext, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, initErr(err, "getting hostname")
+	}
+	return &sous.BuildContext{
+		Source: *s,
+		Scratch: sous.ScratchContext{
+			RootDir:   scratch.Dir,
+			OffsetDir: s.OffsetDir,
+		},
+		Machine: sous.Machine{
+			Host:     strings.SplitN(host, ".", 2)[0],
+			FullHost: host,
+		},
+		User:        *u.User.User,
+		SousVersion: v.Version.String(),
+	}, nil
+}
+
+func newBuildState(c LocalSousConfig) (*sous.BuildState, error) {
+	s, err := sous.NewBuildState(*c.Config)
+	return s, initErr(err, "opening build state")
+}
+
+func newContractRecords(c LocalSousConfig, sc *sous.SharedConfig) (*sous.ContractRecords, error) {
+	r, err := sous.NewContractRecords(*c.Config, sc)
+	return r, initErr(err, "opening contract records")
+}
+
+// newEngine returns an engine which appends events to EventLog, or, if it is
+// not configured, keeps them in memory, only for this invocation.
+func newEngine(c LocalSousConfig) *sous.Engine {
+	if c.EventLog == "" {
+		return &sous.Engine{Events: sous.NewMemoryEventStore()}
+	}
+	return &sous.Engine{Events: sous.NewFileEventStore(c.EventLog)}
+}
+
+// newServerClient returns a client for the configured Sous server, which caches
+// responses in the user's config directory. Its BaseURL is empty if no server
+// is configured.
+func newServerClient(c LocalSousConfig, u LocalUser, m *sous.Messenger) *server.Client {
+	client := server.NewClient(c.Server, filepath.Join(u.ConfigDir(), "cache"))
+	client.Warn = func(message string) { m.Warnf("%s", message) }
+	client.Messenger = m
+	return client
+}
+
+// newMessenger returns the messenger for this invocation, which writes
+// messages to the terminal at the verbosity the user asked for, and every
+// message to LogFile, if it is configured.
+func newMessenger(s *Sous, c *cmdr.CLI, config LocalSousConfig) (*sous.Messenger, error) {
+	if s.messenger == nil {
+		s.messenger = sous.NewMessenger("sous")
+	}
+	errout := s.errout
+	if errout == nil {
+		errout = os.Stderr
+	}
+	terminal := sous.NewTerminalSink(errout)
+	terminal.ShowFields = s.Verbosity() == cmdr.Debug
+	s.messenger.AddSink(terminal, s.Verbosity())
+	if config.LogFile != "" {
+		f, err := sous.NewJSONFileSink(config.LogFile)
+		if err != nil {
+			return nil, initErr(err, "opening log file")
+		}
+		s.messenger.AddSink(f, cmdr.Debug)
+	}
+	return s.messenger, nil
+}
+
+// newSharedConfig fetches the organisation's shared config from the Sous
+// server. If no server is configured, the shared config is empty.
+func newSharedConfig(c *server.Client) (*sous.SharedConfig, error) {
+	if c.BaseURL == "" {
+		return &sous.SharedConfig{}, nil
+	}
+	sc, err := c.SharedConfig()
+	return sc, initErr(err, "fetching shared config")
+}
+
+// newAPI returns the API of the configured Sous server, or, if no server is
+// configured, an API which reads local state.
+func newAPI(c *server.Client, config LocalSousConfig, bs *sous.BuildState) server.API {
+	if c.BaseURL != "" {
+		return c
+	}
+	return &server.Local{StateLocation: config.StateLocation, BuildState: bs}
+}
+
+// newStateRepo opens the git repository containing the state tree at
+// StateLocation, initialising one if necessary.
+func newStateRepo(c LocalSousConfig, m *sous.Messenger) (*git.StateRepo, error) {
+	what := "opening state repository"
+	if c.StateLocation == "" {
+		return nil, initErr(errors.New("StateLocation is not configured"), what)
+	}
+	sh, err := shell.DefaultInDir(c.StateLocation)
+	if err != nil {
+		return nil, initErr(err, what)
+	}
+	traceShell(sh, m)
+	client, err := git.NewClient(sh)
+	if err != nil {
+		return nil, initErr(err, what)
+	}
+	r, err := git.OpenStateRepo(client)
+	return r, initErr(err, what)
+}
+
 func newLocalWorkDir() (LocalWorkDir, error) {
 	s, err := os.Getwd()
 	return LocalWorkDir(s), initErr(err, "determining working directory")
@@ -94,28 +227,50 @@ func newLocalUser() (v LocalUser, err error) {
 	return v, initErr(err, "getting current user")
 }
 
-func newLocalSousConfig(u LocalUser) (v LocalSousConfig, err error) {
-	v.Config, err = newDefaultConfig(u.User)
+func newLocalSousConfig(u LocalUser, wd LocalWorkDir, s *Sous, e ErrOut) (v LocalSousConfig, err error) {
+	cl := configLogger(e, s.Verbosity())
+	v.Config, v.Sources, err = newDefaultConfig(u.User, string(wd), s.flags.Config, cl)
 	return v, initErr(err, "getting default config")
 }
 
-func newLocalWorkDirShell(l LocalWorkDir) (v LocalWorkDirShell, err error) {
+func newLocalWorkDirShell(l LocalWorkDir, m *sous.Messenger) (v LocalWorkDirShell, err error) {
 	v.Sh, err = shell.DefaultInDir(string(l))
+	if err == nil {
+		traceShell(v.Sh, m)
+	}
 	return v, initErr(err, "getting current working directory")
 }
 
 // TODO: This should register a cleanup task with the cli, to delete the temp
 // dir.
-func newScratchDirShell() (v ScratchDirShell, err error) {
+func newScratchDirShell(m *sous.Messenger) (v ScratchDirShell, err error) {
 	what := "getting scratch directory"
 	dir, err := ioutil.TempDir("", "sous")
 	if err != nil {
 		return v, initErr(err, what)
 	}
 	v.Sh, err = shell.DefaultInDir(dir)
+	if err == nil {
+		traceShell(v.Sh, m)
+	}
 	return v, initErr(err, what)
 }
 
+// traceShell makes sh report each command it runs to m, at info level, so
+// that they are shown at loud verbosity. Each command runs in a new span,
+// passed to it in the TRACEPARENT environment variable, so that commands
+// which understand it, like sous itself, can continue the trace. Values of
+// environment variables and build args in the command's args are redacted,
+// see shell.RedactArgs.
+func traceShell(sh *shell.Sh, m *sous.Messenger) {
+	sh.CommandFuncs = append(sh.CommandFuncs, func(c *shell.Command) {
+		args := shell.RedactArgs(c.Args)
+		span := m.Child(c.Name, sous.Fields{"command": c.Name, "args": args, "dir": c.Dir})
+		c.SetEnv("TRACEPARENT", span.Span.TraceParent())
+		span.Infof("shell> %s %s", c.Name, strings.Join(args, " "))
+	})
+}
+
 func newLocalGitClient(sh LocalWorkDirShell) (v LocalGitClient, err error) {
 	v.Client, err = git.NewClient(sh.Sh)
 	return v, initErr(err, "initialising git client")
@@ -131,12 +286,12 @@ func initErr(err error, what string) error {
 	if err == nil {
 		return nil
 	}
-	message := fmt.Sprintf("error %s:", what)
+	message := fmt.Sprintf("error %s: ", what)
 	if shellErr, ok := err.(shell.Error); ok {
-		message += fmt.Sprintf("\ncommand failed:\nshell> %s\n%s",
+		message += fmt.Sprintf("command failed:\nshell> %s\n%s",
 			shellErr.Command.String(), shellErr.Result.Combined.String())
 	} else {
 		message += err.Error()
 	}
-	return fmt.Errorf(message)
+	return errors.New(message)
 }
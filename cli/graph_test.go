@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/opentable/sous/util/cmdr"
@@ -19,3 +20,10 @@ func TestBuildGraph(t *testing.T) {
 	}
 
 }
+
+func TestInitErr(t *testing.T) {
+	err := cmdr.EnsureErrorResult(initErr(errors.New("bad value"), "getting default config"))
+	if expected := "error getting default config: bad value"; err.Error() != expected {
+		t.Errorf("got %q; want %q", err, expected)
+	}
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"flag"
+	"io"
 
+	"github.com/opentable/sous/sous"
 	"github.com/opentable/sous/util/cmdr"
 	"github.com/samsalisbury/semv"
 )
@@ -11,12 +13,19 @@ import (
 type Sous struct {
 	// Version is the version of Sous itself.
 	Version semv.Version
+	// messenger delivers messages sent during this invocation, see Close.
+	messenger *sous.Messenger
+	// errout is where messages are written to the terminal, the writer
+	// underlying the CLI's Err.
+	errout io.Writer
 	// flags holds the values of flags passed to this command
 	flags struct {
 		Help      bool
 		Verbosity struct {
 			Silent, Quiet, Loud, Debug bool
 		}
+		// Config overrides configuration values for this invocation.
+		Config configFlags
 	}
 }
 
@@ -55,6 +64,11 @@ func (s *Sous) AddFlags(fs *flag.FlagSet) {
 		"loud verbosity: output extra info, including all shell commands")
 	fs.BoolVar(&s.flags.Verbosity.Debug, "d", false,
 		"debug level verbosity: output detailed logs of internal operations")
+	if s.flags.Config == nil {
+		s.flags.Config = configFlags{}
+	}
+	fs.Var(s.flags.Config, "config",
+		"override a config value for this invocation, e.g. -config sous-server=http://... (repeatable)")
 }
 
 func (*Sous) Execute(args []string) cmdr.Result {
@@ -1,16 +1,27 @@
 package cli
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
+	"strings"
 
+	// Register the built-in buildpacks.
+	_ "github.com/opentable/sous/buildpacks"
 	"github.com/opentable/sous/sous"
 	"github.com/opentable/sous/util/cmdr"
 )
 
 type SousBuild struct {
 	Sous         *Sous
+	User         LocalUser
 	WDShell      LocalWorkDirShell
 	ScratchShell ScratchDirShell
+	BuildContext *sous.BuildContext
+	BuildState   *sous.BuildState
+	SharedConfig *sous.SharedConfig
+	Engine       *sous.Engine
+	ErrOut       ErrOut
 	flags        struct {
 		target              string
 		rebuild, rebuildAll bool
@@ -26,13 +37,27 @@ build builds the project in your current directory by default. If you pass it a
 path, it will instead build the project at that path.
 
 args: [path]
+
+Builds are split into targets: compile builds an image containing your source
+code and build-time dependencies, app builds a slim image from the artefacts
+produced by running compile, and test runs your tests inside the compile image.
+Use -target to choose which targets to build (separated by commas), their
+dependencies are built automatically. Targets whose inputs have not changed
+since they were last built are not rebuilt, unless you use -rebuild or
+-rebuild-all.
+
+If the shared config sets a DockerRegistry, the app image is named for it, as
+clusters and sous plan expect, ready to push there with docker push.
+
+The start and end of each build are appended to the event log, which is kept in
+the file named by sous config sous-event-log.
 `
 
 func (*SousBuild) Help() string { return sousBuildHelp }
 
 func (sb *SousBuild) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&sb.flags.target, "target", "app",
-		"build a specific target")
+		"build specific targets, separated by commas")
 	fs.BoolVar(&sb.flags.rebuild, "rebuild", false,
 		"force a rebuild of the top-level target")
 	fs.BoolVar(&sb.flags.rebuildAll, "rebuild-all", false,
@@ -45,14 +70,122 @@ func (sb *SousBuild) Execute(args []string) cmdr.Result {
 		if err := sb.WDShell.CD(path); err != nil {
 			return cmdr.EnsureErrorResult(err)
 		}
+		if err := sb.resetBuildContext(); err != nil {
+			return cmdr.EnsureErrorResult(err)
+		}
+	}
+	version := sb.Sous.Version.String()
+	last, err := sb.BuildState.DetectChanges(sb.BuildContext, version)
+	if err != nil {
+		return cmdr.EnsureErrorResult(err)
+	}
+	if changes := sb.BuildContext.Changes; changes.Any() {
+		sb.ErrOut.Println("changes since last build:")
+		sb.ErrOut.Indent()
+		for _, r := range changes.Reasons() {
+			sb.ErrOut.Println(r)
+		}
+		sb.ErrOut.Outdent()
+	}
+	build, err := sous.NewBuildWithShells(sb.BuildContext, sb.WDShell.Sh, sb.ScratchShell.Sh)
+	if err != nil {
+		return cmdr.EnsureErrorResult(err)
+	}
+	build.Registry = sb.SharedConfig.DockerRegistry
+	buildpacks := sous.RegisteredBuildpacks.Allowed(sb.SharedConfig.Buildpacks)
+	build.Plan, err = buildpacks.Plan(sb.BuildContext)
+	if nbe, ok := err.(sous.NoBuildpackError); ok {
+		return UsageErrorf("%s", nbe).WithTip(
+			"sous can currently build: " + strings.Join(nbe.Tried, ", "))
+	}
+	if err != nil {
+		return cmdr.EnsureErrorResult(err)
+	}
+	targets := strings.Split(sb.flags.target, ",")
+	available := build.Targets(nil)
+	for _, t := range targets {
+		if _, ok := available[t]; !ok {
+			return UsageErrorf("unknown target %q", t).WithTip(
+				"available targets: " + strings.Join(available.SortedKeys(), ", "))
+		}
+	}
+	opts := sous.BuildOptions{
+		Rebuild:    sb.flags.rebuild,
+		RebuildAll: sb.flags.rebuildAll,
+	}
+	var cache sous.TargetCache
+	if last != nil {
+		cache = last
+	}
+	source := sb.BuildContext.Source
+	started := &sous.BuildStarted{Source: source.Source(), Revision: source.Revision,
+		Version: source.Version().String()}
+	if _, err := sb.Engine.Events.Append(started); err != nil {
+		return cmdr.EnsureErrorResult(err)
+	}
+	results, err := build.Start(targets, cache, opts)
+	finished := &sous.BuildFinished{Source: started.Source, Revision: started.Revision,
+		Version: started.Version}
+	if err != nil {
+		finished.Error = err.Error()
+	} else {
+		finished.Image = results[targets[len(targets)-1]].Image
+	}
+	if _, aerr := sb.Engine.Events.Append(finished); aerr != nil && err == nil {
+		err = aerr
 	}
-	build, err := sous.NewBuildWithShells(sb.WDShell.Sh, sb.ScratchShell.Sh)
 	if err != nil {
 		return cmdr.EnsureErrorResult(err)
 	}
-	if err := build.Start(); err != nil {
+	if err := sb.record(last, results); err != nil {
 		return cmdr.EnsureErrorResult(err)
 	}
+	out := &bytes.Buffer{}
+	for _, t := range targets {
+		r := results[t]
+		status := "built"
+		if r.Cached {
+			status = "up to date"
+		}
+		fmt.Fprintf(out, "%s %s: %s\n", t, status, r.Image)
+	}
+	return SuccessData(out.Bytes())
+}
 
-	return InternalErrorf("not implemented")
+// record records the results of this build, alongside the results of any
+// targets built previously but not built this time.
+func (sb *SousBuild) record(last *sous.BuildRecord, results sous.TargetResults) error {
+	r, err := sous.NewBuildRecord(sb.BuildContext, sb.Sous.Version.String())
+	if err != nil {
+		return err
+	}
+	r.Targets = sous.TargetResults{}
+	if last != nil {
+		for name, t := range last.Targets {
+			r.Targets[name] = t
+		}
+	}
+	for name, t := range results {
+		r.Targets[name] = t
+	}
+	return sb.BuildState.Record(r)
+}
+
+// resetBuildContext recreates the build context for the source code in the
+// working directory of WDShell, in case it was changed by passing a path.
+func (sb *SousBuild) resetBuildContext() error {
+	c, err := newLocalGitClient(sb.WDShell)
+	if err != nil {
+		return err
+	}
+	r, err := newLocalGitRepo(c)
+	if err != nil {
+		return err
+	}
+	s, err := newSourceContext(r)
+	if err != nil {
+		return err
+	}
+	sb.BuildContext, err = newBuildContext(sb.Sous, sb.User, s, sb.ScratchShell)
+	return err
 }
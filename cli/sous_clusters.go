@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+// SousClusters lists the clusters in the shared config, and their health.
+type SousClusters struct {
+	API server.API
+	Out Out
+}
+
+func init() { TopLevelCommands["clusters"] = &SousClusters{} }
+
+const sousClustersHelp = `
+list clusters and check their health
+
+clusters lists each cluster in the shared configuration, along with its kind,
+whether sous can reach it, and a short description from its driver.
+
+args:
+
+A cluster's Kind selects the driver sous uses to deploy to it. Sous knows these
+kinds: local, an in-memory cluster for development and testing, and singularity.
+Kinds are not case sensitive, so moving a cluster to a different scheduler only
+means changing its Kind and URL in the shared configuration.
+`
+
+func (*SousClusters) Help() string { return sousClustersHelp }
+
+func (sc *SousClusters) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous clusters")
+	}
+	config, err := sc.API.SharedConfig()
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	if len(config.Clusters) == 0 {
+		return Successf("no clusters configured")
+	}
+	rows := [][]string{{"NAME", "KIND", "HEALTH", "DESCRIPTION"}}
+	for _, c := range config.Clusters {
+		d, err := sous.NewClusterDriver(c, config)
+		if err != nil {
+			rows = append(rows, []string{c.Name, c.Kind, "unusable", err.Error()})
+			continue
+		}
+		health := "ok"
+		if err := d.Health(); err != nil {
+			health = "unreachable: " + err.Error()
+		}
+		rows = append(rows, []string{c.Name, c.Kind, health, d.Describe()})
+	}
+	sc.Out.Table(rows)
+	return Success()
+}
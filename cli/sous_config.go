@@ -1,6 +1,20 @@
 package cli
 
+import (
+	"flag"
+
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+	"github.com/opentable/sous/util/configloader"
+)
+
 type SousConfig struct {
+	User   LocalUser
+	Config LocalSousConfig
+	Out    Out
+	flags  struct {
+		dump string
+	}
 }
 
 func init() { TopLevelCommands["config"] = &SousConfig{} }
@@ -10,9 +24,128 @@ view and edit sous configuration
 
 usage: sous config [<key> [value]]
 
-Invoking sous config with no arguments lists all configuration key/value pairs.
-If you pass just a single argument (a key) sous config will output just the
-value of that key. You can set a key by providing both a key and a value.
+Invoking sous config with no arguments lists all configuration key/value pairs,
+and where each value came from: default, system file, user file, repo file, env,
+or flags. If you pass just a single argument (a key) sous config will output
+just the value of that key. You can set a key by providing both a key and a
+value.
+
+args: [key [value]]
+
+Keys with an environment variable override are named after that variable, e.g.
+sous-server is overridden by SOUS_SERVER. Other keys are named after their
+place in the config file, e.g. policy.dockerfile.required-labels. Lists are set
+as comma-separated values, and maps as comma-separated key=value pairs.
+
+Config files may be JSON, YAML or TOML, named config.json, config.yaml,
+config.yml or config.toml. Sous reads /etc/sous/config, then the file in your
+sous config directory, which is ~/.sous unless you set SOUS_CONFIG_DIR, then
+.sous/config in the root of the current git repository. Values are written to
+the file in your sous config directory, config.json if none exists.
+
+Use -dump json, -dump yaml, or -dump toml to output the effective configuration
+as a config file. Config files are validated when they are loaded, use
+sous config schema to output the JSON Schema they must satisfy.
+
+Secret values, such as contract-signing-key, are shown as (secret), and are
+left out of -dump.
 `
 
 func (sc *SousConfig) Help() string { return sousConfigHelp }
+
+func (sc *SousConfig) Subcommands() cmdr.Commands {
+	return cmdr.Commands{
+		"schema": &SousConfigSchema{},
+		"shared": &SousConfigShared{},
+	}
+}
+
+func (sc *SousConfig) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sc.flags.dump, "dump", "",
+		"output the effective configuration in `format`: json, yaml or toml")
+}
+
+func (sc *SousConfig) Execute(args []string) cmdr.Result {
+	if sc.flags.dump != "" {
+		return sc.dump(args)
+	}
+	switch len(args) {
+	case 0:
+		return sc.list()
+	case 1:
+		f, err := configField(sc.Config.Config, args[0])
+		if err != nil {
+			return err
+		}
+		return Successf("%s", f.Redacted())
+	case 2:
+		return sc.set(args[0], args[1])
+	}
+	return UsageErrorf("usage: sous config [<key> [value]]")
+}
+
+func (sc *SousConfig) list() cmdr.Result {
+	fields, err := configloader.Fields(sc.Config.Config)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	rows := make([][]string, len(fields))
+	for i, f := range fields {
+		rows[i] = []string{configKey(f), f.Redacted(), sc.source(f)}
+	}
+	sc.Out.Table(rows)
+	return SuccessData(nil)
+}
+
+// set validates value, and writes it to the user's config file. The file is
+// loaded on its own, so that neither defaults nor environment overrides are
+// written to it, and is only written if the result is a valid config.
+func (sc *SousConfig) set(key, value string) cmdr.Result {
+	f, errResult := configField(&sous.Config{}, key)
+	if errResult != nil {
+		return errResult
+	}
+	if err := f.Set(value); err != nil {
+		return UsageErrorf("invalid value for %s", key).WithUnderlyingError(err)
+	}
+	if f.Key == "" {
+		return UsageErrorf("%s cannot be set in a config file", key)
+	}
+	path := sc.User.ConfigFile()
+	err := configloader.SetFileField(&sous.Config{}, path, f.Key, f.Value.Interface())
+	if _, ok := err.(configloader.ValidationErrors); ok {
+		return UsageErrorf("invalid value for %s", key).WithUnderlyingError(err)
+	}
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	switch source := sc.source(f); source {
+	case "repo file", "env", "flags":
+		return Successf("set %s in %s, but it is overridden by the %s", configKey(f), path, source)
+	}
+	return SuccessData(nil)
+}
+
+// source returns the name of the layer the value of f came from, e.g. "env".
+func (sc *SousConfig) source(f configloader.Field) string {
+	if s, ok := sc.Config.Sources[f.Path]; ok {
+		return s
+	}
+	return "default"
+}
+
+// dump outputs the effective configuration in the format named by -dump.
+func (sc *SousConfig) dump(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("-dump does not take any arguments")
+	}
+	format, err := configloader.ParseFormat(sc.flags.dump)
+	if err != nil {
+		return UsageErrorf("%s", err)
+	}
+	b, err := configloader.Dump(sc.Config.Config, format)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(b)
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"encoding/json"
+
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+	"github.com/opentable/sous/util/configloader"
+)
+
+// SousConfigSchema outputs the JSON Schema of sous config files.
+type SousConfigSchema struct{}
+
+const sousConfigSchemaHelp = `
+output the JSON Schema for sous config files
+
+schema outputs a JSON Schema describing the keys sous config files may contain,
+and the values they may take. Sous validates config files against this schema
+whenever it loads them, and refuses to run if they contain unknown keys or
+invalid values. You can use the schema to check config files before deploying
+them, or to get completion in your editor.
+
+args:
+`
+
+func (*SousConfigSchema) Help() string { return sousConfigSchemaHelp }
+
+func (*SousConfigSchema) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous config schema")
+	}
+	s, err := configloader.NewSchema(&sous.Config{})
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(append(b, '\n'))
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/json"
+
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+// SousConfigShared outputs the shared configuration published by the Sous
+// server.
+type SousConfigShared struct {
+	Client *server.Client
+}
+
+const sousConfigSharedHelp = `
+output the shared configuration from the sous server
+
+shared fetches the organisation-wide configuration published by your sous
+server, including cluster definitions, the buildpacks that may be used, and
+platform contracts, and outputs it as JSON.
+
+args:
+
+The configuration is cached in the cache directory inside your sous config
+directory. Each time it is needed, sous asks the server whether it has changed,
+and if the server cannot be reached, sous uses the cached copy, so that you can
+keep working offline.
+`
+
+func (*SousConfigShared) Help() string { return sousConfigSharedHelp }
+
+func (sc *SousConfigShared) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous config shared")
+	}
+	if sc.Client.BaseURL == "" {
+		return UsageErrorf("no sous server configured").WithTip(
+			"set one using: sous config sous-server http://your.sous.server")
+	}
+	config, err := sc.Client.SharedConfig()
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(append(b, '\n'))
+}
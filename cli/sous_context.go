@@ -16,7 +16,8 @@ func init() { TopLevelCommands["context"] = &SousContext{} }
 const sousContextHelp = `
 show the current build context
 
-context prints out sous's view of your current context
+context prints out sous's view of your current context, including the version
+of the source code, which is used to tag images built from it
 
 args:
 `
@@ -24,7 +25,11 @@ args:
 func (*SousContext) Help() string { return sousContextHelp }
 
 func (sv *SousContext) Execute(args []string) cmdr.Result {
-	b, err := json.MarshalIndent(sv.SourceContext, "", "  ")
+	c := struct {
+		*sous.SourceContext
+		Version string
+	}{sv.SourceContext, sv.SourceContext.Version().String()}
+	b, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return EnsureErrorResult(err)
 	}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+// SousContracts runs platform contracts against a docker image.
+type SousContracts struct {
+	API     server.API
+	WDShell LocalWorkDirShell
+	Records *sous.ContractRecords
+	Engine  *sous.Engine
+	Out     Out
+	flags   struct {
+		file, host string
+		json       bool
+	}
+}
+
+func init() { TopLevelCommands["contracts"] = &SousContracts{} }
+
+const sousContractsHelp = `
+run platform contracts against a docker image
+
+contracts starts the image in a new container for each contract, runs the
+contract's checks against it, and reports whether each check passed. If any
+contract fails, contracts exits with a non-zero exit code.
+
+args: [-file <path>] [-host <host>] [-json] <image> [<contract>...]
+
+By default, the contracts are those in the shared configuration, use -file to
+read them from a YAML file instead. If you name contracts, only those are run.
+
+A contract is a name, optional env, and a list of checks:
+
+  - Name: http-service
+    Env:
+      HEALTH_URL: http://{{.Host}}:{{.Port0}}/health
+    Checks:
+    - Kind: listens
+    - Kind: http
+      Path: /health
+      Timeout: 30s
+    - Kind: stops
+    - Kind: logs
+
+Each check has a Kind, which is one of:
+
+  listens  the container accepts TCP connections on $PORT0
+  http     GET Path on $PORT0 responds with Status, 200 by default
+  stops    the container exits cleanly on SIGTERM, with code 0 or 143
+  logs     the container writes to stdout, matching Pattern if set
+
+Contracts are templates, which may refer to {{.Image}}, {{.Container}},
+{{.Host}} and {{.Port0}}. Use -host to set the host that container ports are
+published on, if it is not localhost, e.g. when using docker-machine.
+
+If ContractSigningKey is configured, the image is first resolved to its ID, and
+the contracts are run against that, so that the result of each contract from
+the shared configuration can be recorded against the image's digest, signed
+with that private key. Clusters which require contracts only accept images
+with passing records for them, see 'sous plan'. Results of contracts read with
+-file are never recorded.
+`
+
+func (*SousContracts) Help() string { return sousContractsHelp }
+
+func (sc *SousContracts) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sc.flags.file, "file", "", "read contracts from the YAML file at `path`")
+	fs.StringVar(&sc.flags.host, "host", "localhost", "the `host` container ports are published on")
+	fs.BoolVar(&sc.flags.json, "json", false, "output results as JSON")
+}
+
+func (sc *SousContracts) Execute(args []string) cmdr.Result {
+	if len(args) == 0 {
+		return UsageErrorf("usage: sous contracts [-file path] [-host host] [-json] <image> [<contract>...]")
+	}
+	contracts, err := sc.contracts(args[1:])
+	if err != nil {
+		return err
+	}
+	d, derr := docker.NewClient(sc.WDShell.Sh)
+	if derr != nil {
+		return EnsureErrorResult(derr)
+	}
+	// Recorded results must be for the image that was tested, so resolve the
+	// image's ID before running anything, in case its tag moves meanwhile.
+	image, recording := args[0], sc.flags.file == "" && sc.Records.SigningKey != nil
+	if recording {
+		inspection, err := d.InspectImage(image)
+		if err != nil {
+			return UsageErrorf("cannot find image %s", image).WithTip("try docker pull " + image)
+		}
+		image = inspection.ID
+	}
+	results, rerr := sous.NewDockerContractRunner(d, sc.flags.host).RunAll(contracts, image)
+	if rerr != nil {
+		return EnsureErrorResult(rerr)
+	}
+	if err := sc.logEvents(args[0], image, results); err != nil {
+		return EnsureErrorResult(err)
+	}
+	if recording {
+		if err := sc.record(image, results); err != nil {
+			return EnsureErrorResult(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if sc.flags.json {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return EnsureErrorResult(err)
+		}
+		out.Write(append(b, '\n'))
+	} else {
+		for _, r := range results {
+			result := "PASS"
+			if !r.Passed {
+				result = "FAIL"
+			}
+			fmt.Fprintf(out, "%s %s\n", result, r.Contract)
+			for _, c := range r.Checks {
+				mark := "ok  "
+				if !c.Passed {
+					mark = "FAIL"
+				}
+				fmt.Fprintf(out, "  %s %-8s %s\n", mark, c.Kind, c.Message)
+			}
+		}
+	}
+	if failed != 0 {
+		sc.Out.Write(out.Bytes())
+		return DataErrorf("%d of %d contracts failed", failed, len(results))
+	}
+	return SuccessData(out.Bytes())
+}
+
+// logEvents appends a ContractRun event for each of results to the event log.
+// Image is the image as the user named it, and resolved is the image the
+// contracts were run against, which is its ID if it was resolved.
+func (sc *SousContracts) logEvents(image, resolved string, results []*sous.ContractResult) error {
+	digest := ""
+	if resolved != image {
+		digest = resolved
+	}
+	events := make([]sous.EventData, len(results))
+	for i, r := range results {
+		events[i] = &sous.ContractRun{Image: image, Digest: digest, Contract: r.Contract, Passed: r.Passed}
+	}
+	_, err := sc.Engine.Events.Append(events...)
+	return err
+}
+
+// record records results against id, the ID of the image they are for.
+func (sc *SousContracts) record(id string, results []*sous.ContractResult) error {
+	for _, r := range results {
+		if _, err := sc.Records.Record(id, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contracts returns the contracts named, or all contracts if names is empty.
+func (sc *SousContracts) contracts(names []string) (sous.Contracts, cmdr.ErrorResult) {
+	var all sous.Contracts
+	if sc.flags.file != "" {
+		var err error
+		if all, err = sous.LoadContracts(sc.flags.file); err != nil {
+			return nil, EnsureErrorResult(err)
+		}
+	} else {
+		config, err := sc.API.SharedConfig()
+		if err != nil {
+			return nil, EnsureErrorResult(err)
+		}
+		all = config.Contracts
+	}
+	if len(all) == 0 {
+		return nil, UsageErrorf("no contracts defined").WithTip(
+			"define contracts in the shared configuration, or use -file")
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+	selected := sous.Contracts{}
+	for _, name := range names {
+		c, ok := all.Named(name)
+		if !ok {
+			return nil, UsageErrorf("no contract named %q", name)
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
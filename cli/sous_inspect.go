@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"encoding/json"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+type SousInspect struct {
+	WDShell LocalWorkDirShell
+}
+
+func init() { TopLevelCommands["inspect"] = &SousInspect{} }
+
+const sousInspectHelp = `
+show where a docker image came from
+
+inspect reads the labels sous applies to every image it builds, and prints the
+repository, revision, and other details of the source code it was built from.
+
+args: <image>
+`
+
+func (*SousInspect) Help() string { return sousInspectHelp }
+
+func (si *SousInspect) Execute(args []string) cmdr.Result {
+	if len(args) != 1 {
+		return UsageErrorf("usage: sous inspect <image>")
+	}
+	d, err := docker.NewClient(si.WDShell.Sh)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	i, err := d.InspectImage(args[0])
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	source, err := sous.ParseLabels(i.Config.Labels)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	b, err := json.MarshalIndent(source, "", "  ")
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(append(b, '\n'))
+}
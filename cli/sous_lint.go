@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+type (
+	SousLint struct{}
+	// SousLintDockerfile lints Dockerfiles against the Dockerfile policy in
+	// the Sous configuration.
+	SousLintDockerfile struct {
+		Config       LocalSousConfig
+		BuildContext *sous.BuildContext
+		SharedConfig *sous.SharedConfig
+		Out          Out
+		flags        struct {
+			json bool
+		}
+	}
+)
+
+func init() { TopLevelCommands["lint"] = &SousLint{} }
+
+const sousLintHelp = `
+check files against organisation policy
+
+lint checks files against the rules in the policy section of your sous
+configuration. Use one of the subcommands below to choose what to lint.
+
+args: <subcommand>
+
+subcommands:
+  dockerfile  lint a Dockerfile, or the Dockerfiles sous generates
+`
+
+func (*SousLint) Help() string { return sousLintHelp }
+
+func (*SousLint) Subcommands() cmdr.Commands {
+	return cmdr.Commands{"dockerfile": &SousLintDockerfile{}}
+}
+
+const sousLintDockerfileHelp = `
+lint Dockerfiles against policy
+
+lint dockerfile checks the Dockerfile at path against the rules configured in
+Policy.Dockerfile in your sous configuration. If you do not pass a path, it
+checks the Dockerfiles sous would generate to build the project in your current
+directory.
+
+args: [path]
+
+Each finding has a severity of error, warning, or info. If there are any errors,
+lint exits with a non-zero exit code, so that it can be used to gate CI builds.
+Use -json to output findings in a machine-readable format.
+
+The rules are:
+  latest-tag          base images must have a tag other than "latest"
+  require-user        the final stage must set a USER other than root
+  remote-add          ADD must not fetch remote URLs
+  required-labels     the final stage must set all Policy.Dockerfile.RequiredLabels
+  allowed-registries  base images must come from Policy.Dockerfile.AllowedRegistries
+
+Change the severity of a rule, or turn it off, by setting
+Policy.Dockerfile.Severities, e.g. {"require-user": "off"}.
+`
+
+func (*SousLintDockerfile) Help() string { return sousLintDockerfileHelp }
+
+func (sl *SousLintDockerfile) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&sl.flags.json, "json", false, "output findings as JSON")
+}
+
+func (sl *SousLintDockerfile) Execute(args []string) cmdr.Result {
+	files, err := sl.dockerfiles(args)
+	if err != nil {
+		return err
+	}
+	policy := sl.Config.Policy.Dockerfile
+	findings := sous.LintFindings{}
+	for _, name := range sortedFileNames(files) {
+		findings = append(findings, sous.LintDockerfile(name, files[name], policy)...)
+	}
+	out := &bytes.Buffer{}
+	if sl.flags.json {
+		b, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return EnsureErrorResult(err)
+		}
+		out.Write(append(b, '\n'))
+	} else {
+		for _, f := range findings {
+			fmt.Fprintln(out, f)
+		}
+	}
+	if n := findings.Errors(); n != 0 {
+		sl.Out.Write(out.Bytes())
+		return DataErrorf("%d lint errors", n)
+	}
+	return SuccessData(out.Bytes())
+}
+
+// dockerfiles returns the Dockerfiles to lint, keyed by name.
+func (sl *SousLintDockerfile) dockerfiles(args []string) (map[string]docker.File, cmdr.ErrorResult) {
+	if len(args) > 1 {
+		return nil, UsageErrorf("usage: sous lint dockerfile [path]")
+	}
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return nil, EnsureErrorResult(err)
+		}
+		defer f.Close()
+		d, err := docker.ParseFile(f)
+		if err != nil {
+			return nil, DataErrorf("parsing %s", args[0]).WithUnderlyingError(err)
+		}
+		return map[string]docker.File{args[0]: *d}, nil
+	}
+	buildpacks := sous.RegisteredBuildpacks.Allowed(sl.SharedConfig.Buildpacks)
+	plan, err := buildpacks.Plan(sl.BuildContext)
+	if err != nil {
+		return nil, EnsureErrorResult(err)
+	}
+	return plan.Dockerfiles(sl.BuildContext), nil
+}
+
+func sortedFileNames(files map[string]docker.File) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
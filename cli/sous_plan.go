@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+// SousPlan shows what sous would do to make each cluster match the GDM,
+// without doing it.
+type SousPlan struct {
+	API     server.API
+	WDShell LocalWorkDirShell
+	Records *sous.ContractRecords
+	Out     Out
+	flags   struct {
+		observed string
+		json     bool
+	}
+}
+
+func init() { TopLevelCommands["plan"] = &SousPlan{} }
+
+const sousPlanHelp = `
+show the changes needed to make each cluster match the GDM
+
+plan compares the global deployment manifest with what is running in each
+cluster, and lists the actions needed to resolve the differences, in the order
+they would be applied: create, update, scale, and then delete. Nothing is
+changed; plan is a dry run.
+
+args: [-observed <state location>] [-json]
+
+Each cluster is observed using the driver for its Kind, e.g. singularity, or
+local for an in-memory cluster. Use -observed to read the observed state from
+a state file or tree instead, using the deployments its GDM declares for each
+cluster, with the cluster's DefaultEnv, as the deployments running there.
+
+Use -json to output the plan as JSON instead of a table.
+
+Clusters may require images to pass contracts before they are deployed there,
+see 'sous contracts'. If any create or update would deploy an image which has
+no signed record of passing one of its cluster's RequiredContracts, plan lists
+those deployments and fails. Images are identified by their digest, so each
+must have been pulled, and ContractVerificationKey must be set in the shared
+configuration, or ContractSigningKey configured.
+`
+
+func (*SousPlan) Help() string { return sousPlanHelp }
+
+func (sp *SousPlan) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sp.flags.observed, "observed", "",
+		"the state file or tree `location` describing what each cluster runs")
+	fs.BoolVar(&sp.flags.json, "json", false, "output the plan as JSON")
+}
+
+func (sp *SousPlan) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous plan [-observed location] [-json]")
+	}
+	config, err := sp.API.SharedConfig()
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	gdm, err := sp.API.GDM()
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	observed, err := sp.observe(config)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	plan, err := sous.Resolve(gdm, observed, config.Clusters)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	if err := sp.contractGate(config).Check(plan); err != nil {
+		return contractGateResult(err, config)
+	}
+	if sp.flags.json {
+		b, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return EnsureErrorResult(err)
+		}
+		return SuccessData(append(b, '\n'))
+	}
+	if plan.Empty() {
+		return Successf("nothing to do, every cluster matches the GDM")
+	}
+	sp.Out.Table(planTable(plan))
+	return Success()
+}
+
+// observe returns the deployments in each cluster, either from the state at
+// -observed, or by observing each cluster with its driver.
+func (sp *SousPlan) observe(config *sous.SharedConfig) (map[string]sous.ClusterDeployments, error) {
+	if sp.flags.observed == "" {
+		drivers, err := sous.NewClusterDrivers(config)
+		if err != nil {
+			return nil, err
+		}
+		return drivers.Observe()
+	}
+	observedState, err := sous.LoadState(sp.flags.observed)
+	if err != nil {
+		return nil, err
+	}
+	observed := map[string]sous.ClusterDeployments{}
+	for _, c := range config.Clusters {
+		observed[c.Name] = observedState.GDM.Effective(c)
+	}
+	return observed, nil
+}
+
+// contractGate returns a gate which identifies images by their digest in the
+// local docker daemon.
+func (sp *SousPlan) contractGate(config *sous.SharedConfig) *sous.ContractGate {
+	return &sous.ContractGate{
+		Records: sp.Records,
+		Digest: func(s sous.Source, version string) (string, error) {
+			d, err := docker.NewClient(sp.WDShell.Sh)
+			if err != nil {
+				return "", err
+			}
+			ref, err := sous.ImageRef(config.DockerRegistry, s, version)
+			if err != nil {
+				return "", err
+			}
+			inspection, err := d.InspectImage(ref)
+			if err != nil {
+				return "", fmt.Errorf("cannot find image %s, try docker pull %s", ref, ref)
+			}
+			return inspection.ID, nil
+		},
+	}
+}
+
+// contractGateResult returns err as a result, with a tip to run the contracts
+// missing for each refused deployment.
+func contractGateResult(err error, config *sous.SharedConfig) cmdr.Result {
+	gerr, ok := err.(*sous.ContractGateError)
+	if !ok {
+		return EnsureErrorResult(err)
+	}
+	var commands []string
+	for _, r := range gerr.Refusals {
+		if len(r.Missing) == 0 {
+			continue
+		}
+		ref, err := sous.ImageRef(config.DockerRegistry, r.Source, r.Version)
+		if err != nil {
+			continue
+		}
+		commands = append(commands, "sous contracts "+ref+" "+strings.Join(r.Missing, " "))
+	}
+	result := DataErrorf("%s", gerr)
+	if len(commands) == 0 {
+		return result.WithTip("set ContractVerificationKey in the shared config, and pull each image, so contract results can be checked")
+	}
+	return result.WithTip("record passing results of the missing contracts, with ContractSigningKey set:\n  " +
+		strings.Join(commands, "\n  "))
+}
+
+// planTable returns plan as rows for Output.Table, one row per action.
+func planTable(plan *sous.Plan) [][]string {
+	rows := [][]string{{"CLUSTER", "ACTION", "SOURCE", "CHANGES"}}
+	for _, cp := range plan.Clusters {
+		for _, a := range cp.Actions {
+			rows = append(rows, []string{cp.Cluster.Name, string(a.Kind), a.Source.String(),
+				strings.Join(a.Changes(), "; ")})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+type (
+	// SousQuery groups commands which query sous state.
+	SousQuery struct{}
+	// SousQueryEndpoint queries a single server endpoint.
+	SousQueryEndpoint struct {
+		API server.API
+		// get calls the API method for this endpoint.
+		get func(server.API) (interface{}, error)
+		// help is the help text for this endpoint.
+		help string
+	}
+)
+
+func init() { TopLevelCommands["query"] = &SousQuery{} }
+
+const sousQueryHelp = `
+query sous state
+
+query outputs sous state as JSON. If you have configured a sous server, it is
+fetched from the server, otherwise it is read from the StateLocation and build
+state directory in your local sous configuration. Each subcommand outputs the
+same data as the matching endpoint of sous server.
+
+args: <subcommand>
+
+subcommands:
+  config        the shared configuration
+  clusters      the clusters in the shared configuration
+  gdm           the global deployment manifest
+  applications  the applications in the global deployment manifest
+  builds        the last build of each project
+`
+
+func (*SousQuery) Help() string { return sousQueryHelp }
+
+func (*SousQuery) Subcommands() cmdr.Commands {
+	return cmdr.Commands{
+		"config": &SousQueryEndpoint{
+			get:  func(a server.API) (interface{}, error) { return a.SharedConfig() },
+			help: "output the shared configuration",
+		},
+		"clusters": &SousQueryEndpoint{
+			get:  func(a server.API) (interface{}, error) { return a.Clusters() },
+			help: "output the clusters in the shared configuration",
+		},
+		"gdm": &SousQueryEndpoint{
+			get:  func(a server.API) (interface{}, error) { return a.GDM() },
+			help: "output the global deployment manifest",
+		},
+		"applications": &SousQueryEndpoint{
+			get:  func(a server.API) (interface{}, error) { return a.Applications() },
+			help: "output the applications in the global deployment manifest",
+		},
+		"builds": &SousQueryEndpoint{
+			get:  func(a server.API) (interface{}, error) { return a.Builds() },
+			help: "output the last build of each project, most recent first",
+		},
+	}
+}
+
+func (sq *SousQueryEndpoint) Help() string { return "\n" + sq.help + "\n\nargs:\n" }
+
+func (sq *SousQueryEndpoint) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("this query does not take any arguments")
+	}
+	v, err := sq.get(sq.API)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(append(b, '\n'))
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"flag"
+	"net/http"
+	"sync"
+
+	"github.com/opentable/sous/server"
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+// SousServer runs the Sous server.
+type SousServer struct {
+	Sous       *Sous
+	Config     LocalSousConfig
+	BuildState *sous.BuildState
+	Messenger  *sous.Messenger
+	ErrOut     ErrOut
+	flags      struct {
+		listen string
+	}
+}
+
+func init() { TopLevelCommands["server"] = &SousServer{} }
+
+const sousServerHelp = `
+run the sous server
+
+server runs an HTTP server which publishes the sous state at StateLocation in
+your sous configuration, and the build records in your build state directory,
+as JSON. Sous clients configured with this server's URL as their sous-server
+fetch their shared configuration from it.
+
+args:
+
+The server provides these endpoints, each of which can also be queried using
+sous query, with or without a server:
+
+  /config        the shared configuration
+  /clusters      the clusters in the shared configuration
+  /gdm           the global deployment manifest
+  /applications  the applications in the global deployment manifest
+  /builds        the last build of each project
+
+State is re-read on every request, so changes are published without
+restarting the server. Each request is reported on the terminal, unless you use
+-q or -s, and in LogFile, if it is configured. Requests from sous clients continue their trace,
+so they share its correlation ID.
+`
+
+func (*SousServer) Help() string { return sousServerHelp }
+
+func (ss *SousServer) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&ss.flags.listen, "listen", ":5550",
+		"the `address` to listen on, in the form host:port")
+}
+
+func (ss *SousServer) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous server [-listen host:port]")
+	}
+	s := &server.Server{
+		API: &server.Local{
+			StateLocation: ss.Config.StateLocation,
+			BuildState:    ss.BuildState,
+		},
+		Messenger: ss.Messenger,
+	}
+	// Requests are info messages, which the terminal only shows at loud
+	// verbosity, so at normal verbosity log them to it directly. Handlers run
+	// concurrently, so they take turns.
+	if ss.Sous.Verbosity() == cmdr.Normal {
+		var mu sync.Mutex
+		s.Log = func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			ss.ErrOut.Println(line)
+		}
+	}
+	ss.ErrOut.Printfln("listening on %s", ss.flags.listen)
+	return EnsureErrorResult(http.ListenAndServe(ss.flags.listen, s))
+}
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/opentable/sous/ext/git"
+	"github.com/opentable/sous/util/cmdr"
+	"github.com/opentable/sous/util/yaml"
+)
+
+type (
+	// SousState groups commands which inspect the history of the state.
+	SousState struct{}
+	// SousStateHistory lists the commits which changed the state.
+	SousStateHistory struct {
+		StateRepo *git.StateRepo
+		Out       Out
+		flags     struct {
+			max int
+		}
+	}
+	// SousStateDiff shows how the GDM changed between two revisions.
+	SousStateDiff struct {
+		StateRepo *git.StateRepo
+		flags     struct {
+			from, to string
+		}
+	}
+	// SousStateCommit commits changes made to the state tree.
+	SousStateCommit struct {
+		StateRepo *git.StateRepo
+		flags     struct {
+			reason, author string
+		}
+	}
+	// SousStateShow outputs the state at a revision.
+	SousStateShow struct {
+		StateRepo *git.StateRepo
+		flags     struct {
+			at  string
+			gdm bool
+		}
+	}
+)
+
+func init() { TopLevelCommands["state"] = &SousState{} }
+
+const sousStateHelp = `
+inspect the history of sous state
+
+When StateLocation is a state tree directory, it is kept in a git repository,
+and every change to the state is a commit, recording who made it and why. Use
+commit to record changes you have made to the state tree, and the other commands
+to audit those changes and see the state as it was at any point in time.
+
+args: <subcommand>
+
+subcommands:
+  commit   record the changes made to the state tree, and why
+  history  list the changes to the state, most recent first
+  diff     show the deployments which differ between two revisions
+  show     output the state at a revision, or a point in time
+
+Wherever a revision is expected, you can use any git revision, e.g. HEAD~2, or
+a time in RFC 3339 format, e.g. 2016-04-01T12:00:00Z, meaning the state as it
+was at that time.
+`
+
+func (*SousState) Help() string { return sousStateHelp }
+
+func (*SousState) Subcommands() cmdr.Commands {
+	return cmdr.Commands{
+		"commit":  &SousStateCommit{},
+		"history": &SousStateHistory{},
+		"diff":    &SousStateDiff{},
+		"show":    &SousStateShow{},
+	}
+}
+
+// resolveRevision returns the git revision for rev, which may be a revision or
+// an RFC 3339 time.
+func resolveRevision(r *git.StateRepo, rev string) (string, error) {
+	t, err := time.Parse(time.RFC3339, rev)
+	if err != nil {
+		return rev, nil
+	}
+	return r.RevisionAsOf(t)
+}
+
+const sousStateCommitHelp = `
+record the changes made to the state tree, and why
+
+commit loads the state tree in StateLocation, as you have edited it, and commits
+it to the state repository. The commit message is the reason you give, followed
+by trailers listing the deployments which changed. The author is the identity
+git is configured with, unless you use -author.
+
+args: -m <reason> [-author <name <email>>]
+`
+
+func (*SousStateCommit) Help() string { return sousStateCommitHelp }
+
+func (sc *SousStateCommit) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sc.flags.reason, "m", "", "the `reason` for the change (required)")
+	fs.StringVar(&sc.flags.author, "author", "", "the `author` of the change, e.g. \"Name <email>\"")
+}
+
+func (sc *SousStateCommit) Execute(args []string) cmdr.Result {
+	if len(args) != 0 || sc.flags.reason == "" {
+		return UsageErrorf("usage: sous state commit -m reason [-author author]")
+	}
+	author, err := sc.StateRepo.Client.User()
+	if sc.flags.author != "" {
+		author, err = git.ParseSignature(sc.flags.author)
+	}
+	if err != nil {
+		return UsageErrorf("%s", err).WithTip(`use -author "Name <email>"`)
+	}
+	state, err := sc.StateRepo.State()
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	rev, err := sc.StateRepo.Save(state, git.StateChange{Author: author, Reason: sc.flags.reason})
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	if rev == "" {
+		return Successf("no changes to commit")
+	}
+	return Successf("committed %s", rev[:12])
+}
+
+const sousStateHistoryHelp = `
+list the changes to the state, most recent first
+
+history lists the commits in the state repository: their revision, time, author
+and reason, followed by the deployments each one changed.
+
+args:
+`
+
+func (*SousStateHistory) Help() string { return sousStateHistoryHelp }
+
+func (sh *SousStateHistory) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&sh.flags.max, "n", 0, "list at most `n` changes, 0 means all")
+}
+
+func (sh *SousStateHistory) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous state history [-n max]")
+	}
+	commits, err := sh.StateRepo.History(sh.flags.max)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	if len(commits) == 0 {
+		return Successf("no changes yet")
+	}
+	rows := [][]string{{"REVISION", "TIME", "AUTHOR", "REASON"}}
+	for _, c := range commits {
+		rows = append(rows, []string{c.Revision[:12], c.Author.Time.Format(time.RFC3339),
+			c.Author.String(), c.Subject})
+		for _, changed := range c.Trailers.Get(git.ChangedTrailer) {
+			rows = append(rows, []string{"", "", "", "  " + changed})
+		}
+	}
+	sh.Out.Table(rows)
+	return Success()
+}
+
+const sousStateDiffHelp = `
+show the deployments which differ between two revisions
+
+diff lists every deployment added (+), removed (-) or changed (~) between the
+global deployment manifests at two revisions, with the fields that changed.
+From defaults to the revision before to, which defaults to HEAD.
+
+args: [-from <revision>] [-to <revision>]
+`
+
+func (*SousStateDiff) Help() string { return sousStateDiffHelp }
+
+func (sd *SousStateDiff) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sd.flags.from, "from", "", "the `revision` or time to compare from")
+	fs.StringVar(&sd.flags.to, "to", "HEAD", "the `revision` or time to compare to")
+}
+
+func (sd *SousStateDiff) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous state diff [-from revision] [-to revision]")
+	}
+	to, err := resolveRevision(sd.StateRepo, sd.flags.to)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	from := to + "~"
+	if sd.flags.from != "" {
+		if from, err = resolveRevision(sd.StateRepo, sd.flags.from); err != nil {
+			return EnsureErrorResult(err)
+		}
+	}
+	diffs, err := sd.StateRepo.Diff(from, to)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	if len(diffs) == 0 {
+		return Successf("no deployments changed")
+	}
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+	return Successf("%s", strings.Join(lines, "\n"))
+}
+
+const sousStateShowHelp = `
+output the state at a revision, or a point in time
+
+show reconstructs the state as it was at a revision, and outputs it as YAML, in
+the same format as a pre-compiled state file. Use -gdm to output only the
+global deployment manifest.
+
+args: [-at <revision>] [-gdm]
+`
+
+func (*SousStateShow) Help() string { return sousStateShowHelp }
+
+func (ss *SousStateShow) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&ss.flags.at, "at", "HEAD", "the `revision` or time to show")
+	fs.BoolVar(&ss.flags.gdm, "gdm", false, "output only the global deployment manifest")
+}
+
+func (ss *SousStateShow) Execute(args []string) cmdr.Result {
+	if len(args) != 0 {
+		return UsageErrorf("usage: sous state show [-at revision] [-gdm]")
+	}
+	rev, err := resolveRevision(ss.StateRepo, ss.flags.at)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	state, err := ss.StateRepo.StateAt(rev)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	var v interface{} = state
+	if ss.flags.gdm {
+		v = state.GDM
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return EnsureErrorResult(err)
+	}
+	return SuccessData(b)
+}
@@ -4,6 +4,8 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+
+	"github.com/opentable/sous/util/configloader"
 )
 
 type (
@@ -20,3 +22,10 @@ func (u *User) ConfigDir() string {
 	}
 	return filepath.Join(u.HomeDir, DefaultConfigDir)
 }
+
+// ConfigFile is the path of the user's sous configuration file. It is
+// config.json in ConfigDir, unless config.yaml, config.yml or config.toml
+// exists there instead.
+func (u *User) ConfigFile() string {
+	return configloader.FindFile(filepath.Join(u.ConfigDir(), "config"))
+}
@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// CopyArgs are the arguments of ADD and COPY instructions.
+	CopyArgs struct {
+		// From is the build stage (name or index) or image to copy from, as
+		// in COPY --from=build. It is only valid for COPY.
+		From string
+		// Chown sets the owner of the copied files, as in --chown=user:group.
+		Chown string
+		// Sources are the paths to copy.
+		Sources []string
+		// Dest is the path they are copied to.
+		Dest string
+	}
+	// Port is a port exposed by the container.
+	Port struct {
+		// Number is the port number.
+		Number int
+		// Protocol is either "tcp" or "udp", if it is empty docker assumes
+		// "tcp".
+		Protocol string
+	}
+	// Ports are the arguments of an EXPOSE instruction.
+	Ports []Port
+	// BuildArg is the argument of an ARG instruction.
+	BuildArg struct {
+		// Name is the name of the build argument.
+		Name string
+		// Default is its value if it is not passed to docker build, it may
+		// be empty.
+		Default string
+	}
+	// Signal is the argument of a STOPSIGNAL instruction, either a signal
+	// name, e.g. SIGTERM, or number.
+	Signal string
+	// HealthCheck is the argument of a HEALTHCHECK instruction.
+	HealthCheck struct {
+		// Interval, Timeout and StartPeriod are passed as options if they
+		// are not zero.
+		Interval, Timeout, StartPeriod time.Duration
+		// Retries is passed as an option if it is not zero.
+		Retries int
+		// Cmd is the command which checks the container's health, either
+		// ArrayArgs or, for the shell form, SingleArg. If Cmd is nil, the
+		// instruction is HEALTHCHECK NONE, disabling any health check in the
+		// base image.
+		Cmd Args
+	}
+	// OnBuild is the argument of an ONBUILD instruction, which is itself an
+	// instruction to run when the image is used as a base image.
+	OnBuild struct {
+		Instruction Instruction
+	}
+)
+
+var (
+	buildArgName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	signal       = regexp.MustCompile(`^(SIG[A-Z0-9]+|[0-9]+)$`)
+)
+
+func (c CopyArgs) String() string {
+	flags := ""
+	if c.From != "" {
+		flags += fmt.Sprintf("--from=%s ", c.From)
+	}
+	if c.Chown != "" {
+		flags += fmt.Sprintf("--chown=%s ", c.Chown)
+	}
+	paths := append(append([]string{}, c.Sources...), c.Dest)
+	return flags + ArrayArgs(paths).String()
+}
+
+// Validate returns an error unless there is at least one source and a dest.
+func (c CopyArgs) Validate() error {
+	if len(c.Sources) == 0 || c.Dest == "" {
+		return fmt.Errorf("requires at least one source and a destination")
+	}
+	if len(c.Sources) > 1 && !strings.HasSuffix(c.Dest, "/") {
+		return fmt.Errorf("destination %q must end with / when copying multiple sources", c.Dest)
+	}
+	return nil
+}
+
+func (p Port) String() string {
+	if p.Protocol == "" {
+		return strconv.Itoa(p.Number)
+	}
+	return fmt.Sprintf("%d/%s", p.Number, p.Protocol)
+}
+
+// Validate returns an error unless p has a valid number and protocol.
+func (p Port) Validate() error {
+	if p.Number < 1 || p.Number > 65535 {
+		return fmt.Errorf("invalid port number %d", p.Number)
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" && p.Protocol != "udp" {
+		return fmt.Errorf("invalid protocol %q for port %d", p.Protocol, p.Number)
+	}
+	return nil
+}
+
+func (ps Ports) String() string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = p.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// Validate returns an error if there are no ports, or any port is invalid.
+func (ps Ports) Validate() error {
+	if len(ps) == 0 {
+		return fmt.Errorf("no ports")
+	}
+	for _, p := range ps {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a BuildArg) String() string {
+	if a.Default == "" {
+		return a.Name
+	}
+	return fmt.Sprintf("%s=%s", a.Name, a.Default)
+}
+
+// Validate returns an error if a's name is not a valid variable name.
+func (a BuildArg) Validate() error {
+	if !buildArgName.MatchString(a.Name) {
+		return fmt.Errorf("invalid name %q", a.Name)
+	}
+	return nil
+}
+
+func (s Signal) String() string {
+	return string(s)
+}
+
+// Validate returns an error unless s is a signal name or number, or a variable
+// which may expand to one.
+func (s Signal) Validate() error {
+	if !signal.MatchString(string(s)) && !strings.Contains(string(s), "$") {
+		return fmt.Errorf("invalid signal %q", s)
+	}
+	return nil
+}
+
+func (h HealthCheck) String() string {
+	if h.Cmd == nil {
+		return "NONE"
+	}
+	options := ""
+	for _, o := range []struct {
+		name  string
+		value time.Duration
+	}{{"interval", h.Interval}, {"timeout", h.Timeout}, {"start-period", h.StartPeriod}} {
+		if o.value != 0 {
+			options += fmt.Sprintf("--%s=%s ", o.name, o.value)
+		}
+	}
+	if h.Retries != 0 {
+		options += fmt.Sprintf("--retries=%d ", h.Retries)
+	}
+	return fmt.Sprintf("%sCMD %s", options, h.Cmd)
+}
+
+// Validate returns an error if any option is negative, or if options are set
+// without a command.
+func (h HealthCheck) Validate() error {
+	if h.Interval < 0 || h.Timeout < 0 || h.StartPeriod < 0 || h.Retries < 0 {
+		return fmt.Errorf("options must not be negative")
+	}
+	if h.Cmd == nil {
+		if h.Interval != 0 || h.Timeout != 0 || h.StartPeriod != 0 || h.Retries != 0 {
+			return fmt.Errorf("options are not allowed with NONE")
+		}
+		return nil
+	}
+	if h.Cmd.String() == "" || h.Cmd.String() == "[]" {
+		return fmt.Errorf("CMD requires a command")
+	}
+	return nil
+}
+
+func (o OnBuild) String() string {
+	return o.Instruction.String()
+}
+
+// Validate returns an error if the triggered instruction is invalid, or may not
+// be triggered.
+func (o OnBuild) Validate() error {
+	switch o.Instruction.Name {
+	case "ONBUILD", "FROM", "MAINTAINER":
+		return fmt.Errorf("%s may not be triggered by ONBUILD", o.Instruction.Name)
+	}
+	return o.Instruction.Validate()
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/opentable/sous/util/shell"
+	"github.com/samsalisbury/semv"
+)
+
+// Client is a docker client that shells out to the locally installed docker
+// binary. All commands are issued using its *shell.Sh, so that they are logged
+// and can be replayed by the user.
+type Client struct {
+	// Sh is the *shell.Sh instance this client uses for all shell interaction.
+	Sh *shell.Sh
+	// Bin is the path to the docker binary. This defaults to "docker",
+	// therefore relying that docker is in the path.
+	Bin string
+	// Version is the version of docker at Bin.
+	Version semv.Version
+}
+
+// NewClient returns a docker client, as long as `docker --version` succeeds.
+// The *shell.Sh is used for all commands.
+func NewClient(sh *shell.Sh) (*Client, error) {
+	bin := "docker"
+	s, err := sh.Cmd(bin, "--version").Stdout()
+	if err != nil {
+		return nil, err
+	}
+	v, err := semv.ParseAny(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{sh, bin, v}, nil
+}
+
+// Build builds the Dockerfile in contextDir, tagging the resultant image with
+// tag. contextDir may be relative to the client's working directory.
+func (c *Client) Build(contextDir, tag string) error {
+	return c.Sh.Cmd(c.Bin, "build", "-t", tag, contextDir).Succeed()
+}
+
+// Run runs image in a new container called name, waiting for it to complete.
+// The container is not removed afterwards, so that files can be copied out of
+// it, you should call Remove when you are done with it.
+func (c *Client) Run(name, image string, args ...string) error {
+	cmd := []interface{}{"run", "--name", name, image}
+	for _, a := range args {
+		cmd = append(cmd, a)
+	}
+	return c.Sh.Cmd(c.Bin, cmd...).Succeed()
+}
+
+// Start runs image in a new, detached container called name, with env set,
+// and each of ports published on the same port of the docker host. It returns
+// once the container has started, you should call Remove when you are done
+// with it.
+func (c *Client) Start(name, image string, env map[string]string, ports ...int) error {
+	cmd := []interface{}{"run", "-d", "--name", name}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd = append(cmd, "-e", k+"="+env[k])
+	}
+	for _, p := range ports {
+		cmd = append(cmd, "-p", fmt.Sprintf("%d:%d", p, p))
+	}
+	cmd = append(cmd, image)
+	return c.Sh.Cmd(c.Bin, cmd...).Succeed()
+}
+
+// Stop sends SIGTERM to container, followed by SIGKILL if it has not exited
+// after timeout, and returns its exit code.
+func (c *Client) Stop(container string, timeout time.Duration) (int, error) {
+	secs := strconv.Itoa(int(timeout.Seconds()))
+	if err := c.Sh.Cmd(c.Bin, "stop", "-t", secs, container).Succeed(); err != nil {
+		return -1, err
+	}
+	s, err := c.Sh.Stdout(c.Bin, "inspect", "-f", "{{.State.ExitCode}}", container)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(s)
+}
+
+// Logs returns what container has written to stdout and stderr.
+func (c *Client) Logs(container string) (stdout, stderr string, err error) {
+	r, err := c.Sh.Cmd(c.Bin, "logs", container).SucceedResult()
+	if err != nil {
+		return "", "", err
+	}
+	return r.Stdout.String(), r.Stderr.String(), nil
+}
+
+// CopyFrom copies srcPath from inside container to destPath on the host.
+func (c *Client) CopyFrom(container, srcPath, destPath string) error {
+	src := fmt.Sprintf("%s:%s", container, srcPath)
+	return c.Sh.Cmd(c.Bin, "cp", src, destPath).Succeed()
+}
+
+// Remove forcibly removes a container.
+func (c *Client) Remove(container string) error {
+	return c.Sh.Cmd(c.Bin, "rm", "-f", container).Succeed()
+}
+
+// ImageExists returns true if image exists locally.
+func (c *Client) ImageExists(image string) bool {
+	code, err := c.Sh.ExitCode(c.Bin, "inspect", "--type=image", image)
+	return err == nil && code == 0
+}
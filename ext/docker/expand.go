@@ -0,0 +1,241 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// substitutedInstructions are the instructions whose arguments docker expands
+// variables in. Other instructions, e.g. RUN, leave that to the shell.
+var substitutedInstructions = map[string]bool{
+	"ADD": true, "COPY": true, "ENV": true, "EXPOSE": true, "FROM": true,
+	"LABEL": true, "STOPSIGNAL": true, "USER": true, "VOLUME": true,
+	"WORKDIR": true,
+}
+
+// Expand returns a copy of f with ARG and ENV variables substituted, as docker
+// does when building it. $NAME, ${NAME}, ${NAME:-default} and ${NAME:+alt}
+// are supported, and \$ escapes a dollar sign.
+//
+// buildArgs are the values of build arguments, as passed to docker build
+// --build-arg. Arguments missing from buildArgs take their default values from
+// their ARG instruction. As with docker, arguments declared in the Prelude are
+// only visible to FROM instructions, or to ARG instructions redeclaring them
+// without a default.
+func (f File) Expand(buildArgs map[string]string) (File, error) {
+	global := map[string]string{}
+	prelude, err := expandInstructions(f.Prelude, buildArgs, nil, global)
+	if err != nil {
+		return File{}, err
+	}
+	from, err := expandVars(f.From, global)
+	if err != nil {
+		return File{}, err
+	}
+	instructions, err := expandInstructions(f.Instructions, buildArgs, global, map[string]string{})
+	if err != nil {
+		return File{}, err
+	}
+	f.Prelude, f.From, f.Instructions = prelude, from, instructions
+	return f, nil
+}
+
+// expandInstructions expands variables in each instruction in is, updating
+// vars with each ARG and ENV instruction encountered. Each FROM instruction
+// starts a new stage, resetting vars.
+func expandInstructions(is Instructions, buildArgs, global, vars map[string]string) (Instructions, error) {
+	out := make(Instructions, 0, len(is))
+	for _, i := range is {
+		var err error
+		switch i.Name {
+		case "ARG":
+			i.Args, err = expandArg(i.Args, buildArgs, global, vars)
+		case "FROM":
+			i.Args, err = expandArgs(i.Args, global)
+			vars = map[string]string{}
+		case "ENV":
+			if i.Args, err = expandArgs(i.Args, vars); err == nil {
+				for _, kv := range keyValues(i.Args) {
+					vars[kv.Key] = kv.Value
+				}
+			}
+		default:
+			if substitutedInstructions[i.Name] {
+				i.Args, err = expandArgs(i.Args, vars)
+			}
+			// EXPOSE arguments containing variables are parsed once
+			// expanded, see parsePorts.
+			if s, ok := i.Args.(SingleArg); ok && i.Name == "EXPOSE" && err == nil {
+				i.Args, err = parseArgs(i.Name, string(s), '\\')
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", i.Name, err)
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// expandArg handles an ARG instruction, setting its value in vars. The value
+// comes from buildArgs if present, then from the default, then from global.
+func expandArg(args Args, buildArgs, global, vars map[string]string) (Args, error) {
+	a, ok := args.(BuildArg)
+	if !ok {
+		return nil, fmt.Errorf("unexpected arguments %q", args)
+	}
+	if a.Default != "" {
+		var err error
+		if a.Default, err = expandVars(a.Default, vars); err != nil {
+			return nil, err
+		}
+		vars[a.Name] = a.Default
+	} else if v, ok := global[a.Name]; ok {
+		vars[a.Name] = v
+	}
+	if v, ok := buildArgs[a.Name]; ok {
+		vars[a.Name] = v
+	}
+	return a, nil
+}
+
+// expandArgs returns a copy of args with variables expanded. Args of types
+// defined outside this package are returned unchanged.
+func expandArgs(args Args, vars map[string]string) (Args, error) {
+	var err error
+	expand := func(s string) string {
+		if err != nil {
+			return s
+		}
+		var e string
+		e, err = expandVars(s, vars)
+		return e
+	}
+	expandAll := func(ss []string) []string {
+		out := make([]string, len(ss))
+		for i, s := range ss {
+			out[i] = expand(s)
+		}
+		return out
+	}
+	switch a := args.(type) {
+	case SingleArg:
+		args = SingleArg(expand(string(a)))
+	case Signal:
+		args = Signal(expand(string(a)))
+	case CopyArgs:
+		args = CopyArgs{
+			From:    expand(a.From),
+			Chown:   expand(a.Chown),
+			Sources: expandAll(a.Sources),
+			Dest:    expand(a.Dest),
+		}
+	case SpaceSeparatedArgs:
+		args = SpaceSeparatedArgs(expandAll(a))
+	case ArrayArgs:
+		args = ArrayArgs(expandAll(a))
+	case FromArgs:
+		args = FromArgs{Image: expand(a.Image), Stage: a.Stage}
+	case KeyValuePairs:
+		out := make(KeyValuePairs, len(a))
+		for i, kv := range a {
+			out[i] = KeyValue{expand(kv.Key), expand(kv.Value)}
+		}
+		args = out
+	case KeyValueArgs:
+		out := make(KeyValueArgs, len(a))
+		for k, v := range a {
+			out[expand(k)] = expand(v)
+		}
+		args = out
+	}
+	return args, err
+}
+
+// keyValues returns the key/value pairs in args, if it has any.
+func keyValues(args Args) KeyValuePairs {
+	switch a := args.(type) {
+	case KeyValuePairs:
+		return a
+	case KeyValueArgs:
+		out := KeyValuePairs{}
+		for k, v := range a {
+			out = append(out, KeyValue{k, v})
+		}
+		return out
+	}
+	return nil
+}
+
+// expandVars substitutes the variables in s with their values from vars.
+// Undefined variables are replaced with the empty string.
+func expandVars(s string, vars map[string]string) (string, error) {
+	b := &bytes.Buffer{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '$':
+			b.WriteByte('$')
+			i++
+		case c != '$':
+			b.WriteByte(c)
+		case i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("missing '}' in %q", s)
+			}
+			v, err := expandBraced(s[i+2:i+2+end], vars)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i += end + 2
+		default:
+			n := variableNameLength(s[i+1:])
+			if n == 0 {
+				b.WriteByte('$')
+				continue
+			}
+			b.WriteString(vars[s[i+1:i+1+n]])
+			i += n
+		}
+	}
+	return b.String(), nil
+}
+
+// expandBraced expands the contents of ${...}.
+func expandBraced(expr string, vars map[string]string) (string, error) {
+	i := strings.IndexByte(expr, ':')
+	if i < 0 {
+		return vars[expr], nil
+	}
+	if i+1 == len(expr) {
+		return "", fmt.Errorf("bad substitution ${%s}", expr)
+	}
+	name, op, word := expr[:i], expr[i+1], expr[i+2:]
+	v := vars[name]
+	switch op {
+	case '-':
+		if v == "" {
+			return expandVars(word, vars)
+		}
+		return v, nil
+	case '+':
+		if v != "" {
+			return expandVars(word, vars)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported modifier %q in ${%s}", op, expr)
+}
+
+// variableNameLength returns the length of the variable name at the start of s.
+func variableNameLength(s string) int {
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -4,25 +4,49 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 type File struct {
 	From, Maintainer string
 	Instructions     Instructions
+	// Stage is the name of the first build stage, as in "FROM image AS stage".
+	// It may be empty.
+	Stage string
+	// Prelude contains any ARG instructions preceding the first FROM. They
+	// may only be used to parameterise FROM instructions.
+	Prelude Instructions
+	// Escape is the escape character set by an escape parser directive,
+	// either a backslash or a backtick. It is empty if there is no directive,
+	// in which case the escape character is a backslash.
+	Escape string
 }
 
 func (f File) String() string {
-	return fmt.Sprintf("FROM %s\nMAINTAINER %s\n%s",
-		f.From, f.Maintainer, f.Instructions)
+	s, escape := "", `\`
+	if f.Escape != "" {
+		s, escape = fmt.Sprintf("# escape=%s\n", f.Escape), f.Escape
+	}
+	s += fmt.Sprintf("%sFROM %s\n", f.Prelude.escaped(escape), FromArgs{f.From, f.Stage})
+	if f.Maintainer != "" {
+		s += fmt.Sprintf("MAINTAINER %s\n", f.Maintainer)
+	}
+	return s + f.Instructions.escaped(escape)
 }
 
 type Instructions []Instruction
 
 func (is Instructions) String() string {
+	return is.escaped(`\`)
+}
+
+// escaped returns is as a Dockerfile whose escape character is escape.
+func (is Instructions) escaped(escape string) string {
 	b := &bytes.Buffer{}
 	for _, i := range is {
-		fmt.Fprintf(b, "%s\n", i)
+		fmt.Fprintf(b, "%s\n", i.escaped(escape))
 	}
 	return b.String()
 }
@@ -44,12 +68,39 @@ type Args interface {
 	String() string
 }
 
+// multilineArgs are Args written over several lines, each but the last ending
+// with the Dockerfile's escape character.
+type multilineArgs interface {
+	Args
+	escaped(escape string) string
+}
+
+// escaped returns i as written in a Dockerfile whose escape character is
+// escape.
+func (i Instruction) escaped(escape string) string {
+	if a, ok := i.Args.(multilineArgs); ok {
+		return fmt.Sprintf("%s %s", i.Name, a.escaped(escape))
+	}
+	return i.String()
+}
+
+// FROM starts a new build stage based on image. The stage may be named, so
+// that later stages can copy files from it using COPYFrom.
+func (f *File) FROM(image, stage string) {
+	f.Instructions.Add("FROM", FromArgs{image, stage})
+}
+
 func (f *File) ADD(target string, files ...string) {
-	f.Instructions.Add("ADD", ArrayArgs(append(files, target)))
+	f.Instructions.Add("ADD", CopyArgs{Sources: files, Dest: target})
 }
 
 func (f *File) COPY(target string, files ...string) {
-	f.Instructions.Add("COPY", ArrayArgs(append(files, target)))
+	f.Instructions.Add("COPY", CopyArgs{Sources: files, Dest: target})
+}
+
+// COPYFrom copies files from an earlier build stage, or another image.
+func (f *File) COPYFrom(from, target string, files ...string) {
+	f.Instructions.Add("COPY", CopyArgs{From: from, Sources: files, Dest: target})
 }
 
 func (f *File) RUN(args ...string) {
@@ -80,6 +131,34 @@ func (f *File) USER(username string) {
 	f.Instructions.Add("USER", SingleArg(username))
 }
 
+func (f *File) EXPOSE(ports ...Port) {
+	f.Instructions.Add("EXPOSE", Ports(ports))
+}
+
+func (f *File) VOLUME(paths ...string) {
+	f.Instructions.Add("VOLUME", ArrayArgs(paths))
+}
+
+func (f *File) ARG(name, defaultValue string) {
+	f.Instructions.Add("ARG", BuildArg{name, defaultValue})
+}
+
+func (f *File) ONBUILD(name string, args Args) {
+	f.Instructions.Add("ONBUILD", OnBuild{Instruction{name, args}})
+}
+
+func (f *File) STOPSIGNAL(signal string) {
+	f.Instructions.Add("STOPSIGNAL", Signal(signal))
+}
+
+func (f *File) HEALTHCHECK(h HealthCheck) {
+	f.Instructions.Add("HEALTHCHECK", h)
+}
+
+func (f *File) SHELL(args ...string) {
+	f.Instructions.Add("SHELL", ArrayArgs(args))
+}
+
 type SingleArg string
 
 func (s SingleArg) String() string {
@@ -89,23 +168,64 @@ func (s SingleArg) String() string {
 type KeyValueArgs map[string]string
 
 func (kv KeyValueArgs) String() string {
-	items := kv.Flatten()
-	return lines(items)
+	return kv.escaped(`\`)
+}
+
+func (kv KeyValueArgs) escaped(escape string) string {
+	return lines(kv.flatten(escape), escape)
 }
 
+// Flatten returns each key=value pair, sorted by key.
 func (kv KeyValueArgs) Flatten() []string {
-	out := make([]string, len(kv))
-	for k, v := range kv {
-		out = append(out, fmt.Sprintf("%s=%s", quote(k), quote(v)))
+	return kv.flatten(`\`)
+}
+
+// flatten returns each key=value pair, sorted by key, quoted for a Dockerfile
+// whose escape character is escape.
+func (kv KeyValueArgs) flatten(escape string) []string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(kv))
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s=%s", quote(k, escape), quote(kv[k], escape)))
 	}
 	return out
 }
 
-func quote(s string) string {
-	if !strings.ContainsAny(s, `' "`) {
+// KeyValuePairs are key/value arguments which keep their order, as parsed from
+// ENV and LABEL instructions.
+type KeyValuePairs []KeyValue
+
+// KeyValue is a single key/value argument.
+type KeyValue struct {
+	Key, Value string
+}
+
+func (kv KeyValuePairs) String() string {
+	return kv.escaped(`\`)
+}
+
+func (kv KeyValuePairs) escaped(escape string) string {
+	items := make([]string, len(kv))
+	for i, p := range kv {
+		items[i] = fmt.Sprintf("%s=%s", quote(p.Key, escape), quote(p.Value, escape))
+	}
+	return lines(items, escape)
+}
+
+// quote returns s as a single word of a Dockerfile whose escape character is
+// escape, in double quotes if it contains whitespace, quotes or escape. Within
+// them, double quotes and escape are escaped, other characters are written as
+// they are.
+func quote(s, escape string) string {
+	if !strings.ContainsAny(s, `'"`+escape) && strings.IndexFunc(s, unicode.IsSpace) < 0 {
 		return s
 	}
-	return fmt.Sprintf("%q", s)
+	r := strings.NewReplacer(escape, escape+escape, `"`, escape+`"`)
+	return `"` + r.Replace(s) + `"`
 }
 
 type ArrayArgs []string
@@ -124,9 +244,11 @@ func (s SpaceSeparatedArgs) String() string {
 	return strings.Join(s, " ")
 }
 
-func lines(s []string) string {
+// lines writes each of s on a new line, continuing the previous one with
+// escape.
+func lines(s []string, escape string) string {
 	out := &bytes.Buffer{}
-	lineStart := " \\\n\t"
+	lineStart := " " + escape + "\n\t"
 	for _, line := range s {
 		out.WriteString(lineStart + line)
 	}
@@ -134,3 +256,18 @@ func lines(s []string) string {
 }
 
 type ArrayArg []string
+
+// FromArgs are the arguments of a FROM instruction.
+type FromArgs struct {
+	// Image is the base image of the stage.
+	Image string
+	// Stage is the name of the stage, it may be empty.
+	Stage string
+}
+
+func (f FromArgs) String() string {
+	if f.Stage == "" {
+		return f.Image
+	}
+	return fmt.Sprintf("%s AS %s", f.Image, f.Stage)
+}
@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type (
+	// Inspection is the subset of the output of docker inspect that Sous
+	// understands, for a single image or container.
+	Inspection struct {
+		ID       string `json:"Id"`
+		RepoTags []string
+		Config   struct {
+			Labels map[string]string
+		}
+	}
+)
+
+// ParseInspect parses the JSON output of docker inspect, which is an array
+// containing one object per image or container inspected.
+func ParseInspect(r io.Reader) ([]Inspection, error) {
+	var is []Inspection
+	if err := json.NewDecoder(r).Decode(&is); err != nil {
+		return nil, fmt.Errorf("parsing docker inspect output: %s", err)
+	}
+	return is, nil
+}
+
+// InspectImage inspects a single image.
+func (c *Client) InspectImage(image string) (*Inspection, error) {
+	r, err := c.Sh.Cmd(c.Bin, "inspect", "--type=image", image).SucceedResult()
+	if err != nil {
+		return nil, err
+	}
+	is, err := ParseInspect(r.Stdout.Reader())
+	if err != nil {
+		return nil, err
+	}
+	if len(is) != 1 {
+		return nil, fmt.Errorf("docker inspect %s returned %d results; want 1",
+			image, len(is))
+	}
+	return &is[0], nil
+}
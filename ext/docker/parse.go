@@ -0,0 +1,419 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type (
+	// ParseError is returned when a Dockerfile cannot be parsed.
+	ParseError struct {
+		// Line is the line number where the offending instruction starts.
+		Line int
+		// Message describes the problem.
+		Message string
+	}
+	// logicalLine is a single instruction, with its line continuations
+	// joined, and any comments removed.
+	logicalLine struct {
+		number int
+		text   string
+	}
+)
+
+func (err ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.Line, err.Message)
+}
+
+// directive matches parser directives, e.g. "# escape=`", which may only
+// appear at the very top of a Dockerfile.
+var directive = regexp.MustCompile(`^#\s*([a-zA-Z]+)\s*=\s*(\S*)\s*$`)
+
+// ParseFile parses a Dockerfile.
+//
+// The first FROM instruction, and a MAINTAINER immediately following it,
+// populate From, Stage and Maintainer. An escape parser directive sets Escape. Any ARG instructions before it are added
+// to Prelude. All other instructions, including the FROM instructions of
+// subsequent stages, are added to Instructions in order.
+//
+// Arguments are not expanded, see File.Expand. Parsing the output of String
+// results in an identical File.
+func ParseFile(r io.Reader) (*File, error) {
+	lines, escape, err := logicalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Escape: escape}
+	esc := escapeRune(escape)
+	seenFrom := false
+	for _, l := range lines {
+		name, rest := splitFirstWord(l.text)
+		name = strings.ToUpper(name)
+		if rest == "" {
+			return nil, ParseError{l.number, fmt.Sprintf("%s requires arguments", name)}
+		}
+		args, err := parseArgs(name, rest, esc)
+		if err != nil {
+			return nil, ParseError{l.number, err.Error()}
+		}
+		switch {
+		case !seenFrom && name == "ARG":
+			f.Prelude.Add(name, args)
+		case !seenFrom && name == "FROM":
+			from := args.(FromArgs)
+			f.From, f.Stage = from.Image, from.Stage
+			seenFrom = true
+		case !seenFrom:
+			return nil, ParseError{l.number, fmt.Sprintf("%s before FROM", name)}
+		case name == "MAINTAINER" && f.Maintainer == "" && len(f.Instructions) == 0:
+			f.Maintainer = rest
+		default:
+			f.Instructions.Add(name, args)
+		}
+	}
+	if !seenFrom {
+		return nil, fmt.Errorf("no FROM instruction")
+	}
+	return f, nil
+}
+
+// parseArgs parses the arguments of a single instruction, in a Dockerfile
+// whose escape character is escape.
+func parseArgs(name, rest string, escape rune) (Args, error) {
+	switch name {
+	case "FROM":
+		return parseFromArgs(rest)
+	case "ENV", "LABEL":
+		return parseKeyValuePairs(name, rest, escape)
+	case "RUN", "CMD", "ENTRYPOINT":
+		if a, ok := parseArrayArgs(rest); ok {
+			return a, nil
+		}
+	case "SHELL":
+		if a, ok := parseArrayArgs(rest); ok {
+			return a, nil
+		}
+		return nil, fmt.Errorf("SHELL requires the JSON form")
+	case "VOLUME":
+		if a, ok := parseArrayArgs(rest); ok {
+			return a, nil
+		}
+		return ArrayArgs(strings.Fields(rest)), nil
+	case "ADD", "COPY":
+		return parseCopyArgs(name, rest)
+	case "EXPOSE":
+		return parsePorts(rest)
+	case "ARG":
+		kv := strings.SplitN(rest, "=", 2)
+		a := BuildArg{Name: kv[0]}
+		if len(kv) == 2 {
+			a.Default = kv[1]
+		}
+		return a, nil
+	case "STOPSIGNAL":
+		return Signal(rest), nil
+	case "HEALTHCHECK":
+		return parseHealthCheck(rest)
+	case "ONBUILD":
+		name, rest := splitFirstWord(rest)
+		name = strings.ToUpper(name)
+		args, err := parseArgs(name, rest, escape)
+		if err != nil {
+			return nil, err
+		}
+		return OnBuild{Instruction{name, args}}, nil
+	}
+	return SingleArg(rest), nil
+}
+
+// parseFlags removes leading --name=value flags from s, returning them in a
+// map, and the remainder of s. Only flags in allowed are accepted.
+func parseFlags(name, s string, allowed ...string) (map[string]string, string, error) {
+	flags := map[string]string{}
+	for strings.HasPrefix(s, "--") {
+		var flag string
+		flag, s = splitFirstWord(s)
+		kv := strings.SplitN(strings.TrimPrefix(flag, "--"), "=", 2)
+		if len(kv) != 2 || indexOf(allowed, kv[0]) == -1 {
+			return nil, "", fmt.Errorf("%s does not support flag %s", name, flag)
+		}
+		flags[kv[0]] = kv[1]
+	}
+	return flags, s, nil
+}
+
+// parseCopyArgs parses the arguments of ADD and COPY, in either form.
+func parseCopyArgs(name, s string) (CopyArgs, error) {
+	allowed := []string{"chown"}
+	if name == "COPY" {
+		allowed = append(allowed, "from")
+	}
+	flags, s, err := parseFlags(name, s, allowed...)
+	if err != nil {
+		return CopyArgs{}, err
+	}
+	paths, ok := parseArrayArgs(s)
+	if !ok {
+		paths = strings.Fields(s)
+	}
+	if len(paths) < 2 {
+		return CopyArgs{}, fmt.Errorf("%s requires at least two arguments", name)
+	}
+	last := len(paths) - 1
+	return CopyArgs{
+		From:    flags["from"],
+		Chown:   flags["chown"],
+		Sources: paths[:last],
+		Dest:    paths[last],
+	}, nil
+}
+
+// parsePorts parses the arguments of EXPOSE, e.g. "80 53/udp". If they contain
+// variables, they are returned as SingleArg, to be parsed after expansion.
+func parsePorts(s string) (Args, error) {
+	if strings.Contains(s, "$") {
+		return SingleArg(s), nil
+	}
+	var ports Ports
+	for _, f := range strings.Fields(s) {
+		numProto := strings.SplitN(f, "/", 2)
+		n, err := strconv.Atoi(numProto[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", f)
+		}
+		p := Port{Number: n}
+		if len(numProto) == 2 {
+			p.Protocol = strings.ToLower(numProto[1])
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// parseHealthCheck parses the arguments of HEALTHCHECK, which are either NONE,
+// or options followed by CMD and a command in either form.
+func parseHealthCheck(s string) (HealthCheck, error) {
+	h := HealthCheck{}
+	flags, s, err := parseFlags("HEALTHCHECK", s, "interval", "timeout", "start-period", "retries")
+	if err != nil {
+		return h, err
+	}
+	for _, d := range []struct {
+		name  string
+		value *time.Duration
+	}{{"interval", &h.Interval}, {"timeout", &h.Timeout}, {"start-period", &h.StartPeriod}} {
+		if v, ok := flags[d.name]; ok {
+			if *d.value, err = time.ParseDuration(v); err != nil {
+				return h, fmt.Errorf("HEALTHCHECK --%s: %s", d.name, err)
+			}
+		}
+	}
+	if v, ok := flags["retries"]; ok {
+		if h.Retries, err = strconv.Atoi(v); err != nil {
+			return h, fmt.Errorf("HEALTHCHECK --retries: %s", err)
+		}
+	}
+	kind, cmd := splitFirstWord(s)
+	switch strings.ToUpper(kind) {
+	case "NONE":
+		if cmd != "" || len(flags) != 0 {
+			return h, fmt.Errorf("HEALTHCHECK NONE takes no other arguments")
+		}
+	case "CMD":
+		if cmd == "" {
+			return h, fmt.Errorf("HEALTHCHECK CMD requires a command")
+		}
+		if a, ok := parseArrayArgs(cmd); ok {
+			h.Cmd = a
+		} else {
+			h.Cmd = SingleArg(cmd)
+		}
+	default:
+		return h, fmt.Errorf("HEALTHCHECK requires either NONE or CMD")
+	}
+	return h, nil
+}
+
+// parseFromArgs parses "image" or "image AS stage".
+func parseFromArgs(s string) (FromArgs, error) {
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1:
+		return FromArgs{Image: fields[0]}, nil
+	case len(fields) == 3 && strings.EqualFold(fields[1], "AS"):
+		return FromArgs{Image: fields[0], Stage: fields[2]}, nil
+	}
+	return FromArgs{}, fmt.Errorf("FROM requires either one or three arguments")
+}
+
+// parseArrayArgs parses the JSON (exec) form of arguments, e.g.
+// ["npm", "start"]. It returns false if s is not in that form.
+func parseArrayArgs(s string) (ArrayArgs, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return nil, false
+	}
+	var a []string
+	if err := json.Unmarshal([]byte(s), &a); err != nil {
+		return nil, false
+	}
+	return ArrayArgs(a), true
+}
+
+// parseKeyValuePairs parses the arguments of ENV and LABEL, which are either
+// a list of key=value pairs, or a single key followed by a value.
+func parseKeyValuePairs(name, s string, escape rune) (KeyValuePairs, error) {
+	words, err := splitWords(s, escape)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(words[0], "=") {
+		key, value := splitFirstWord(s)
+		if value == "" {
+			return nil, fmt.Errorf("%s must have two arguments", name)
+		}
+		return KeyValuePairs{{key, value}}, nil
+	}
+	pairs := make(KeyValuePairs, len(words))
+	for i, w := range words {
+		kv := strings.SplitN(w, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%s: expected key=value, got %q", name, w)
+		}
+		pairs[i] = KeyValue{kv[0], kv[1]}
+	}
+	return pairs, nil
+}
+
+// splitFirstWord splits s at the first whitespace, trimming the remainder.
+func splitFirstWord(s string) (string, string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// splitWords splits s on whitespace, removing quotes and escapes, as docker
+// does. Outside quotes, escape makes the character following it literal.
+// Within double quotes, it only does so for a double quote, a dollar sign or
+// another escape, and is otherwise kept. Single quotes allow no escapes.
+func splitWords(s string, escape rune) ([]string, error) {
+	var (
+		words   []string
+		word    = &bytes.Buffer{}
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '$' && c != escape {
+				word.WriteRune(escape)
+			}
+			word.WriteRune(c)
+			escaped = false
+		case c == escape && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unmatched %c", quote)
+	}
+	if escaped {
+		word.WriteRune(escape)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// escapeRune returns the escape character set by an escape directive, or a
+// backslash if there is none.
+func escapeRune(escape string) rune {
+	if escape == "" {
+		return '\\'
+	}
+	return []rune(escape)[0]
+}
+
+// logicalLines reads a Dockerfile, returning one logicalLine per instruction.
+// Lines ending with the escape character (a backslash, unless changed by an
+// escape directive) are joined with the line following. Comments and empty
+// lines are removed, including those between continued lines. It also returns
+// the escape character set by the escape directive, if there is one.
+func logicalLines(r io.Reader) ([]logicalLine, string, error) {
+	var (
+		lines       []logicalLine
+		current     = &bytes.Buffer{}
+		start       int
+		directed    string
+		escape      = `\`
+		directives  = true
+		inContinued bool
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if directives {
+			if m := directive.FindStringSubmatch(trimmed); m != nil {
+				if strings.ToLower(m[1]) == "escape" {
+					if m[2] != `\` && m[2] != "`" {
+						return nil, "", ParseError{n, fmt.Sprintf("invalid escape character %q", m[2])}
+					}
+					escape, directed = m[2], m[2]
+				}
+				continue
+			}
+			directives = false
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !inContinued {
+			start = n
+		}
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.HasSuffix(line, escape) {
+			current.WriteString(strings.TrimSuffix(line, escape))
+			inContinued = true
+			continue
+		}
+		current.WriteString(line)
+		lines = append(lines, logicalLine{start, strings.TrimSpace(current.String())})
+		current.Reset()
+		inContinued = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if inContinued {
+		lines = append(lines, logicalLine{start, strings.TrimSpace(current.String())})
+	}
+	return lines, directed, nil
+}
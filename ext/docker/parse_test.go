@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// TestParseFile_Golden parses each Dockerfile in testdata/parse, and compares
+// the result of String with the corresponding .golden file. It also checks
+// that parsing the golden file again produces the same output.
+func TestParseFile_Golden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/parse/*.Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test Dockerfiles found")
+	}
+	for _, input := range inputs {
+		f := parseFile(t, input)
+		if f == nil {
+			continue
+		}
+		actual := f.String()
+		golden := strings.TrimSuffix(input, ".Dockerfile") + ".golden"
+		if *updateGolden {
+			if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != string(expected) {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", input, actual, expected)
+			continue
+		}
+		if again := parseFile(t, golden); again != nil && again.String() != actual {
+			t.Errorf("%s: did not round trip, got:\n%s", golden, again)
+		}
+	}
+}
+
+func TestParseFile_Errors(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":                         "no FROM instruction",
+		"RUN true\nFROM alpine":    "line 1: RUN before FROM",
+		"FROM alpine\n\nCMD":       "line 3: CMD requires arguments",
+		"FROM alpine as":           "line 1: FROM requires either one or three arguments",
+		"FROM alpine\nENV A=1 B":   `line 2: ENV: expected key=value, got "B"`,
+		"FROM alpine\nLABEL a=\"b": "line 2: unmatched \"",
+		"FROM alpine\nENV A":       "line 2: ENV must have two arguments",
+	} {
+		_, err := ParseFile(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("parsing %q: got nil; want error %q", input, expected)
+		} else if err.Error() != expected {
+			t.Errorf("parsing %q: got error %q; want %q", input, err, expected)
+		}
+	}
+}
+
+func TestQuote_RoundTrip(t *testing.T) {
+	values := []string{
+		"plain", "two words", "tab\there", `"quoted"`, `it's`, `C:\app\`,
+		"back`tick", "caf\u00e9 \u2603", `a\"b`, "`\"`", `$HOME`, "",
+	}
+	for _, escape := range []string{`\`, "`"} {
+		for _, v := range values {
+			q := quote(v, escape)
+			words, err := splitWords("x="+q, escapeRune(escape))
+			if err != nil {
+				t.Errorf("escape %s: splitting %s: %s", escape, q, err)
+				continue
+			}
+			if len(words) != 1 || words[0] != "x="+v {
+				t.Errorf("escape %s: %q quoted as %s, which splits into %q", escape, v, q, words)
+			}
+		}
+	}
+}
+
+func TestFile_Expand(t *testing.T) {
+	f := parseFile(t, "testdata/parse/multistage.Dockerfile")
+	if f == nil {
+		return
+	}
+	f.Instructions.Add("ENV", KeyValuePairs{{"HOME", "/home/${USER:-nobody}"}})
+	f.Instructions.Add("WORKDIR", SingleArg(`$HOME/\$literal`))
+	expanded, err := f.Expand(map[string]string{"VERSION": "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ARG GO_VERSION=1.6
+FROM golang:1.6 AS build
+ARG VERSION
+WORKDIR /go/src/app
+COPY [".","."]
+RUN go build -ldflags "-X main.Version=${VERSION}" -o /app .
+FROM alpine:3.3 AS runtime
+COPY --from=build ["/app","/app"]
+USER nobody
+ENTRYPOINT ["/app"]
+ENV  \
+	HOME=/home/nobody
+WORKDIR /home/nobody/$literal
+`
+	if actual := expanded.String(); actual != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", actual, expected)
+	}
+	expanded, err = f.Expand(map[string]string{"GO_VERSION": "1.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expanded.From != "golang:1.7" {
+		t.Errorf("got From %q; want golang:1.7", expanded.From)
+	}
+}
+
+func parseFile(t *testing.T, path string) *File {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseFile(strings.NewReader(string(b)))
+	if err != nil {
+		t.Errorf("%s: %s", path, err)
+	}
+	return f
+}
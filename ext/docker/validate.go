@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// validator is implemented by Args which can check their own values.
+type validator interface {
+	Validate() error
+}
+
+// knownInstructions are the instructions docker understands, mapped to whether
+// they accept the JSON (exec) form only.
+var knownInstructions = map[string]bool{
+	"ADD": false, "ARG": false, "CMD": false, "COPY": false,
+	"ENTRYPOINT": false, "ENV": false, "EXPOSE": false, "FROM": false,
+	"HEALTHCHECK": false, "LABEL": false, "MAINTAINER": false,
+	"ONBUILD": false, "RUN": false, "SHELL": true, "STOPSIGNAL": false,
+	"USER": false, "VOLUME": false, "WORKDIR": false,
+}
+
+// Validate returns an error describing the first problem which would cause
+// docker to reject f, if there is one.
+func (f File) Validate() error {
+	if f.From == "" {
+		return fmt.Errorf("FROM: no base image")
+	}
+	for _, i := range f.Prelude {
+		if i.Name != "ARG" {
+			return fmt.Errorf("%s: only ARG may precede FROM", i.Name)
+		}
+		if err := i.Validate(); err != nil {
+			return err
+		}
+	}
+	stages := []string{f.Stage}
+	for n, i := range f.Instructions {
+		if err := i.Validate(); err != nil {
+			return fmt.Errorf("instruction %d: %s", n+1, err)
+		}
+		switch a := i.Args.(type) {
+		case FromArgs:
+			if a.Stage != "" && indexOf(stages, a.Stage) != -1 {
+				return fmt.Errorf("instruction %d: duplicate stage name %q", n+1, a.Stage)
+			}
+			stages = append(stages, a.Stage)
+		case CopyArgs:
+			if err := validateCopyFrom(a.From, stages); err != nil {
+				return fmt.Errorf("instruction %d: %s", n+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if i is not an instruction docker understands, or
+// its arguments are invalid.
+func (i Instruction) Validate() error {
+	jsonOnly, ok := knownInstructions[i.Name]
+	if !ok {
+		return fmt.Errorf("unknown instruction %q", i.Name)
+	}
+	if i.Args == nil || i.Args.String() == "" {
+		return fmt.Errorf("%s requires arguments", i.Name)
+	}
+	if _, isArray := i.Args.(ArrayArgs); jsonOnly && !isArray {
+		return fmt.Errorf("%s requires the JSON form", i.Name)
+	}
+	if c, ok := i.Args.(CopyArgs); ok && i.Name == "ADD" && c.From != "" {
+		return fmt.Errorf("ADD does not support --from")
+	}
+	if v, ok := i.Args.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%s: %s", i.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateCopyFrom returns an error if from refers to the current, or a later,
+// build stage. stages are the names of the stages so far, the last being the
+// current stage. Any other value of from is assumed to be an image.
+func validateCopyFrom(from string, stages []string) error {
+	if from == "" {
+		return nil
+	}
+	current := len(stages) - 1
+	if n, err := strconv.Atoi(from); err == nil {
+		if n < 0 || n >= current {
+			return fmt.Errorf("COPY --from=%d must refer to an earlier stage", n)
+		}
+		return nil
+	}
+	if strings.EqualFold(from, stages[current]) {
+		return fmt.Errorf("COPY --from=%s refers to the current stage", from)
+	}
+	return nil
+}
+
+func indexOf(ss []string, s string) int {
+	for i, t := range ss {
+		if strings.EqualFold(s, t) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFile_Validate(t *testing.T) {
+	f := File{From: "golang:1.6", Stage: "build"}
+	f.ARG("VERSION", "")
+	f.COPY("/go/src/app/", "a.go", "b.go")
+	f.FROM("alpine:3.3", "")
+	f.COPYFrom("build", "/app", "/go/bin/app")
+	f.COPYFrom("0", "/app.conf", "/etc/app.conf")
+	f.EXPOSE(Port{Number: 80}, Port{Number: 53, Protocol: "udp"})
+	f.VOLUME("/data")
+	f.STOPSIGNAL("SIGTERM")
+	f.HEALTHCHECK(HealthCheck{Interval: time.Minute, Cmd: ArrayArgs{"/app", "-check"}})
+	f.SHELL("/bin/ash", "-c")
+	f.ONBUILD("RUN", SingleArg("make"))
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for expected, modify := range map[string]func(*File){
+		"FROM: no base image":                                                  func(f *File) { f.From = "" },
+		`instruction 12: unknown instruction "FOO"`:                            func(f *File) { f.Instructions.Add("FOO", SingleArg("bar")) },
+		"instruction 12: ARG: invalid name \"1A\"":                             func(f *File) { f.ARG("1A", "") },
+		"instruction 12: COPY: requires at least one source and a destination": func(f *File) { f.COPY("/dest") },
+		"instruction 12: COPY: destination \"/dest\" must end with / when copying multiple sources": func(f *File) {
+			f.COPY("/dest", "a", "b")
+		},
+		"instruction 12: COPY --from=1 must refer to an earlier stage":   func(f *File) { f.COPYFrom("1", "/a", "/b") },
+		"instruction 12: ADD does not support --from":                    func(f *File) { f.Instructions.Add("ADD", CopyArgs{From: "build", Sources: []string{"a"}, Dest: "b"}) },
+		`instruction 12: duplicate stage name "build"`:                   func(f *File) { f.FROM("alpine", "build") },
+		"instruction 12: EXPOSE: invalid port number 70000":              func(f *File) { f.EXPOSE(Port{Number: 70000}) },
+		`instruction 12: EXPOSE: invalid protocol "sctp" for port 80`:    func(f *File) { f.EXPOSE(Port{80, "sctp"}) },
+		`instruction 12: STOPSIGNAL: invalid signal "TERM"`:              func(f *File) { f.STOPSIGNAL("TERM") },
+		"instruction 12: HEALTHCHECK: options are not allowed with NONE": func(f *File) { f.HEALTHCHECK(HealthCheck{Retries: 3}) },
+		"instruction 12: SHELL requires the JSON form":                   func(f *File) { f.Instructions.Add("SHELL", SingleArg("/bin/sh -c")) },
+		"instruction 12: ONBUILD: FROM may not be triggered by ONBUILD":  func(f *File) { f.ONBUILD("FROM", FromArgs{Image: "alpine"}) },
+		"ENV: only ARG may precede FROM":                                 func(f *File) { f.Prelude.Add("ENV", KeyValuePairs{{"A", "1"}}) },
+	} {
+		invalid := f
+		invalid.Instructions = append(Instructions{}, f.Instructions...)
+		modify(&invalid)
+		err := invalid.Validate()
+		if err == nil {
+			t.Errorf("got nil; want error %q", expected)
+		} else if err.Error() != expected {
+			t.Errorf("got error %q; want %q", err, expected)
+		}
+	}
+}
+
+func TestKeyValueArgs_Flatten(t *testing.T) {
+	kv := KeyValueArgs{"b": "2", "a": "1", "c": "three 3"}
+	expected := `a=1,b=2,c="three 3"`
+	for i := 0; i < 10; i++ {
+		if actual := strings.Join(kv.Flatten(), ","); actual != expected {
+			t.Fatalf("got %q; want %q", actual, expected)
+		}
+	}
+}
+
+func TestFile_Expand_Ports(t *testing.T) {
+	f, err := ParseFile(strings.NewReader("FROM alpine\nARG PORT=8080\nEXPOSE ${PORT}/udp 80"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, err := f.Expand(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, ok := expanded.Instructions[1].Args.(Ports)
+	if !ok || len(ports) != 2 || ports[0] != (Port{8080, "udp"}) {
+		t.Errorf("got %#v; want Ports 8080/udp and 80", expanded.Instructions[1].Args)
+	}
+}
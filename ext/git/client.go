@@ -2,7 +2,10 @@ package git
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/opentable/sous/sous"
 	"github.com/opentable/sous/util/shell"
@@ -66,7 +69,9 @@ func (c *Client) OpenRepo(dirpath string) (*Repo, error) {
 	if err := sh.CD(dirpath); err != nil {
 		return nil, err
 	}
-	return NewRepo(c.Clone())
+	cl := c.Clone()
+	cl.Sh = sh
+	return NewRepo(cl)
 }
 
 func (c *Client) stdout(name string, args ...interface{}) (string, error) {
@@ -113,6 +118,35 @@ func (c *Client) ListTags() ([]sous.Tag, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseTagLines(lines), nil
+}
+
+// ReachableTags lists the tags reachable from HEAD, nearest first.
+func (c *Client) ReachableTags() ([]sous.Tag, error) {
+	lines, err := c.stdoutLines("log", "--topo-order", "--simplify-by-decoration", `--pretty=format:%H %aI %D`, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return parseTagLines(lines), nil
+}
+
+// CountCommits counts the commits reachable from HEAD but not from since. If
+// since is empty, it counts all commits reachable from HEAD.
+func (c *Client) CountCommits(since string) (int, error) {
+	revs := "HEAD"
+	if since != "" {
+		revs = since + "..HEAD"
+	}
+	s, err := c.stdout("rev-list", "--count", revs)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+// parseTagLines parses lines of git log output in the format "%H %aI %D",
+// returning each tag found in the decorations.
+func parseTagLines(lines []string) []sous.Tag {
 	// E.g. output...
 	//1141dde555492ea0a6073a222b2607900d09b0b5 2015-10-02T12:12:01+01:00 tag: v0.0.1-alpha1, tag: v0.0.1-alpha
 	tags := []sous.Tag{}
@@ -121,14 +155,31 @@ func (c *Client) ListTags() ([]sous.Tag, error) {
 		if len(r) != 3 || !strings.Contains(r[2], "tag: ") {
 			continue
 		}
-		cleanTags := strings.Replace(r[2], "tag: ", "", -1)
-		ts := strings.Split(cleanTags, ", ")
-		for _, t := range ts {
-
-			tags = append(tags, sous.Tag{Name: t, Revision: r[0]})
+		for _, d := range strings.Split(r[2], ", ") {
+			if !strings.HasPrefix(d, "tag: ") {
+				continue
+			}
+			tags = append(tags, sous.Tag{Name: strings.TrimPrefix(d, "tag: "), Revision: r[0]})
 		}
 	}
-	return tags, nil
+	return tags
+}
+
+// RemoteURL returns the URL of the origin remote, or the empty string if there
+// is no origin remote.
+func (c *Client) RemoteURL() (string, error) {
+	r, err := c.Sh.Cmd(c.Bin, "config", "--get", "remote.origin.url").Result()
+	if err != nil {
+		return "", err
+	}
+	// git config exits 1 when the key does not exist.
+	if r.ExitCode == 1 {
+		return "", nil
+	}
+	if r.Err != nil {
+		return "", fmt.Errorf("getting remote url: %s", r.Err)
+	}
+	return r.Stdout.String(), nil
 }
 
 func (c *Client) NearestTag() (string, error) {
@@ -138,3 +189,91 @@ func (c *Client) NearestTag() (string, error) {
 func (c *Client) CurrentBranch() (string, error) {
 	return c.stdout("rev-parse", "--abbrev-ref", "HEAD")
 }
+
+// Init creates an empty repository in the client's directory. Running it in an
+// existing repository is safe.
+func (c *Client) Init() error {
+	return c.Sh.Cmd(c.Bin, "init", "-q").Succeed()
+}
+
+// User returns the identity git is configured to commit as, from its user.name
+// and user.email settings.
+func (c *Client) User() (Signature, error) {
+	name, err := c.stdout("config", "user.name")
+	if err != nil {
+		return Signature{}, fmt.Errorf("git user.name is not set: %s", err)
+	}
+	email, err := c.stdout("config", "user.email")
+	if err != nil {
+		return Signature{}, fmt.Errorf("git user.email is not set: %s", err)
+	}
+	return Signature{Name: name, Email: email}, nil
+}
+
+// HasCommits returns true if HEAD refers to a commit, which is false in a
+// newly created repository.
+func (c *Client) HasCommits() (bool, error) {
+	code, err := c.Sh.ExitCode(c.Bin, "rev-parse", "--verify", "-q", "HEAD")
+	return code == 0, err
+}
+
+// CommitAll stages every change in the client's directory, including new and
+// deleted files, and commits them with author as both author and committer. It
+// returns the new revision, and true, or the empty string, and false, if there
+// was nothing to commit.
+func (c *Client) CommitAll(author Signature, message string) (string, bool, error) {
+	if err := c.Sh.Cmd(c.Bin, "add", "-A", ".").Succeed(); err != nil {
+		return "", false, err
+	}
+	// git diff exits 1 when there are staged changes.
+	code, err := c.Sh.ExitCode(c.Bin, "diff", "--cached", "--quiet", "--", ".")
+	if err != nil || code == 0 {
+		return "", false, err
+	}
+	sh := c.Sh.Clone()
+	if len(sh.Env) == 0 {
+		sh.Env = os.Environ()
+	}
+	sh.Env = append(sh.Env, author.env()...)
+	if err := sh.Cmd(c.Bin, "commit", "-q", "-m", message, "--", ".").Succeed(); err != nil {
+		return "", false, err
+	}
+	rev, err := c.Revision()
+	return rev, err == nil, err
+}
+
+// Log returns the commits reachable from rev which changed the client's
+// directory, most recent first. If max is greater than zero, at most max
+// commits are returned.
+func (c *Client) Log(rev string, max int) ([]Commit, error) {
+	args := []interface{}{"--format=%H%x00%an%x00%ae%x00%aI%x00%B%x1e"}
+	if max > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", max))
+	}
+	args = append(args, rev, "--", ".")
+	out, err := c.stdout("log", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(out)
+}
+
+// RevisionBefore returns the most recent commit reachable from rev which was
+// committed at or before t, or the empty string if there is none.
+func (c *Client) RevisionBefore(rev string, t time.Time) (string, error) {
+	return c.stdout("rev-list", "-1", "--before="+t.Format(time.RFC3339), rev)
+}
+
+// ExtractTree writes the files in the client's directory, as they were at rev,
+// into dir.
+func (c *Client) ExtractTree(rev, dir string) error {
+	prefix, err := c.stdout("rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	r, err := c.Sh.Cmd(c.Bin, "archive", "--format=tar", rev+":"+prefix).SucceedResult()
+	if err != nil {
+		return err
+	}
+	return untar(r.Stdout.Reader(), dir)
+}
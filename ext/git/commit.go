@@ -0,0 +1,197 @@
+package git
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type (
+	// Commit is a single commit, as returned by Client.Log.
+	Commit struct {
+		// Revision is the full commit hash.
+		Revision string
+		// Author is the author of the commit.
+		Author Signature
+		// Subject is the first line of the commit message.
+		Subject string
+		// Body is the rest of the commit message, excluding trailers.
+		Body string
+		// Trailers are the "Key: value" lines in the last paragraph of the
+		// commit message.
+		Trailers Trailers
+	}
+	// Signature identifies the author of a commit, and when it was made.
+	Signature struct {
+		Name, Email string
+		// Time is when the commit was made. Zero means now.
+		Time time.Time
+	}
+	// Trailers are structured data at the end of a commit message, in the
+	// form "Key: value", one per line.
+	Trailers []Trailer
+	// Trailer is a single "Key: value" line of a commit message.
+	Trailer struct {
+		Key, Value string
+	}
+)
+
+var (
+	signaturePattern = regexp.MustCompile(`^\s*([^<]*?)\s*<([^>]*)>\s*$`)
+	trailerPattern   = regexp.MustCompile(`^([A-Za-z0-9-]+): (.*)$`)
+)
+
+// ParseSignature parses a signature in the form "Name <email>".
+func ParseSignature(s string) (Signature, error) {
+	m := signaturePattern.FindStringSubmatch(s)
+	if m == nil || m[1] == "" || m[2] == "" {
+		return Signature{}, fmt.Errorf("%q is not in the form \"Name <email>\"", s)
+	}
+	return Signature{Name: m[1], Email: m[2]}, nil
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// env returns the environment variables which make git use s as both the
+// author and committer.
+func (s Signature) env() []string {
+	env := []string{
+		"GIT_AUTHOR_NAME=" + s.Name, "GIT_AUTHOR_EMAIL=" + s.Email,
+		"GIT_COMMITTER_NAME=" + s.Name, "GIT_COMMITTER_EMAIL=" + s.Email,
+	}
+	if !s.Time.IsZero() {
+		date := s.Time.Format(time.RFC3339)
+		env = append(env, "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	}
+	return env
+}
+
+// Get returns the value of every trailer with key.
+func (ts Trailers) Get(key string) []string {
+	var vs []string
+	for _, t := range ts {
+		if strings.EqualFold(t.Key, key) {
+			vs = append(vs, t.Value)
+		}
+	}
+	return vs
+}
+
+func (ts Trailers) String() string {
+	lines := make([]string, len(ts))
+	for i, t := range ts {
+		lines[i] = t.Key + ": " + t.Value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CommitMessage formats a commit message from its subject, body and trailers,
+// any of which except subject may be empty.
+func CommitMessage(subject, body string, trailers Trailers) string {
+	paragraphs := []string{strings.TrimSpace(subject)}
+	if b := strings.TrimSpace(body); b != "" {
+		paragraphs = append(paragraphs, b)
+	}
+	if len(trailers) != 0 {
+		paragraphs = append(paragraphs, trailers.String())
+	}
+	return strings.Join(paragraphs, "\n\n") + "\n"
+}
+
+// parseLog parses the output of git log in the format
+// "%H%x00%an%x00%ae%x00%aI%x00%B%x1e".
+func parseLog(out string) ([]Commit, error) {
+	commits := []Commit{}
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		f := strings.SplitN(record, "\x00", 5)
+		if len(f) != 5 {
+			return nil, fmt.Errorf("unexpected git log output: %q", record)
+		}
+		t, err := time.Parse(time.RFC3339, f[3])
+		if err != nil {
+			return nil, err
+		}
+		c := Commit{Revision: f[0], Author: Signature{Name: f[1], Email: f[2], Time: t}}
+		c.Subject, c.Body, c.Trailers = parseMessage(f[4])
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// parseMessage splits a commit message into its subject, body and trailers.
+// The last paragraph is only treated as trailers if every line in it is a
+// trailer, and it is not the subject.
+func parseMessage(m string) (subject, body string, trailers Trailers) {
+	paragraphs := strings.Split(strings.TrimSpace(m), "\n\n")
+	subject = paragraphs[0]
+	paragraphs = paragraphs[1:]
+	if n := len(paragraphs); n != 0 {
+		if ts, ok := parseTrailers(paragraphs[n-1]); ok {
+			trailers = ts
+			paragraphs = paragraphs[:n-1]
+		}
+	}
+	return subject, strings.TrimSpace(strings.Join(paragraphs, "\n\n")), trailers
+}
+
+func parseTrailers(paragraph string) (Trailers, bool) {
+	var ts Trailers
+	for _, line := range strings.Split(paragraph, "\n") {
+		m := trailerPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, false
+		}
+		ts = append(ts, Trailer{Key: m[1], Value: m[2]})
+	}
+	return ts, true
+}
+
+// untar writes the regular files and directories in the tar stream r into dir.
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(h.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q is outside %s", h.Name, dir)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -46,28 +46,29 @@ func NewRepo(c *Client) (*Repo, error) {
 // tag, etc.
 func (r *Repo) SourceContext() (*sous.SourceContext, error) {
 	var (
-		revision, branch, nearestTagName, nearestTagRevision,
-		repoRelativeDir string
-		files, modifiedFiles, newFiles []string
-		allTags                        []sous.Tag
+		revision, branch, nearestTagName, repoRelativeDir, remoteURL string
+		files, modifiedFiles, newFiles                               []string
+		allTags                                                      []sous.Tag
+		nearestSemverTagName                                         string
+		commitsSinceSemverTag                                        int
 	)
 	c := r.Client
 	err := parallel.Do(
 		func(err *error) { branch, *err = c.CurrentBranch() },
 		func(err *error) { revision, *err = c.Revision() },
+		func(err *error) { remoteURL, *err = c.RemoteURL() },
 		func(err *error) {
 			repoRelativeDir, *err = filepath.Rel(r.Root, r.Client.Sh.Dir)
 		},
 		func(err *error) {
 			allTags, *err = r.Client.ListTags()
-			if err != nil || len(allTags) == 0 {
+			if *err != nil || len(allTags) == 0 {
 				return
 			}
 			nearestTagName, *err = c.NearestTag()
-			if err != nil {
-				return
-			}
-			nearestTagRevision, *err = c.RevisionAt(nearestTagName)
+		},
+		func(err *error) {
+			nearestSemverTagName, commitsSinceSemverTag, *err = r.nearestSemverTag()
 		},
 		func(err *error) { files, *err = c.ListFiles() },
 		func(err *error) { modifiedFiles, *err = c.ModifiedFiles() },
@@ -81,11 +82,34 @@ func (r *Repo) SourceContext() (*sous.SourceContext, error) {
 		OffsetDir:        repoRelativeDir,
 		Branch:           branch,
 		Revision:         revision,
+		RemoteURL:        remoteURL,
 		Files:            files,
 		ModifiedFiles:    modifiedFiles,
 		NewFiles:         newFiles,
 		Tags:             allTags,
 		NearestTagName:   nearestTagName,
 		DirtyWorkingTree: len(modifiedFiles)+len(newFiles) != 0,
+
+		NearestSemverTagName:  nearestSemverTagName,
+		CommitsSinceSemverTag: commitsSinceSemverTag,
 	}, nil
 }
+
+// nearestSemverTag returns the name of the nearest tag reachable from HEAD
+// which is a semver version, and the number of commits since that tag. If there
+// is no such tag, it returns the empty string and the total number of commits.
+func (r *Repo) nearestSemverTag() (string, int, error) {
+	tags, err := r.Client.ReachableTags()
+	if err != nil {
+		return "", 0, err
+	}
+	name := ""
+	for _, t := range tags {
+		if _, ok := sous.ParseSemverTag(t.Name); ok {
+			name = t.Name
+			break
+		}
+	}
+	count, err := r.Client.CountCommits(name)
+	return name, count, err
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opentable/sous/util/shell"
+)
+
+func TestRepo_SourceContext_Tags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sh, err := shell.DefaultInDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(sh)
+	if err != nil {
+		t.Skipf("git not available: %s", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(file string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := sh.Cmd("git", "add", file).Succeed(); err != nil {
+			t.Fatal(err)
+		}
+		if err := sh.Cmd("git", "-c", "user.name=Test", "-c", "user.email=test@example.com",
+			"commit", "-q", "-m", "add "+file).Succeed(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sourceContext := func() (tag, semverTag string, since int) {
+		r, err := c.OpenRepo(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := r.SourceContext()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.NearestTagName, s.NearestSemverTagName, s.CommitsSinceSemverTag
+	}
+
+	commit("a")
+	if tag, _, _ := sourceContext(); tag != "" {
+		t.Errorf("got nearest tag %q in an untagged repo; want none", tag)
+	}
+	if err := sh.Cmd("git", "tag", "v1.0.0").Succeed(); err != nil {
+		t.Fatal(err)
+	}
+	commit("b")
+	if err := sh.Cmd("git", "tag", "release").Succeed(); err != nil {
+		t.Fatal(err)
+	}
+	commit("c")
+	tag, semverTag, since := sourceContext()
+	if tag != "release" || semverTag != "v1.0.0" || since != 2 {
+		t.Errorf("got nearest tag %q, semver tag %q, %d commits since; want %q, %q, 2",
+			tag, semverTag, since, "release", "v1.0.0")
+	}
+}
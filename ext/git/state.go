@@ -0,0 +1,158 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/opentable/sous/sous"
+)
+
+type (
+	// StateRepo is a git repository containing a Sous state tree, see
+	// sous.SaveStateTree. Each change to the state is a commit, so the
+	// state's history can be listed, and the state at any earlier revision
+	// or time reconstructed.
+	StateRepo struct {
+		// Client is a git client in the directory containing the state tree.
+		// This is usually the root of the repository, but need not be.
+		Client *Client
+	}
+	// StateChange describes a change to the state, for its commit message.
+	StateChange struct {
+		// Author is the person making the change.
+		Author Signature
+		// Reason is why the change is being made. It is required, and its
+		// first line is the commit subject.
+		Reason string
+		// Trailers are added to those Sous adds itself.
+		Trailers Trailers
+	}
+)
+
+const (
+	// ChangedTrailer is added to a state commit once for each deployment it
+	// adds, removes or changes, with a value like "github.com/user/repo in
+	// east". It is also added once with the value "config" if the shared
+	// config changes.
+	ChangedTrailer = "Sous-Changed"
+	// ChangeCountTrailer is added to each state commit, with the number of
+	// deployments the commit changes.
+	ChangeCountTrailer = "Sous-Deployments-Changed"
+)
+
+// OpenStateRepo returns a StateRepo for the state tree in the directory of c,
+// initialising a new git repository there if it is not already inside one.
+func OpenStateRepo(c *Client) (*StateRepo, error) {
+	if _, err := c.RepoRoot(); err != nil {
+		if err := c.Init(); err != nil {
+			return nil, err
+		}
+	}
+	return &StateRepo{Client: c}, nil
+}
+
+// Dir is the directory containing the state tree.
+func (r *StateRepo) Dir() string {
+	return r.Client.Dir()
+}
+
+// State loads the state tree as it is in the working directory, which
+// includes any uncommitted changes.
+func (r *StateRepo) State() (*sous.State, error) {
+	return sous.LoadStateTree(r.Dir())
+}
+
+// Save saves s and commits it, describing the change with c and trailers
+// listing the deployments it changed. It returns the new revision, or the empty
+// string if s is the same as the committed state.
+func (r *StateRepo) Save(s *sous.State, c StateChange) (string, error) {
+	if c.Reason == "" {
+		return "", fmt.Errorf("a reason is required to change the state")
+	}
+	before, err := r.StateAt("HEAD")
+	if err != nil {
+		return "", err
+	}
+	if err := sous.SaveStateTree(s, r.Dir()); err != nil {
+		return "", err
+	}
+	diffs := sous.DiffGDM(&before.GDM, &s.GDM)
+	trailers := Trailers{{ChangeCountTrailer, fmt.Sprint(len(diffs))}}
+	if !reflect.DeepEqual(before.Config, s.Config) {
+		trailers = append(trailers, Trailer{ChangedTrailer, "config"})
+	}
+	for _, d := range diffs {
+		trailers = append(trailers, Trailer{ChangedTrailer, fmt.Sprintf("%s in %s", d.Source, d.Cluster)})
+	}
+	trailers = append(trailers, c.Trailers...)
+	subject, body := c.Reason, ""
+	if i := strings.Index(c.Reason, "\n"); i != -1 {
+		subject, body = c.Reason[:i], c.Reason[i+1:]
+	}
+	rev, _, err := r.Client.CommitAll(c.Author, CommitMessage(subject, body, trailers))
+	return rev, err
+}
+
+// History returns the commits which changed the state, most recent first. If
+// max is greater than zero, at most max commits are returned.
+func (r *StateRepo) History(max int) ([]Commit, error) {
+	if ok, err := r.Client.HasCommits(); !ok || err != nil {
+		return []Commit{}, err
+	}
+	return r.Client.Log("HEAD", max)
+}
+
+// StateAt reconstructs the state as it was committed at rev. If the repository
+// has no commits yet, and rev is HEAD, the state is empty.
+func (r *StateRepo) StateAt(rev string) (*sous.State, error) {
+	if rev == "HEAD" {
+		if ok, err := r.Client.HasCommits(); !ok || err != nil {
+			return &sous.State{}, err
+		}
+	}
+	dir, err := ioutil.TempDir("", "sous-state")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := r.Client.ExtractTree(rev, dir); err != nil {
+		return nil, err
+	}
+	s, err := sous.LoadStateTree(dir)
+	if err != nil {
+		return nil, fmt.Errorf("loading state at %s: %s", rev, err)
+	}
+	return s, nil
+}
+
+// RevisionAsOf returns the revision of the state as it was at t: the most
+// recent commit made at or before t. It returns an error if the state did not
+// exist yet.
+func (r *StateRepo) RevisionAsOf(t time.Time) (string, error) {
+	if ok, err := r.Client.HasCommits(); !ok || err != nil {
+		return "", fmt.Errorf("no state as of %s", t.Format(time.RFC3339))
+	}
+	rev, err := r.Client.RevisionBefore("HEAD", t)
+	if err == nil && rev == "" {
+		err = fmt.Errorf("no state as of %s", t.Format(time.RFC3339))
+	}
+	return rev, err
+}
+
+// Diff returns the deployments which differ between the GDMs at revisions from
+// and to.
+func (r *StateRepo) Diff(from, to string) ([]sous.DeploymentDiff, error) {
+	before, err := r.StateAt(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := r.StateAt(to)
+	if err != nil {
+		return nil, err
+	}
+	return sous.DiffGDM(&before.GDM, &after.GDM), nil
+}
@@ -0,0 +1,172 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/shell"
+)
+
+func testStateRepo(t *testing.T) (*StateRepo, func()) {
+	dir, err := ioutil.TempDir("", "sous-state-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := shell.DefaultInDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(sh)
+	if err != nil {
+		t.Skipf("git not available: %s", err)
+	}
+	r, err := OpenStateRepo(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, func() { os.RemoveAll(dir) }
+}
+
+func testState(version string, instances int) *sous.State {
+	s := &sous.State{}
+	s.Config.Clusters = sous.Clusters{{Name: "east", Kind: "singularity", URL: "http://east"}}
+	s.GDM.Applications = sous.Applications{{
+		Source: sous.Source{RepoURL: "github.com/opentable/a"},
+		Deployments: sous.Deployments{
+			"east": {Version: version, NumInstances: instances},
+		},
+	}}
+	return s
+}
+
+func TestStateRepo(t *testing.T) {
+	r, cleanup := testStateRepo(t)
+	defer cleanup()
+
+	history, err := r.History(0)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("got history %v, %v; want none", history, err)
+	}
+
+	t1 := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	author := Signature{Name: "Alice", Email: "alice@example.com", Time: t1}
+	s1 := testState("1.0.0", 1)
+	rev1, err := r.Save(s1, StateChange{Author: author, Reason: "Deploy a", Trailers: Trailers{{"Ticket", "OPS-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author.Time = t1.Add(time.Hour)
+	s2 := testState("1.1.0", 3)
+	rev2, err := r.Save(s2, StateChange{Author: author, Reason: "Upgrade a\n\nIt is faster."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := r.Save(s2, StateChange{Author: author, Reason: "Nothing"}); err != nil || rev != "" {
+		t.Errorf("saving unchanged state: got %q, %v; want no commit", rev, err)
+	}
+	if _, err := r.Save(s2, StateChange{Author: author}); err == nil {
+		t.Error("saving without a reason: got nil error")
+	}
+
+	history, err = r.History(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Revision != rev2 || history[1].Revision != rev1 {
+		t.Fatalf("got history %v; want %s, %s", history, rev2, rev1)
+	}
+	first := history[1]
+	if first.Subject != "Deploy a" || first.Author.Email != "alice@example.com" || !first.Author.Time.Equal(t1) {
+		t.Errorf("got first commit %+v", first)
+	}
+	expectedTrailers := Trailers{
+		{ChangeCountTrailer, "1"},
+		{ChangedTrailer, "config"},
+		{ChangedTrailer, "github.com/opentable/a in east"},
+		{"Ticket", "OPS-1"},
+	}
+	if !reflect.DeepEqual(first.Trailers, expectedTrailers) {
+		t.Errorf("got trailers %v; want %v", first.Trailers, expectedTrailers)
+	}
+	if history[0].Body != "It is faster." || len(history[0].Trailers.Get(ChangedTrailer)) != 1 {
+		t.Errorf("got second commit %+v", history[0])
+	}
+	if h, err := r.History(1); err != nil || len(h) != 1 {
+		t.Errorf("History(1): got %v, %v", h, err)
+	}
+
+	s, err := r.StateAt(rev1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s1) {
+		t.Errorf("state at %s: got %#v; want %#v", rev1, s, s1)
+	}
+
+	if rev, err := r.RevisionAsOf(t1.Add(30 * time.Minute)); err != nil || rev != rev1 {
+		t.Errorf("as of 30 minutes later: got %q, %v; want %s", rev, err, rev1)
+	}
+	if rev, err := r.RevisionAsOf(t1.Add(-time.Minute)); err == nil {
+		t.Errorf("before the first commit: got %s; want error", rev)
+	}
+
+	diffs, err := r.Diff(rev1, rev2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "~ github.com/opentable/a in east: Version 1.0.0 -> 1.1.0; NumInstances 1 -> 3"
+	if len(diffs) != 1 || diffs[0].String() != expected {
+		t.Errorf("got diff %v; want %q", diffs, expected)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	subject, body, trailers := parseMessage("Subject\n\nBody: not a trailer\nat all\n\nKey: value\nOther-Key: v: 2\n")
+	if subject != "Subject" || body != "Body: not a trailer\nat all" {
+		t.Errorf("got subject %q, body %q", subject, body)
+	}
+	expected := Trailers{{"Key", "value"}, {"Other-Key", "v: 2"}}
+	if !reflect.DeepEqual(trailers, expected) {
+		t.Errorf("got trailers %v; want %v", trailers, expected)
+	}
+	if _, _, trailers := parseMessage("Key: value"); trailers != nil {
+		t.Errorf("subject parsed as trailers %v", trailers)
+	}
+}
+
+func TestStateRepo_SaveEditedTree(t *testing.T) {
+	r, cleanup := testStateRepo(t)
+	defer cleanup()
+	for k, v := range map[string]string{"user.name": "Bob", "user.email": "bob@example.com"} {
+		if err := r.Client.Sh.Cmd("git", "config", k, v).Succeed(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sous.SaveStateTree(testState("1.0.0", 1), r.Dir()); err != nil {
+		t.Fatal(err)
+	}
+	author, err := r.Client.User()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Save(s, StateChange{Author: author, Reason: "Edit by hand"}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := r.History(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Author.String() != "Bob <bob@example.com>" ||
+		len(history[0].Trailers.Get(ChangedTrailer)) != 2 {
+		t.Errorf("got history %+v", history)
+	}
+}
@@ -0,0 +1,191 @@
+// Package singularity deploys applications to Singularity clusters, see
+// https://github.com/HubSpot/Singularity
+package singularity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type (
+	// Client is a client for the subset of the Singularity HTTP API used by
+	// Driver.
+	Client struct {
+		// BaseURL is the URL of the Singularity server, without the /api
+		// suffix.
+		BaseURL string
+		// HTTP is the client used to make requests.
+		HTTP *http.Client
+	}
+	// Request is a Singularity request: a long-running service, which is
+	// deployed by creating Deploys.
+	Request struct {
+		ID          string `json:"id"`
+		RequestType string `json:"requestType"`
+		Instances   int    `json:"instances"`
+	}
+	// RequestParent is a request, along with its state and, when fetched
+	// individually, its active deploy.
+	RequestParent struct {
+		Request      Request `json:"request"`
+		State        string  `json:"state"`
+		ActiveDeploy *Deploy `json:"activeDeploy,omitempty"`
+	}
+	// Deploy is a version of a request: what it runs, and with what
+	// resources.
+	Deploy struct {
+		RequestID     string            `json:"requestId"`
+		ID            string            `json:"id"`
+		ContainerInfo ContainerInfo     `json:"containerInfo"`
+		Resources     Resources         `json:"resources"`
+		Env           map[string]string `json:"env,omitempty"`
+		Metadata      map[string]string `json:"metadata,omitempty"`
+	}
+	// ContainerInfo describes the container a deploy runs.
+	ContainerInfo struct {
+		Type   string `json:"type"`
+		Docker Docker `json:"docker"`
+	}
+	// Docker describes the docker image a deploy runs.
+	Docker struct {
+		Image   string `json:"image"`
+		Network string `json:"network,omitempty"`
+	}
+	// Resources are the resources reserved for each task of a deploy.
+	Resources struct {
+		CPUs     float64 `json:"cpus"`
+		MemoryMB float64 `json:"memoryMb"`
+		NumPorts int     `json:"numPorts"`
+	}
+	// State summarises the state of a Singularity cluster.
+	State struct {
+		ActiveRequests int `json:"activeRequests"`
+		PausedRequests int `json:"pausedRequests"`
+	}
+	deployRequest struct {
+		Deploy Deploy `json:"deploy"`
+	}
+	scaleRequest struct {
+		Instances int `json:"instances"`
+	}
+)
+
+// Request states, and types, used by Sous.
+const (
+	StateActive = "ACTIVE"
+	StatePaused = "PAUSED"
+	TypeService = "SERVICE"
+)
+
+// DefaultTimeout is the timeout of requests made by clients created by
+// NewClient.
+const DefaultTimeout = 30 * time.Second
+
+// NewClient returns a client for the Singularity server at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// State fetches a summary of the cluster's state. It is cheap, so it is also
+// used to check that the cluster is available.
+func (c *Client) State() (*State, error) {
+	s := &State{}
+	return s, c.do("GET", "/api/state", nil, s)
+}
+
+// Requests lists every request, without their deploys.
+func (c *Client) Requests() ([]RequestParent, error) {
+	var rs []RequestParent
+	if err := c.do("GET", "/api/requests", nil, &rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Request fetches the request with id, including its active deploy.
+func (c *Client) Request(id string) (*RequestParent, error) {
+	r := &RequestParent{}
+	return r, c.do("GET", requestPath(id), nil, r)
+}
+
+// SaveRequest creates r, or updates it if it already exists.
+func (c *Client) SaveRequest(r Request) error {
+	return c.do("POST", "/api/requests", r, nil)
+}
+
+// Deploy starts deploying d, which replaces the request's active deploy.
+func (c *Client) Deploy(d Deploy) error {
+	return c.do("POST", "/api/deploys", deployRequest{d}, nil)
+}
+
+// Scale sets the number of instances of the request with id.
+func (c *Client) Scale(id string, instances int) error {
+	return c.do("PUT", requestPath(id)+"/scale", scaleRequest{instances}, nil)
+}
+
+// Pause stops all tasks of the request with id, until it is unpaused.
+func (c *Client) Pause(id string) error {
+	return c.do("POST", requestPath(id)+"/pause", nil, nil)
+}
+
+// Unpause restarts the tasks of the paused request with id.
+func (c *Client) Unpause(id string) error {
+	return c.do("POST", requestPath(id)+"/unpause", nil, nil)
+}
+
+// DeleteRequest stops all tasks of the request with id, and deletes it.
+func (c *Client) DeleteRequest(id string) error {
+	return c.do("DELETE", requestPath(id), nil, nil)
+}
+
+// requestPath returns the API path of the request with id. The id is escaped
+// as a single path segment, so any slashes in it are escaped too.
+func requestPath(id string) string {
+	escaped := (&url.URL{Path: id}).EscapedPath()
+	return "/api/requests/request/" + strings.Replace(escaped, "/", "%2F", -1)
+}
+
+// do sends body as JSON, and decodes the response into result, if either is
+// not nil.
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("singularity: %s %s: %s: %s", method, path, resp.Status,
+			strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("singularity: reading %s %s: %s", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package singularity
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentable/sous/sous"
+)
+
+// Driver is a sous.ClusterDriver for a Singularity cluster. Each deployment is
+// a Singularity request, with one deploy for each version deployed. A
+// deployment with no instances is a paused request.
+type Driver struct {
+	// Client is the Singularity client for the cluster.
+	Client *Client
+	// Registry is the docker registry the cluster pulls images from, see
+	// sous.ImageRef.
+	Registry string
+	// Now returns the current time, used to make deploy IDs unique. It is
+	// time.Now unless overridden in tests.
+	Now func() time.Time
+}
+
+// The metadata keys recording which application, and which version, a deploy
+// runs. Requests whose active deploy lacks them were not deployed by Sous.
+const (
+	MetadataRepoURL   = sous.LabelPrefix + sous.LabelRepoURL
+	MetadataOffsetDir = sous.LabelPrefix + sous.LabelOffsetDir
+	MetadataVersion   = sous.LabelPrefix + "version"
+)
+
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+func init() {
+	sous.ClusterKinds["singularity"] = func(c sous.Cluster, sc *sous.SharedConfig) (sous.ClusterDriver, error) {
+		if c.URL == "" {
+			return nil, fmt.Errorf("cluster %s: singularity clusters need a URL", c.Name)
+		}
+		return NewDriver(c, sc.DockerRegistry), nil
+	}
+}
+
+// NewDriver returns a driver for the Singularity cluster c, which runs images
+// from registry.
+func NewDriver(c sous.Cluster, registry string) *Driver {
+	return &Driver{Client: NewClient(c.URL), Registry: registry, Now: time.Now}
+}
+
+// RequestID returns the ID of the Singularity request for the application with
+// source s. It is readable, and unique to s.
+func RequestID(s sous.Source) string {
+	p, err := s.RepoURL.Path()
+	if err != nil {
+		p = string(s.RepoURL)
+	}
+	if s.RepoDir != "" {
+		p += "/" + s.RepoDir
+	}
+	name := strings.Trim(invalidIDChars.ReplaceAllString(p, "_"), "_")
+	return fmt.Sprintf("%s_%x", name, sha1.Sum([]byte(s.String())))[:len(name)+9]
+}
+
+// Observe returns the deployments whose requests have an active deploy made by
+// Sous.
+func (d *Driver) Observe() (sous.ClusterDeployments, error) {
+	parents, err := d.Client.Requests()
+	if err != nil {
+		return nil, err
+	}
+	ds := sous.ClusterDeployments{}
+	for _, p := range parents {
+		full, err := d.Client.Request(p.Request.ID)
+		if err != nil {
+			return nil, err
+		}
+		deploy := full.ActiveDeploy
+		if deploy == nil || deploy.Metadata[MetadataRepoURL] == "" {
+			continue
+		}
+		source := sous.Source{
+			RepoURL: sous.RepoURL(deploy.Metadata[MetadataRepoURL]),
+			RepoDir: deploy.Metadata[MetadataOffsetDir],
+		}
+		instances := full.Request.Instances
+		if full.State == StatePaused {
+			instances = 0
+		}
+		ds[source] = sous.Deployment{
+			Version:      deploy.Metadata[MetadataVersion],
+			NumInstances: instances,
+			Env:          deploy.Env,
+			Resources: sous.Resources{
+				CPUs:     deploy.Resources.CPUs,
+				MemoryMB: int(deploy.Resources.MemoryMB),
+				Ports:    deploy.Resources.NumPorts,
+			},
+		}
+	}
+	return ds, nil
+}
+
+// Health returns an error if the Singularity server cannot be reached.
+func (d *Driver) Health() error {
+	_, err := d.Client.State()
+	return err
+}
+
+// Describe returns the URL of the Singularity server.
+func (d *Driver) Describe() string {
+	return "Singularity at " + d.Client.BaseURL
+}
+
+// Apply performs each action in p in order, stopping at the first error.
+func (d *Driver) Apply(p sous.ClusterPlan) error {
+	for _, a := range p.Actions {
+		if err := d.apply(a); err != nil {
+			return fmt.Errorf("%s %s in %s: %s", a.Kind, a.Source, p.Cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *Driver) apply(a sous.Action) error {
+	id := RequestID(a.Source)
+	switch a.Kind {
+	case sous.ActionCreate:
+		r := newRequest(id, a.Desired.NumInstances)
+		if err := d.Client.SaveRequest(r); err != nil {
+			return err
+		}
+		if err := d.deploy(id, a.Source, *a.Desired); err != nil {
+			return err
+		}
+		return d.scale(id, r.Instances, a.Desired.NumInstances)
+	case sous.ActionUpdate:
+		if err := d.deploy(id, a.Source, *a.Desired); err != nil {
+			return err
+		}
+		return d.scale(id, a.Observed.NumInstances, a.Desired.NumInstances)
+	case sous.ActionScale:
+		return d.scale(id, a.Observed.NumInstances, a.Desired.NumInstances)
+	case sous.ActionDelete:
+		return d.Client.DeleteRequest(id)
+	}
+	return fmt.Errorf("unknown action %q", a.Kind)
+}
+
+// newRequest returns a service request. Singularity requires at least one
+// instance, so requests with none are created with one, and then paused.
+func newRequest(id string, instances int) Request {
+	if instances < 1 {
+		instances = 1
+	}
+	return Request{ID: id, RequestType: TypeService, Instances: instances}
+}
+
+// deploy deploys version dep of the application with source s to the request
+// with id.
+func (d *Driver) deploy(id string, s sous.Source, dep sous.Deployment) error {
+	image, err := sous.ImageRef(d.Registry, s, dep.Version)
+	if err != nil {
+		return err
+	}
+	return d.Client.Deploy(Deploy{
+		RequestID: id,
+		ID:        d.deployID(dep.Version),
+		ContainerInfo: ContainerInfo{
+			Type:   "DOCKER",
+			Docker: Docker{Image: image, Network: "BRIDGE"},
+		},
+		Resources: Resources{
+			CPUs:     dep.Resources.CPUs,
+			MemoryMB: float64(dep.Resources.MemoryMB),
+			NumPorts: dep.Resources.Ports,
+		},
+		Env: dep.Env,
+		Metadata: map[string]string{
+			MetadataRepoURL:   string(s.RepoURL),
+			MetadataOffsetDir: s.RepoDir,
+			MetadataVersion:   dep.Version,
+		},
+	})
+}
+
+// deployID returns a new deploy ID for version. Singularity deploy IDs must be
+// unique within a request, and may only contain letters, digits and
+// underscores.
+func (d *Driver) deployID(version string) string {
+	v := invalidIDChars.ReplaceAllString(version, "_")
+	return v + "_" + strconv.FormatInt(d.Now().UnixNano(), 36)
+}
+
+// scale changes the number of instances of the request with id from to to,
+// pausing it when to is zero, and unpausing it when from was zero.
+func (d *Driver) scale(id string, from, to int) error {
+	if to == 0 {
+		if from == 0 {
+			return nil
+		}
+		return d.Client.Pause(id)
+	}
+	if from == 0 {
+		if err := d.Client.Unpause(id); err != nil {
+			return err
+		}
+	}
+	if from == to {
+		return nil
+	}
+	return d.Client.Scale(id, to)
+}
@@ -0,0 +1,144 @@
+package singularity
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/opentable/sous/sous"
+)
+
+// resolve plans, and applies, the changes to make the cluster match gdm.
+func resolve(t *testing.T, d *Driver, c sous.Cluster, gdm *sous.GDM) *sous.Plan {
+	observed, err := d.Observe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := sous.Resolve(gdm, map[string]sous.ClusterDeployments{c.Name: observed}, sous.Clusters{c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Apply(plan.Clusters[0]); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestDriver(t *testing.T) {
+	fake := NewFake()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c := sous.Cluster{Name: "east", Kind: "singularity", URL: srv.URL, DefaultEnv: sous.EnvVars{"DC": "east"}}
+	d := NewDriver(c, "docker.example.com")
+
+	// A request not deployed by Sous, which must be left alone.
+	fake.Requests["other"] = &RequestParent{
+		Request: Request{ID: "other", RequestType: TypeService, Instances: 1},
+		State:   StateActive,
+		ActiveDeploy: &Deploy{RequestID: "other", ID: "1",
+			ContainerInfo: ContainerInfo{Type: "DOCKER", Docker: Docker{Image: "other:1"}}},
+	}
+
+	a := sous.Source{RepoURL: "github.com/opentable/a"}
+	b := sous.Source{RepoURL: "github.com/opentable/b", RepoDir: "svc"}
+	gdm := &sous.GDM{Applications: sous.Applications{
+		{Source: a, Deployments: sous.Deployments{"east": {Version: "1.0.0", NumInstances: 2,
+			Resources: sous.Resources{CPUs: 0.5, MemoryMB: 128, Ports: 1}}}},
+		{Source: b, Deployments: sous.Deployments{"east": {Version: "2.0.0+abc", NumInstances: 0,
+			Env: sous.EnvVars{"X": "1"}}}},
+	}}
+	resolve(t, d, c, gdm)
+
+	ra := fake.Requests[RequestID(a)]
+	if ra == nil || ra.Request.Instances != 2 || ra.State != StateActive {
+		t.Fatalf("got request for a %+v", ra)
+	}
+	if image := ra.ActiveDeploy.ContainerInfo.Docker.Image; image != "docker.example.com/a:1.0.0" {
+		t.Errorf("got image %q", image)
+	}
+	rb := fake.Requests[RequestID(b)]
+	if rb == nil || rb.State != StatePaused || rb.ActiveDeploy.ContainerInfo.Docker.Image != "docker.example.com/b-svc:2.0.0_abc" {
+		t.Fatalf("got request for b %+v", rb)
+	}
+	if !reflect.DeepEqual(rb.ActiveDeploy.Env, map[string]string{"DC": "east", "X": "1"}) {
+		t.Errorf("got env %v", rb.ActiveDeploy.Env)
+	}
+
+	// Once applied, the cluster matches the GDM.
+	observed, err := d.Observe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := gdm.Effective(c); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("observed %v; want %v", observed, expected)
+	}
+	if plan := resolve(t, d, c, gdm); !plan.Empty() {
+		t.Errorf("got plan %+v after applying; want empty", plan)
+	}
+
+	// Upgrade a, unpause b, and then remove a.
+	gdm.Applications[0].Deployments["east"] = sous.Deployment{Version: "1.1.0", NumInstances: 3}
+	gdm.Applications[1].Deployments["east"] = sous.Deployment{Version: "2.0.0+abc", NumInstances: 4,
+		Env: sous.EnvVars{"X": "1"}}
+	plan := resolve(t, d, c, gdm)
+	kinds := []sous.ActionKind{}
+	for _, action := range plan.Clusters[0].Actions {
+		kinds = append(kinds, action.Kind)
+	}
+	if !reflect.DeepEqual(kinds, []sous.ActionKind{sous.ActionUpdate, sous.ActionScale}) {
+		t.Errorf("got actions %v; want update, scale", kinds)
+	}
+	if ra.Request.Instances != 3 || ra.ActiveDeploy.Metadata[MetadataVersion] != "1.1.0" {
+		t.Errorf("a not updated: %+v", ra)
+	}
+	if rb.State != StateActive || rb.Request.Instances != 4 {
+		t.Errorf("b not unpaused and scaled: %+v", rb)
+	}
+
+	gdm.Applications = gdm.Applications[1:]
+	resolve(t, d, c, gdm)
+	if _, ok := fake.Requests[RequestID(a)]; ok {
+		t.Error("a was not deleted")
+	}
+	if _, ok := fake.Requests["other"]; !ok {
+		t.Error("request not deployed by sous was deleted")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	a := RequestID(sous.Source{RepoURL: "git@github.com:opentable/sous.git", RepoDir: "cli"})
+	if a[:len(a)-9] != "github_com_opentable_sous_cli" {
+		t.Errorf("got %q", a)
+	}
+	b := RequestID(sous.Source{RepoURL: "github.com/opentable/sous-cli"})
+	if a == b {
+		t.Errorf("different sources have the same request ID %q", a)
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	if p := requestPath("a b/c?d"); p != "/api/requests/request/a%20b%2Fc%3Fd" {
+		t.Errorf("got %q", p)
+	}
+}
+
+func TestDriver_Registered(t *testing.T) {
+	srv := httptest.NewServer(NewFake())
+	defer srv.Close()
+	c := sous.Cluster{Name: "west", Kind: "Singularity", URL: srv.URL}
+	d, err := sous.NewClusterDriver(c, &sous.SharedConfig{DockerRegistry: "docker.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Health(); err != nil {
+		t.Error(err)
+	}
+	if desc := d.Describe(); desc != "Singularity at "+srv.URL {
+		t.Errorf("got description %q", desc)
+	}
+	srv.Close()
+	if err := d.Health(); err == nil {
+		t.Error("got nil error from a stopped server")
+	}
+}
@@ -0,0 +1,172 @@
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory stand-in for a Singularity server, for tests and local
+// development. It models the endpoints used by Client, and validates requests
+// as Singularity does, but deploys complete immediately, and no tasks run.
+// Serve it with net/http/httptest.
+type Fake struct {
+	sync.Mutex
+	// Requests are the requests in the cluster, keyed by ID. Their active
+	// deploys are always set.
+	Requests map[string]*RequestParent
+}
+
+// NewFake returns a Fake with no requests.
+func NewFake() *Fake {
+	return &Fake{Requests: map[string]*RequestParent{}}
+}
+
+// fakeError is an error response from Fake.
+type fakeError struct {
+	status  int
+	message string
+}
+
+func fakeErrorf(status int, format string, a ...interface{}) *fakeError {
+	return &fakeError{status, fmt.Sprintf(format, a...)}
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	v, ferr := f.route(r)
+	if ferr != nil {
+		http.Error(w, ferr.message, ferr.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if v == nil {
+		v = struct{}{}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *Fake) route(r *http.Request) (interface{}, *fakeError) {
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	switch {
+	case path == "/state" && r.Method == "GET":
+		return f.state(), nil
+	case path == "/requests" && r.Method == "GET":
+		return f.list(), nil
+	case path == "/requests" && r.Method == "POST":
+		req := Request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, fakeErrorf(400, "invalid request: %s", err)
+		}
+		return f.saveRequest(req)
+	case path == "/deploys" && r.Method == "POST":
+		dr := deployRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&dr); err != nil {
+			return nil, fakeErrorf(400, "invalid deploy: %s", err)
+		}
+		return f.deploy(dr.Deploy)
+	case strings.HasPrefix(path, "/requests/request/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "/requests/request/"), "/", 2)
+		p, ok := f.Requests[parts[0]]
+		if !ok {
+			return nil, fakeErrorf(404, "no request with id %s", parts[0])
+		}
+		action := ""
+		if len(parts) == 2 {
+			action = parts[1]
+		}
+		return f.requestAction(p, r, action)
+	}
+	return nil, fakeErrorf(404, "not found")
+}
+
+func (f *Fake) state() State {
+	s := State{}
+	for _, p := range f.Requests {
+		if p.State == StatePaused {
+			s.PausedRequests++
+		} else {
+			s.ActiveRequests++
+		}
+	}
+	return s
+}
+
+func (f *Fake) list() []RequestParent {
+	ids := make([]string, 0, len(f.Requests))
+	for id := range f.Requests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]RequestParent, len(ids))
+	for i, id := range ids {
+		p := f.Requests[id]
+		list[i] = RequestParent{Request: p.Request, State: p.State}
+	}
+	return list
+}
+
+func (f *Fake) saveRequest(req Request) (interface{}, *fakeError) {
+	if req.ID == "" || req.RequestType == "" {
+		return nil, fakeErrorf(400, "id and requestType are required")
+	}
+	if req.Instances < 1 {
+		return nil, fakeErrorf(400, "instances must be at least 1")
+	}
+	if p, ok := f.Requests[req.ID]; ok {
+		p.Request = req
+		return p, nil
+	}
+	p := &RequestParent{Request: req, State: StateActive}
+	f.Requests[req.ID] = p
+	return p, nil
+}
+
+func (f *Fake) deploy(d Deploy) (interface{}, *fakeError) {
+	p, ok := f.Requests[d.RequestID]
+	if !ok {
+		return nil, fakeErrorf(400, "no request with id %s", d.RequestID)
+	}
+	if d.ID == "" || d.ContainerInfo.Docker.Image == "" {
+		return nil, fakeErrorf(400, "deploy id and docker image are required")
+	}
+	if p.ActiveDeploy != nil && p.ActiveDeploy.ID == d.ID {
+		return nil, fakeErrorf(409, "deploy %s already exists", d.ID)
+	}
+	p.ActiveDeploy = &d
+	return p, nil
+}
+
+func (f *Fake) requestAction(p *RequestParent, r *http.Request, action string) (interface{}, *fakeError) {
+	switch {
+	case action == "" && r.Method == "GET":
+		return p, nil
+	case action == "" && r.Method == "DELETE":
+		delete(f.Requests, p.Request.ID)
+		return p, nil
+	case action == "scale" && r.Method == "PUT":
+		s := scaleRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.Instances < 1 {
+			return nil, fakeErrorf(400, "instances must be at least 1")
+		}
+		p.Request.Instances = s.Instances
+		return p, nil
+	case action == "pause" && r.Method == "POST":
+		if p.State == StatePaused {
+			return nil, fakeErrorf(409, "request %s is already paused", p.Request.ID)
+		}
+		p.State = StatePaused
+		return p, nil
+	case action == "unpause" && r.Method == "POST":
+		if p.State != StatePaused {
+			return nil, fakeErrorf(409, "request %s is not paused", p.Request.ID)
+		}
+		p.State = StateActive
+		return p, nil
+	}
+	return nil, fakeErrorf(405, "method not allowed")
+}
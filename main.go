@@ -18,6 +18,9 @@ func main() {
 	}
 
 	result := c.Invoke(os.Args)
+	if err := c.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 
 	//panicking = false
 	os.Exit(result.ExitCode())
@@ -37,7 +40,7 @@ func handlePanic(panicking *bool) {
 	if !*panicking || os.Getenv("DEBUG") == "YES" {
 		return
 	}
-	fmt.Println(panicMessage)
+	fmt.Print(panicMessage, "\n")
 	fmt.Printf("Sous Version: %s\n\n", Version)
 }
 
@@ -0,0 +1,78 @@
+package server
+
+import "github.com/opentable/sous/sous"
+
+type (
+	// API is the data published by a Sous server. It is implemented by
+	// Client, which fetches it from a server, and by Local, which reads it
+	// from local files, so that everything the server provides is also
+	// available without one.
+	API interface {
+		// SharedConfig returns the organisation's shared configuration.
+		SharedConfig() (*sous.SharedConfig, error)
+		// Clusters returns the clusters in the shared configuration.
+		Clusters() (sous.Clusters, error)
+		// GDM returns the Global Deployment Manifest.
+		GDM() (*sous.GDM, error)
+		// Applications returns the applications in the GDM.
+		Applications() (sous.Applications, error)
+		// Builds returns a record of the last build of each project, most
+		// recent first.
+		Builds() ([]*sous.BuildRecord, error)
+	}
+	// Local is an API which reads Sous State from a state file, and build
+	// records from a build state directory. It reads them afresh on each
+	// call.
+	Local struct {
+		// StateLocation is the location of Sous State, see
+		// sous.Config.StateLocation.
+		StateLocation string
+		// BuildState contains the build records. If it is nil, there are no
+		// builds.
+		BuildState *sous.BuildState
+	}
+)
+
+// SharedConfig implements API.
+func (l *Local) SharedConfig() (*sous.SharedConfig, error) {
+	s, err := sous.LoadState(l.StateLocation)
+	if err != nil {
+		return nil, err
+	}
+	return &s.Config, nil
+}
+
+// Clusters implements API.
+func (l *Local) Clusters() (sous.Clusters, error) {
+	sc, err := l.SharedConfig()
+	if err != nil {
+		return nil, err
+	}
+	return sc.Clusters, nil
+}
+
+// GDM implements API.
+func (l *Local) GDM() (*sous.GDM, error) {
+	s, err := sous.LoadState(l.StateLocation)
+	if err != nil {
+		return nil, err
+	}
+	return &s.GDM, nil
+}
+
+// Applications implements API.
+func (l *Local) Applications() (sous.Applications, error) {
+	gdm, err := l.GDM()
+	if err != nil {
+		return nil, err
+	}
+	return gdm.Applications, nil
+}
+
+// Builds implements API.
+func (l *Local) Builds() ([]*sous.BuildRecord, error) {
+	if l.BuildState == nil {
+		return []*sous.BuildRecord{}, nil
+	}
+	return l.BuildState.All()
+}
@@ -0,0 +1,264 @@
+// Package server contains the client for, and implementation of, the Sous
+// server.
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opentable/sous/sous"
+)
+
+type (
+	// Client fetches data from a Sous server. It caches each response on
+	// disk, revalidating it with the server on each request, so that cached
+	// data can be used when the server cannot be reached.
+	Client struct {
+		// BaseURL is the URL of the Sous server.
+		BaseURL string
+		// CacheDir is the directory where responses are cached. If it is
+		// empty, nothing is cached.
+		CacheDir string
+		// HTTP is the client used to make requests.
+		HTTP *http.Client
+		// Warn is called, if it is not nil, when cached data is used because
+		// the server could not be reached.
+		Warn func(string)
+		// Messenger, if it is not nil, is sent a debug message about each
+		// request, in a new span, which is passed to the server in the
+		// TraceParentHeader so that it can continue the trace.
+		Messenger *sous.Messenger
+	}
+	// CacheStatus describes where the data returned by Client.Get came from.
+	CacheStatus int
+	// cacheMeta is stored alongside each cached response.
+	cacheMeta struct {
+		URL, ETag, LastModified string
+		Fetched                 time.Time
+	}
+)
+
+const (
+	// Fetched means the data was fetched from the server.
+	Fetched CacheStatus = iota
+	// Revalidated means the server confirmed that the cached data is current.
+	Revalidated
+	// Offline means the server could not be reached, or failed, so the cached
+	// data was used. It may be out of date.
+	Offline
+)
+
+// DefaultTimeout is the timeout of requests made by clients created by
+// NewClient.
+const DefaultTimeout = 10 * time.Second
+
+// NewClient returns a client for the Sous server at baseURL, which caches
+// responses in cacheDir.
+func NewClient(baseURL, cacheDir string) *Client {
+	return &Client{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		CacheDir: cacheDir,
+		HTTP:     &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+func (s CacheStatus) String() string {
+	switch s {
+	case Fetched:
+		return "fetched"
+	case Revalidated:
+		return "revalidated"
+	case Offline:
+		return "offline"
+	}
+	return fmt.Sprintf("CacheStatus(%d)", int(s))
+}
+
+// SharedConfig implements API by fetching /config.
+func (c *Client) SharedConfig() (*sous.SharedConfig, error) {
+	sc := &sous.SharedConfig{}
+	_, err := c.Get("/config", sc)
+	return sc, err
+}
+
+// Clusters implements API by fetching /clusters.
+func (c *Client) Clusters() (sous.Clusters, error) {
+	cs := sous.Clusters{}
+	_, err := c.Get("/clusters", &cs)
+	return cs, err
+}
+
+// GDM implements API by fetching /gdm.
+func (c *Client) GDM() (*sous.GDM, error) {
+	gdm := &sous.GDM{}
+	_, err := c.Get("/gdm", gdm)
+	return gdm, err
+}
+
+// Applications implements API by fetching /applications.
+func (c *Client) Applications() (sous.Applications, error) {
+	as := sous.Applications{}
+	_, err := c.Get("/applications", &as)
+	return as, err
+}
+
+// Builds implements API by fetching /builds.
+func (c *Client) Builds() ([]*sous.BuildRecord, error) {
+	bs := []*sous.BuildRecord{}
+	_, err := c.Get("/builds", &bs)
+	return bs, err
+}
+
+// Get fetches the JSON document at path on the server, and unmarshals it into
+// v. If a cached copy exists, the request is conditional on its ETag and
+// Last-Modified time. If the server cannot be reached, or responds with a
+// server error, Get uses the cached copy, and returns Offline. It is an error
+// if there is no cached copy in that case.
+func (c *Client) Get(path string, v interface{}) (CacheStatus, error) {
+	url := c.BaseURL + path
+	body, meta, cacheErr := c.readCache(url)
+	cached := cacheErr == nil
+	offline := func(err error) (CacheStatus, error) {
+		if !cached {
+			return Offline, fmt.Errorf("fetching %s: %s (and no cached copy is available)", url, err)
+		}
+		if c.Warn != nil {
+			c.Warn(fmt.Sprintf("using copy of %s cached at %s: %s",
+				url, meta.Fetched.Format(time.RFC3339), err))
+		}
+		return Offline, unmarshal(url, body, v)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Fetched, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	var span *sous.Messenger
+	if c.Messenger != nil {
+		span = c.Messenger.Child("GET "+path, sous.Fields{"http.method": "GET", "http.url": url})
+		req.Header.Set(TraceParentHeader, span.Span.TraceParent())
+	}
+	start := time.Now()
+	resp, err := c.HTTP.Do(req)
+	if span != nil {
+		traceResponse(span, resp, err, time.Since(start))
+	}
+	if err != nil {
+		return offline(err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		return Revalidated, unmarshal(url, body, v)
+	case resp.StatusCode >= 500:
+		return offline(fmt.Errorf("server responded %s%s", resp.Status, errorMessage(resp)))
+	case resp.StatusCode != http.StatusOK:
+		return Fetched, fmt.Errorf("fetching %s: server responded %s%s", url, resp.Status, errorMessage(resp))
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return offline(err)
+	}
+	if err := unmarshal(url, body, v); err != nil {
+		return Fetched, err
+	}
+	return Fetched, c.writeCache(body, cacheMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	})
+}
+
+// traceResponse sends m a debug message about the response to a request, or
+// the error making it, which took d.
+func traceResponse(m *sous.Messenger, resp *http.Response, err error, d time.Duration) {
+	m = m.With(sous.Fields{"duration_ms": d.Seconds() * 1000})
+	if err != nil {
+		m.With(sous.Fields{"error": err}).Debugf("%s failed: %s", m.Span.Name, err)
+		return
+	}
+	m.With(sous.Fields{"http.status_code": resp.StatusCode}).Debugf("%s responded %s", m.Span.Name, resp.Status)
+}
+
+// errorMessage returns the error message in resp, if it has one, formatted to
+// follow its status.
+func errorMessage(resp *http.Response) string {
+	e := errorResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return ""
+	}
+	return ": " + e.Error
+}
+
+func unmarshal(url string, body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("reading %s: %s", url, err)
+	}
+	return nil
+}
+
+// cachePath returns the path of the cached copy of url, without an extension.
+func (c *Client) cachePath(url string) string {
+	return filepath.Join(c.CacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+}
+
+func (c *Client) readCache(url string) ([]byte, cacheMeta, error) {
+	meta := cacheMeta{}
+	if c.CacheDir == "" {
+		return nil, meta, fmt.Errorf("no cache dir")
+	}
+	path := c.cachePath(url)
+	b, err := ioutil.ReadFile(path + ".meta.json")
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, meta, err
+	}
+	body, err := ioutil.ReadFile(path + ".json")
+	return body, meta, err
+}
+
+// writeCache stores body and meta. The body is written first, so that a
+// partial write never leaves stale data with a current ETag.
+func (c *Client) writeCache(body []byte, meta cacheMeta) error {
+	if c.CacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		return err
+	}
+	m, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.cachePath(meta.URL)
+	if err := writeFileAtomic(path+".json", body); err != nil {
+		return err
+	}
+	return writeFileAtomic(path+".meta.json", m)
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
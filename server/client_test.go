@@ -0,0 +1,87 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/opentable/sous/sous"
+)
+
+func TestClient_Get(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := `{"Clusters": [{"Name": "a", "Kind": "singularity"}], "Buildpacks": ["golang"]}`
+	etag := `"1"`
+	failing := false
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/config" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	c := NewClient(srv.URL+"/", dir)
+	var warnings []string
+	c.Warn = func(m string) { warnings = append(warnings, m) }
+
+	expectStatus := func(expected CacheStatus, clusters int) {
+		sc := &sous.SharedConfig{}
+		status, err := c.Get("/config", sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != expected {
+			t.Errorf("got status %s; want %s", status, expected)
+		}
+		if len(sc.Clusters) != clusters || (clusters != 0 && sc.Clusters[0].Name != "a") {
+			t.Errorf("unexpected shared config: %+v", sc)
+		}
+	}
+	expectStatus(Fetched, 1)
+	expectStatus(Revalidated, 1)
+
+	body, etag = `{"Clusters": [{"Name": "a"}, {"Name": "b"}]}`, `"2"`
+	expectStatus(Fetched, 2)
+
+	failing = true
+	expectStatus(Offline, 2)
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %q; want 1 warning", warnings)
+	}
+
+	srv.Close()
+	expectStatus(Offline, 2)
+	if requests != 4 {
+		t.Errorf("got %d requests; want 4", requests)
+	}
+
+	if _, err := c.Get("/other", &struct{}{}); err == nil {
+		t.Errorf("got nil error fetching uncached path while offline")
+	}
+}
+
+func TestClient_Get_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	c := NewClient(srv.URL, "")
+	if _, err := c.Get("/nope", &struct{}{}); err == nil {
+		t.Errorf("got nil error for 404 response")
+	}
+}
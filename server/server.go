@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/opentable/sous/sous"
+)
+
+type (
+	// Server serves the data provided by an API as JSON over HTTP.
+	Server struct {
+		// API provides the data to serve.
+		API API
+		// Log is called, if it is not nil, with a line describing each
+		// request.
+		Log func(string)
+		// Messenger, if it is not nil, is sent an info message about each
+		// request, in a new span. If the request has a TraceParentHeader, the
+		// span continues the client's trace.
+		Messenger *sous.Messenger
+	}
+	// endpoint returns the data served at a single path.
+	endpoint func(API) (interface{}, error)
+	// errorResponse is the body of error responses.
+	errorResponse struct {
+		Error string
+	}
+)
+
+// TraceParentHeader is the W3C Trace Context header which carries the span of
+// the client making a request, see sous.Span.TraceParent.
+const TraceParentHeader = "traceparent"
+
+// endpoints maps each path served to the API method providing its data. Each
+// of them has a matching Client method.
+var endpoints = map[string]endpoint{
+	"/config":       func(a API) (interface{}, error) { return a.SharedConfig() },
+	"/clusters":     func(a API) (interface{}, error) { return a.Clusters() },
+	"/gdm":          func(a API) (interface{}, error) { return a.GDM() },
+	"/applications": func(a API) (interface{}, error) { return a.Applications() },
+	"/builds":       func(a API) (interface{}, error) { return a.Builds() },
+}
+
+// ServeHTTP serves the endpoint at r.URL.Path. Responses have an ETag, and
+// requests with a matching If-None-Match header get 304 Not Modified.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := s.serve(w, r)
+	line := fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status)
+	if s.Log != nil {
+		s.Log(line)
+	}
+	if s.Messenger != nil {
+		s.Messenger.Join(r.Header.Get(TraceParentHeader), r.Method+" "+r.URL.Path).With(sous.Fields{
+			"http.method":      r.Method,
+			"http.path":        r.URL.Path,
+			"http.status_code": status,
+			"duration_ms":      time.Since(start).Seconds() * 1000,
+		}).Infof("%s", line)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) int {
+	e, ok := endpoints[r.URL.Path]
+	if !ok {
+		return writeError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		return writeError(w, http.StatusMethodNotAllowed, "%s only supports GET", r.URL.Path)
+	}
+	v, err := e(s.API)
+	if err != nil {
+		return writeError(w, http.StatusInternalServerError, "%s", err)
+	}
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return writeError(w, http.StatusInternalServerError, "%s", err)
+	}
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(body))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+	return http.StatusOK
+}
+
+func writeError(w http.ResponseWriter, status int, format string, v ...interface{}) int {
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(errorResponse{fmt.Sprintf(format, v...)})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+	return status
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentable/sous/sous"
+	"github.com/opentable/sous/util/cmdr"
+)
+
+const testState = `
+Config:
+  Clusters:
+  - Name: us-west-1
+    Kind: singularity
+    URL: http://singularity.example.com
+  Buildpacks: [golang]
+GDM:
+  Applications:
+  - Source:
+      RepoURL: github.com/opentable/example
+`
+
+func newTestServer(t *testing.T) (*Local, *httptest.Server, func()) {
+	dir, err := ioutil.TempDir("", "sous-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(dir, "state.yaml")
+	if err := ioutil.WriteFile(state, []byte(testState), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := sous.NewBuildState(sous.Config{BuildStateDir: filepath.Join(dir, "builds")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"old", "new"} {
+		r := &sous.BuildRecord{RootDir: name, Time: time.Unix(int64(i), 0).UTC()}
+		if err := bs.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local := &Local{StateLocation: state, BuildState: bs}
+	srv := httptest.NewServer(&Server{API: local})
+	return local, srv, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// TestServer_Parity checks that every endpoint returns the same data through
+// Client as Local returns directly.
+func TestServer_Parity(t *testing.T) {
+	local, srv, done := newTestServer(t)
+	defer done()
+	client := NewClient(srv.URL, "")
+
+	for path, call := range endpoints {
+		expected, err := call(local)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		actual, err := call(client)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: got %#v; want %#v", path, actual, expected)
+		}
+	}
+
+	clusters, _ := client.Clusters()
+	if len(clusters) != 1 || clusters[0].Name != "us-west-1" {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+	builds, _ := client.Builds()
+	if len(builds) != 2 || builds[0].RootDir != "new" {
+		t.Errorf("builds not most recent first: %+v", builds)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	local, srv, done := newTestServer(t)
+	defer done()
+
+	resp, err := http.Get(srv.URL + "/gdm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/gdm", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	expectStatus(t, req, http.StatusNotModified)
+
+	req, _ = http.NewRequest("GET", srv.URL+"/nope", nil)
+	expectStatus(t, req, http.StatusNotFound)
+	req, _ = http.NewRequest("POST", srv.URL+"/gdm", nil)
+	expectStatus(t, req, http.StatusMethodNotAllowed)
+
+	local.StateLocation = filepath.Join(filepath.Dir(local.StateLocation), "missing.yaml")
+	_, err = NewClient(srv.URL, "").GDM()
+	if err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("got error %v; want the server's error message", err)
+	}
+}
+
+func expectStatus(t *testing.T, req *http.Request, status int) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Errorf("%s %s: got status %d; want %d", req.Method, req.URL.Path, resp.StatusCode, status)
+	}
+}
+
+// TestServer_Trace checks that requests made by a client with a Messenger are
+// reported by the server in a child of the client's span.
+func TestServer_Trace(t *testing.T) {
+	_, srv, done := newTestServer(t)
+	defer done()
+	sink := sous.NewMemorySink()
+	m := sous.NewMessenger("test")
+	m.AddSink(sink, cmdr.Debug)
+	srv.Config.Handler.(*Server).Messenger = m.Child("server", nil)
+	client := NewClient(srv.URL, "")
+	client.Messenger = m
+
+	if _, err := client.GDM(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ms := sink.Messages()
+	if len(ms) != 2 {
+		t.Fatalf("got %d messages; want one from the server, and one from the client", len(ms))
+	}
+	// The server sets http.path, and the client http.url.
+	serverMessage, clientMessage := ms[0], ms[1]
+	if _, ok := serverMessage.Fields()["http.path"]; !ok {
+		serverMessage, clientMessage = clientMessage, serverMessage
+	}
+	if serverMessage.Span().ParentID != clientMessage.Span().ID || serverMessage.Span().TraceID != m.Span.TraceID {
+		t.Errorf("server span %+v is not a child of client span %+v", serverMessage.Span(), clientMessage.Span())
+	}
+	if serverMessage.Fields()["http.status_code"] != 200 || clientMessage.Fields()["http.status_code"] != 200 {
+		t.Errorf("got fields %v and %v; want status codes", serverMessage.Fields(), clientMessage.Fields())
+	}
+}
@@ -1,13 +1,113 @@
 package sous
 
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/samsalisbury/semv"
+)
+
 type (
+	// Applications is a list of applications, sorted by their source.
 	Applications []Application
-	Application  struct {
+	// Application is a single deployable application.
+	Application struct {
+		// Source identifies the source code of this application.
 		Source Source
+		// Deployments are the deployments of this application, keyed by
+		// the name of the cluster they are deployed to.
+		Deployments Deployments `yaml:",omitempty"`
 	}
+	// Source identifies the source code of an application: a directory in a
+	// repository.
 	Source struct {
+		// RepoURL is the URL of the repository.
 		RepoURL RepoURL
-		RepoDir string
+		// RepoDir is the directory within the repository, it is empty for
+		// the repository root.
+		RepoDir string `yaml:",omitempty"`
 	}
+	// RepoURL is the URL of a source code repository.
 	RepoURL string
 )
+
+func (s Source) String() string {
+	if s.RepoDir == "" {
+		return string(s.RepoURL)
+	}
+	return string(s.RepoURL) + "," + s.RepoDir
+}
+
+func (as Applications) Len() int      { return len(as) }
+func (as Applications) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
+func (as Applications) Less(i, j int) bool {
+	a, b := as[i].Source, as[j].Source
+	if a.RepoURL != b.RepoURL {
+		return a.RepoURL < b.RepoURL
+	}
+	return a.RepoDir < b.RepoDir
+}
+
+var repoURLScheme = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://`)
+
+// Path returns u as a relative, slash-separated path, for use in file names,
+// e.g. both git@github.com:opentable/sous.git and
+// https://github.com/opentable/sous become github.com/opentable/sous. It
+// returns an error if u cannot be made into a path.
+func (u RepoURL) Path() (string, error) {
+	p := repoURLScheme.ReplaceAllString(string(u), "")
+	if i := strings.Index(p, "@"); i != -1 && i < strings.IndexAny(p+"/", ":/") {
+		p = p[i+1:]
+	}
+	p = strings.TrimSuffix(strings.Replace(p, ":", "/", 1), ".git")
+	clean := path.Clean(p)
+	if p == "" || clean != p || strings.HasPrefix(clean, "../") || clean == ".." {
+		return "", fmt.Errorf("repo URL %q cannot be used as a path", u)
+	}
+	return clean, nil
+}
+
+// ImageName returns the docker repository name for images built from s. It is
+// the last element of the repository's path, followed by RepoDir, if any, e.g.
+// "sous-cli" for github.com/opentable/sous,cli.
+func (s Source) ImageName() string {
+	p, err := s.RepoURL.Path()
+	if err != nil {
+		p = string(s.RepoURL)
+	}
+	return imageName(path.Base(p), s.RepoDir)
+}
+
+// imageName returns a docker repository name made of repo, followed by dir if
+// it is not the repository root, with any characters docker does not allow
+// replaced.
+func imageName(repo, dir string) string {
+	name := repo
+	if dir != "" && dir != "." {
+		name += "-" + dir
+	}
+	name = invalidImageNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-._")
+}
+
+// ImageRef returns the full name of the image for version of s, in registry,
+// e.g. docker.example.com/sous:1.0.0. If registry is empty, the image name
+// has no registry.
+func ImageRef(registry string, s Source, version string) (string, error) {
+	v, err := semv.ParseExactSemver2(version)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid version %q: %s", s, version, err)
+	}
+	return imageRef(registry, s.ImageName(), DockerTag(v)), nil
+}
+
+// imageRef returns the image named name:tag, in registry if it is not empty.
+func imageRef(registry, name, tag string) string {
+	ref := name + ":" + tag
+	if registry != "" {
+		ref = strings.TrimSuffix(registry, "/") + "/" + ref
+	}
+	return ref
+}
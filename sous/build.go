@@ -1,26 +1,95 @@
 package sous
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/opentable/sous/ext/docker"
 	"github.com/opentable/sous/util/shell"
 )
 
 type (
 	Build struct {
-		Source                    SourceContext
+		Context                   *BuildContext
 		SourceShell, ScratchShell *shell.Sh
+		// Plan describes the images this build produces. If it is nil,
+		// Start uses DefaultBuildPlan.
+		Plan *BuildPlan
+		// Registry is the docker registry the app image is named for, as by
+		// ImageRef, so that it can be pushed there. It is not pushed by the
+		// build.
+		Registry string
 	}
+	// BuildTarget contributes instructions to the Dockerfiles of a build.
 	BuildTarget interface {
-		BuildImage()
-		BuildContainer()
+		// BuildImage adds instructions to the compile Dockerfile, which
+		// builds the image used to perform the build. The compile container
+		// must leave its artefacts in the BuildPlan's ArtefactDir.
+		BuildImage(*BuildContext, *docker.File) error
+		// BuildContainer adds instructions to the app Dockerfile, which
+		// builds the image that runs the artefacts.
+		BuildContainer(*BuildContext, *docker.File) error
 	}
+	// BuildPlan describes the two images produced by a build. The compile
+	// image contains the source code and any build-time dependencies, it is
+	// run once to produce artefacts. The app image packages those artefacts
+	// ready for deployment, and contains no build-time dependencies.
+	BuildPlan struct {
+		// Compile is the Dockerfile for the compile image. The source code is
+		// available in the build context at CompileSourceDir.
+		Compile docker.File
+		// ArtefactDir is the directory inside the compile container where
+		// the compile step leaves its artefacts.
+		ArtefactDir string
+		// App is the Dockerfile for the app image. The artefacts copied out
+		// of the compile container are available in its build context at
+		// AppArtefactDir.
+		App docker.File
+		// Test is the command which runs the project's tests inside the
+		// compile image. It is empty if no buildpack knows how to.
+		Test []string
+	}
+)
+
+const (
+	// CompileSourceDir is the directory in the compile image's build context
+	// containing a copy of the tracked source files.
+	CompileSourceDir = "source"
+	// AppArtefactDir is the directory in the app image's build context
+	// containing the artefacts copied from the compile container.
+	AppArtefactDir = "artefacts"
 )
 
+// DefaultBuildPlan returns a plan for projects built with make. The compile
+// container runs make in a copy of the source code, with the variable
+// ARTEFACT_DIR set to the directory where it must leave its artefacts. These
+// must include an executable called run, which the app image runs.
+func DefaultBuildPlan() *BuildPlan {
+	p := &BuildPlan{ArtefactDir: "/artefacts"}
+	p.Compile.From = "buildpack-deps:jessie"
+	p.Compile.RUN("mkdir", "-p", p.ArtefactDir)
+	p.Compile.WORKDIR("/src")
+	p.Compile.COPY("/src/", CompileSourceDir+"/")
+	p.Compile.CMD("make", "ARTEFACT_DIR="+p.ArtefactDir)
+	p.App.From = "debian:jessie"
+	p.App.COPY("/srv/app/", AppArtefactDir+"/")
+	p.App.WORKDIR("/srv/app")
+	p.App.CMD("/srv/app/run")
+	return p
+}
+
 // NewBuild creates a new build using source code at sourceDir, and using
 // scratchDir as its temporary directory. You should ensure that scratchDir is
 // empty.
-func NewBuild(sourceDir, scratchDir string) (*Build, error) {
+func NewBuild(c *BuildContext, sourceDir, scratchDir string) (*Build, error) {
 	sourceShell, err := shell.DefaultInDir(sourceDir)
 	if err != nil {
 		return nil, err
@@ -29,14 +98,15 @@ func NewBuild(sourceDir, scratchDir string) (*Build, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewBuildWithShells(sourceShell, scratchShell)
+	return NewBuildWithShells(c, sourceShell, scratchShell)
 }
 
 // NewBuildWithShells creates a new build using source code in the working
 // directory of sourceShell, and using the working dir of scratchShell as
 // temporary storage.
-func NewBuildWithShells(sourceShell, scratchShell *shell.Sh) (*Build, error) {
+func NewBuildWithShells(c *BuildContext, sourceShell, scratchShell *shell.Sh) (*Build, error) {
 	b := &Build{
+		Context:      c,
 		SourceShell:  sourceShell,
 		ScratchShell: scratchShell,
 	}
@@ -50,14 +120,250 @@ func NewBuildWithShells(sourceShell, scratchShell *shell.Sh) (*Build, error) {
 	return b, nil
 }
 
-func (b *Build) Start() error {
-	b.createCompileImage()
-	panic("not implemented")
+// Start builds the named targets, and their dependencies, using the targets
+// returned by Targets. All docker commands are issued using ScratchShell.
+func (b *Build) Start(names []string, cache TargetCache, opts BuildOptions) (TargetResults, error) {
+	if b.Plan == nil {
+		b.Plan = DefaultBuildPlan()
+	}
+	d, err := docker.NewClient(b.ScratchShell.Clone())
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		cache = imageCache{cache, d}
+	}
+	return b.Targets(d).Build(names, cache, opts)
+}
+
+// Targets returns the targets of this build:
+//
+//	compile builds the compile image from the source code.
+//	app runs the compile image, and builds the app image from its artefacts.
+//	test runs the project's tests inside the compile image.
+func (b *Build) Targets(d *docker.Client) Targets {
+	name, tag := b.ImageName(), b.ImageTag()
+	compileImage := fmt.Sprintf("%s-compile:%s", name, tag)
+	appImage := imageRef(b.Registry, name, tag)
+	return Targets{
+		"compile": {
+			Name: "compile",
+			Inputs: func() (string, error) {
+				return b.compileInputs(compileImage)
+			},
+			Build: func(TargetResults) (string, error) {
+				return compileImage, b.createCompileImage(d, compileImage)
+			},
+		},
+		"app": {
+			Name:      "app",
+			DependsOn: []string{"compile"},
+			Inputs: func() (string, error) {
+				return b.imageInputs(appImage) + b.Plan.ArtefactDir + "\n" +
+					b.Plan.App.String(), nil
+			},
+			Build: func(deps TargetResults) (string, error) {
+				if err := b.extractArtefacts(d, deps["compile"].Image); err != nil {
+					return "", err
+				}
+				return appImage, b.createAppImage(d, appImage)
+			},
+		},
+		"test": {
+			Name:      "test",
+			DependsOn: []string{"compile"},
+			Inputs: func() (string, error) {
+				return strings.Join(b.Plan.Test, " "), nil
+			},
+			Build: func(deps TargetResults) (string, error) {
+				image := deps["compile"].Image
+				return image, b.runTests(d, image)
+			},
+		},
+	}
+}
+
+// imageInputs describes image, and the labels applied to it, apart from the
+// build time, which differs every build. Including them in a target's inputs
+// means that a new tag or revision is built, rather than found in the cache
+// under its old name.
+func (b *Build) imageInputs(image string) string {
+	labels := Labels(b.Context, time.Time{})
+	delete(labels, LabelPrefix+LabelBuildTime)
+	return fmt.Sprintf("%s\n%s\n", image,
+		strings.Join(docker.KeyValueArgs(labels).Flatten(), "\n"))
+}
+
+// compileInputs describes image, the compile Dockerfile and the contents of
+// all tracked files.
+func (b *Build) compileInputs(image string) (string, error) {
+	hashes, err := hashFiles(b.SourceShell.Dir, b.Context.Source.Files)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(hashes))
+	for p := range hashes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	buf := &bytes.Buffer{}
+	buf.WriteString(b.imageInputs(image))
+	buf.WriteString(b.Plan.Compile.String())
+	for _, p := range paths {
+		fmt.Fprintf(buf, "%s %s\n", hashes[p], p)
+	}
+	return buf.String(), nil
+}
+
+// createCompileImage copies all tracked source files to the scratch dir,
+// alongside the compile Dockerfile, and builds the compile image.
+func (b *Build) createCompileImage(d *docker.Client, tag string) error {
+	dir := b.scratchPath("compile")
+	sourceDir := filepath.Join(dir, CompileSourceDir)
+	for _, f := range b.Context.Source.Files {
+		src := filepath.Join(b.SourceShell.Dir, f)
+		err := copyFile(src, filepath.Join(sourceDir, f))
+		// Tracked files deleted from the working tree are not copied.
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := writeDockerfile(dir, b.labelled(b.Plan.Compile)); err != nil {
+		return err
+	}
+	return d.Build(dir, tag)
+}
+
+// extractArtefacts runs the compile image, and copies its artefacts into the
+// app image's build context.
+func (b *Build) extractArtefacts(d *docker.Client, image string) error {
+	dir := filepath.Join(b.scratchPath("app"), AppArtefactDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	container := containerName(image, "compile")
+	defer d.Remove(container)
+	if err := d.Run(container, image); err != nil {
+		return err
+	}
+	return d.CopyFrom(container, b.Plan.ArtefactDir+"/.", dir)
+}
+
+// createAppImage builds the app image from the extracted artefacts.
+func (b *Build) createAppImage(d *docker.Client, tag string) error {
+	dir := b.scratchPath("app")
+	if err := writeDockerfile(dir, b.labelled(b.Plan.App)); err != nil {
+		return err
+	}
+	return d.Build(dir, tag)
+}
+
+// runTests runs the plan's test command inside the compile image.
+func (b *Build) runTests(d *docker.Client, image string) error {
+	if len(b.Plan.Test) == 0 {
+		return fmt.Errorf("none of the buildpacks for this project can run its tests")
+	}
+	container := containerName(image, "test")
+	defer d.Remove(container)
+	return d.Run(container, image, b.Plan.Test...)
+}
+
+// labelled returns a copy of f with the labels describing this build added.
+func (b *Build) labelled(f docker.File) docker.File {
+	return labelled(b.Context, f, time.Now())
+}
+
+// Dockerfiles returns the compile and app Dockerfiles of this plan, keyed by
+// target name, as they would be built in c.
+func (p *BuildPlan) Dockerfiles(c *BuildContext) map[string]docker.File {
+	now := time.Now()
+	return map[string]docker.File{
+		"compile": labelled(c, p.Compile, now),
+		"app":     labelled(c, p.App, now),
+	}
+}
+
+// labelled returns a copy of f with labels describing c added.
+func labelled(c *BuildContext, f docker.File, buildTime time.Time) docker.File {
+	f.Instructions = append(docker.Instructions{}, f.Instructions...)
+	f.LABEL(Labels(c, buildTime))
+	return f
+}
+
+// imageCache is a TargetCache which only reports images as cached if they
+// still exist in docker.
+type imageCache struct {
+	TargetCache
+	docker *docker.Client
+}
+
+func (c imageCache) Cached(name, digest string) (string, bool) {
+	image, ok := c.TargetCache.Cached(name, digest)
+	return image, ok && c.docker.ImageExists(image)
+}
+
+// containerName returns a unique name for a container running image.
+func containerName(image, purpose string) string {
+	name := invalidImageNameChars.ReplaceAllString(image, "-")
+	return fmt.Sprintf("%s-%s-%d", name, purpose, time.Now().UnixNano())
+}
+
+var invalidImageNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// ImageName returns the docker repository name for images built from this
+// source code, the same as that of its Source, see Source.ImageName. If the
+// repository has no remote, the name of its root directory is used instead.
+func (b *Build) ImageName() string {
+	s := b.Context.Source
+	if s.RemoteURL == "" {
+		return imageName(filepath.Base(s.RootDir), s.OffsetDir)
+	}
+	return s.Source().ImageName()
+}
+
+// ImageTag returns the docker tag for images built from this source code,
+// which is derived from its version. See SourceContext.Version.
+func (b *Build) ImageTag() string {
+	return DockerTag(b.Context.Source.Version())
+}
+
+func (b *Build) scratchPath(name string) string {
+	return filepath.Join(b.ScratchShell.Dir, name)
+}
+
+// writeDockerfile validates f, and writes it to dir.
+func writeDockerfile(dir string, f docker.File) error {
+	if err := f.Validate(); err != nil {
+		return fmt.Errorf("invalid Dockerfile: %s", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "Dockerfile")
+	return ioutil.WriteFile(path, []byte(f.String()), 0644)
 }
 
-func (b *Build) createCompileImage() {
-	// In the scratch dir:
-	//   1. Copy all source files here.
-	//   2. Make a new dir, add the scripts.
-	//   3. Write the Dockerfile to the scratch dir
+// copyFile copies the file at src to dest, creating any missing directories.
+func copyFile(src, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
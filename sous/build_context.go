@@ -10,6 +10,8 @@ type (
 		Machine Machine
 		User    user.User
 		Changes Changes
+		// SousVersion is the version of Sous performing the build.
+		SousVersion string
 	}
 	// ScratchContext represents an isolated copy of a project's source code
 	// somewhere on the host machine running Sous.
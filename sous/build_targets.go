@@ -0,0 +1,228 @@
+package sous
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/opentable/sous/util/parallel"
+)
+
+type (
+	// Target is a named step in a build. Targets may depend on other targets,
+	// and are only built once all their dependencies are built.
+	Target struct {
+		// Name is the name of this target, e.g. "compile".
+		Name string
+		// DependsOn is a list of the names of targets this target depends on.
+		DependsOn []string
+		// Inputs returns a description of everything this target is built
+		// from, apart from its dependencies. Targets whose inputs and
+		// dependencies are unchanged are not rebuilt.
+		Inputs func() (string, error)
+		// Build builds this target, and returns the name of the image it
+		// produced. It is passed the results of all its dependencies.
+		Build func(deps TargetResults) (string, error)
+	}
+	// Targets is a collection of targets keyed by name.
+	Targets map[string]*Target
+	// TargetResult is the result of building a single target.
+	TargetResult struct {
+		// Name is the name of the target.
+		Name string
+		// Digest identifies all the inputs of this target, including the
+		// digests of its dependencies.
+		Digest string
+		// Image is the image produced by this target.
+		Image string
+		// Cached is true if this target was not built, because an image with
+		// the same digest already existed.
+		Cached bool
+	}
+	// TargetResults is a collection of target results keyed by target name.
+	TargetResults map[string]*TargetResult
+	// TargetCache looks up images previously built for a target.
+	TargetCache interface {
+		// Cached returns the image built for the named target with the
+		// given digest, and true, if there is one.
+		Cached(name, digest string) (string, bool)
+	}
+	// BuildOptions modify how targets are built.
+	BuildOptions struct {
+		// Rebuild forces the requested targets to be built, even if they
+		// are cached.
+		Rebuild bool
+		// RebuildAll is similar to Rebuild, but also forces all transitive
+		// dependencies of the requested targets to be built.
+		RebuildAll bool
+	}
+	// targetBuild tracks the build of a single target within a call to
+	// Targets.Build, so that it is built at most once.
+	targetBuild struct {
+		once   sync.Once
+		result *TargetResult
+		err    error
+	}
+)
+
+// SortedKeys returns the names of these targets in alphabetical order.
+func (ts Targets) SortedKeys() []string {
+	keys := make([]string, 0, len(ts))
+	for k := range ts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate returns an error if any target depends on a target which does not
+// exist, or if there are any dependency cycles.
+func (ts Targets) Validate() error {
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		t, ok := ts[name]
+		if !ok {
+			return fmt.Errorf("target %q does not exist (required by %v)", name, path)
+		}
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %v", append(path, name))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, d := range t.DependsOn {
+			if err := visit(d, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, name := range ts.SortedKeys() {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build builds the named targets, and all their dependencies. Targets whose
+// digest is found in cache are not rebuilt, unless forced by opts. If cache is
+// nil, all targets are built. Targets which do not depend on each other are
+// built concurrently. It returns the results of all targets built or found in
+// the cache.
+func (ts Targets) Build(names []string, cache TargetCache, opts BuildOptions) (TargetResults, error) {
+	if err := ts.Validate(); err != nil {
+		return nil, err
+	}
+	forced := map[string]bool{}
+	for _, name := range names {
+		if _, ok := ts[name]; !ok {
+			return nil, fmt.Errorf("target %q does not exist", name)
+		}
+		if opts.Rebuild || opts.RebuildAll {
+			forced[name] = true
+		}
+		if opts.RebuildAll {
+			ts.addDependencies(name, forced)
+		}
+	}
+	builds := map[string]*targetBuild{}
+	for name := range ts {
+		builds[name] = &targetBuild{}
+	}
+	results := TargetResults{}
+	var mu sync.Mutex
+	var build func(name string) (*TargetResult, error)
+	build = func(name string) (*TargetResult, error) {
+		tb := builds[name]
+		tb.once.Do(func() {
+			tb.result, tb.err = ts.buildOne(ts[name], build, cache, forced[name])
+			if tb.err == nil {
+				mu.Lock()
+				results[name] = tb.result
+				mu.Unlock()
+			}
+		})
+		return tb.result, tb.err
+	}
+	if err := buildAll(names, build); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// buildOne builds a single target, once its dependencies have been built.
+func (ts Targets) buildOne(t *Target, build func(string) (*TargetResult, error),
+	cache TargetCache, force bool) (*TargetResult, error) {
+	deps := TargetResults{}
+	var mu sync.Mutex
+	err := buildAll(t.DependsOn, func(name string) (*TargetResult, error) {
+		r, err := build(name)
+		if err == nil {
+			mu.Lock()
+			deps[name] = r
+			mu.Unlock()
+		}
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest, err := t.digest(deps)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %s", t.Name, err)
+	}
+	r := &TargetResult{Name: t.Name, Digest: digest}
+	if cache != nil && !force {
+		if image, ok := cache.Cached(t.Name, digest); ok {
+			r.Image, r.Cached = image, true
+			return r, nil
+		}
+	}
+	if r.Image, err = t.Build(deps); err != nil {
+		return nil, fmt.Errorf("target %s: %s", t.Name, err)
+	}
+	return r, nil
+}
+
+// digest returns a hash of this target's name, inputs, and the digests of its
+// dependencies.
+func (t *Target) digest(deps TargetResults) (string, error) {
+	inputs := ""
+	if t.Inputs != nil {
+		var err error
+		if inputs, err = t.Inputs(); err != nil {
+			return "", err
+		}
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "target %s\n", t.Name)
+	for _, d := range t.DependsOn {
+		fmt.Fprintf(h, "depends on %s %s\n", d, deps[d].Digest)
+	}
+	io.WriteString(h, inputs)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// addDependencies adds all the transitive dependencies of name to set.
+func (ts Targets) addDependencies(name string, set map[string]bool) {
+	for _, d := range ts[name].DependsOn {
+		set[d] = true
+		ts.addDependencies(d, set)
+	}
+}
+
+// buildAll calls build concurrently for each name, returning the first error.
+func buildAll(names []string, build func(string) (*TargetResult, error)) error {
+	fs := make([]func(*error), len(names))
+	for i, name := range names {
+		name := name
+		fs[i] = func(err *error) { _, *err = build(name) }
+	}
+	return parallel.Do(fs...)
+}
@@ -0,0 +1,96 @@
+package sous
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// testTargets returns a graph where app and test both depend on compile, and
+// a record of which targets were built.
+func testTargets() (Targets, *[]string) {
+	var mu sync.Mutex
+	built := []string{}
+	target := func(name string, deps ...string) *Target {
+		return &Target{
+			Name:      name,
+			DependsOn: deps,
+			Inputs:    func() (string, error) { return "inputs of " + name, nil },
+			Build: func(TargetResults) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				built = append(built, name)
+				return name + "-image", nil
+			},
+		}
+	}
+	return Targets{
+		"compile": target("compile"),
+		"app":     target("app", "compile"),
+		"test":    target("test", "compile"),
+	}, &built
+}
+
+type testCache TargetResults
+
+func (c testCache) Cached(name, digest string) (string, bool) {
+	r, ok := c[name]
+	if !ok || r.Digest != digest {
+		return "", false
+	}
+	return r.Image, true
+}
+
+func TestTargetsBuild(t *testing.T) {
+	ts, built := testTargets()
+	results, err := ts.Build([]string{"app", "test"}, nil, BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBuilt(t, built, "app", "compile", "test")
+	if results["app"].Image != "app-image" {
+		t.Errorf("got app image %q; want %q", results["app"].Image, "app-image")
+	}
+
+	cases := []struct {
+		opts     BuildOptions
+		expected []string
+	}{
+		{BuildOptions{}, []string{}},
+		{BuildOptions{Rebuild: true}, []string{"app"}},
+		{BuildOptions{RebuildAll: true}, []string{"app", "compile"}},
+	}
+	for _, c := range cases {
+		ts, built := testTargets()
+		results, err := ts.Build([]string{"app"}, testCache(results), c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBuilt(t, built, c.expected...)
+		forced := c.opts.Rebuild || c.opts.RebuildAll
+		if results["app"].Cached == forced {
+			t.Errorf("%+v: got app cached %v; want %v", c.opts, !forced, forced)
+		}
+	}
+}
+
+func TestTargetsValidate(t *testing.T) {
+	ts, _ := testTargets()
+	ts["compile"].DependsOn = []string{"app"}
+	if err := ts.Validate(); err == nil {
+		t.Errorf("expected dependency cycle error")
+	}
+	ts["compile"].DependsOn = []string{"nonexistent"}
+	if err := ts.Validate(); err == nil {
+		t.Errorf("expected missing target error")
+	}
+}
+
+func assertBuilt(t *testing.T, built *[]string, expected ...string) {
+	actual := append([]string{}, *built...)
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got built targets %v; want %v", actual, expected)
+	}
+}
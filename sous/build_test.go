@@ -0,0 +1,154 @@
+package sous
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opentable/sous/util/shell"
+)
+
+// fakeDocker stands in for the docker binary. It reports a version, and
+// pretends to copy an executable called run out of containers.
+const fakeDocker = `#!/bin/sh
+case "$1" in
+	--version) echo "Docker version 1.11.1, build 5604cbe" ;;
+	cp) mkdir -p "$3" && touch "$3/run" ;;
+esac
+`
+
+func TestBuild_Start(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"bin/docker":     fakeDocker,
+		"app/Makefile":   "all:\n\tcp src/run.sh $(ARTEFACT_DIR)/run\n",
+		"app/src/run.sh": "#!/bin/sh\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scratch := filepath.Join(dir, "scratch")
+	if err := os.Mkdir(scratch, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	source := filepath.Join(dir, "app")
+	c := &BuildContext{Source: SourceContext{
+		RootDir:   source,
+		OffsetDir: ".",
+		Revision:  "0123456789abcdef",
+		// Tracked files deleted from the working tree are skipped.
+		Files: []string{"Makefile", "src/run.sh", "deleted.go"},
+	}}
+	b, err := NewBuild(c, source, scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := []string{}
+	b.ScratchShell.MonitorFuncs = append(b.ScratchShell.MonitorFuncs,
+		func(name string, args []string) {
+			commands = append(commands, name+" "+args[0])
+		})
+
+	results, err := b.Start([]string{"app"}, nil, BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := b.ImageName() + ":" + b.ImageTag(); results["app"].Image != expected {
+		t.Errorf("got app image %q; want %q", results["app"].Image, expected)
+	}
+	expected := []string{"docker --version", "docker build", "docker run",
+		"docker cp", "docker rm", "docker build"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("ran %q; want %q", commands, expected)
+	}
+	for _, f := range []string{"compile/source/src/run.sh", "app/artefacts/run"} {
+		if _, err := os.Stat(filepath.Join(scratch, f)); err != nil {
+			t.Error(err)
+		}
+	}
+	dockerfile, err := ioutil.ReadFile(filepath.Join(scratch, "compile", "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(dockerfile), "FROM buildpack-deps:jessie\n") {
+		t.Errorf("got compile Dockerfile:\n%s\nwant the default plan's", dockerfile)
+	}
+}
+
+func TestBuild_Targets_Inputs(t *testing.T) {
+	inputs := func(s SourceContext) map[string]string {
+		b := &Build{
+			Context:     &BuildContext{Source: s},
+			SourceShell: &shell.Sh{Dir: os.TempDir()},
+			Plan:        DefaultBuildPlan(),
+		}
+		m := map[string]string{}
+		for name, target := range b.Targets(nil) {
+			in, err := target.Inputs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[name] = in
+		}
+		return m
+	}
+	untagged := SourceContext{Revision: "0123456789abcdef", CommitsSinceSemverTag: 3}
+	if a, b := inputs(untagged), inputs(untagged); !reflect.DeepEqual(a, b) {
+		t.Errorf("inputs changed between builds of the same source:\n%v\n%v", a, b)
+	}
+	// Tagging the same revision must not return the untagged images.
+	tagged := untagged
+	tagged.NearestTagName, tagged.NearestSemverTagName = "v1.0.0", "v1.0.0"
+	tagged.CommitsSinceSemverTag = 0
+	before, after := inputs(untagged), inputs(tagged)
+	for _, name := range []string{"compile", "app"} {
+		if before[name] == after[name] {
+			t.Errorf("%s inputs unchanged after tagging v1.0.0", name)
+		}
+	}
+}
+
+func TestBuild_ImageName(t *testing.T) {
+	cases := []struct{ remote, root, offset, expected string }{
+		{"git@github.com:opentable/sous.git", "/src/checkout", ".", "sous"},
+		{"https://github.com/opentable/sous", "/src/checkout", "cli", "sous-cli"},
+		{"https://github.com/opentable/Sous", "/src/checkout", "cmd/sous", "sous-cmd-sous"},
+		{"", "/src/My Project", ".", "my-project"},
+	}
+	for _, c := range cases {
+		b := &Build{Registry: "docker.example.com", Context: &BuildContext{Source: SourceContext{
+			RemoteURL: c.remote, RootDir: c.root, OffsetDir: c.offset,
+			Revision: "0123456789abcdef",
+		}}}
+		if actual := b.ImageName(); actual != c.expected {
+			t.Errorf("%+v: got image name %q; want %q", c, actual, c.expected)
+		}
+		if c.remote == "" {
+			continue
+		}
+		s := b.Context.Source
+		ref, err := ImageRef(b.Registry, s.Source(), s.Version().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app := imageRef(b.Registry, b.ImageName(), b.ImageTag()); app != ref {
+			t.Errorf("%+v: built %q, but deployments use %q", c, app, ref)
+		}
+	}
+}
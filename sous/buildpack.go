@@ -0,0 +1,131 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/opentable/sous/ext/docker"
+)
+
+type (
+	// Buildpack is a BuildTarget which is able to detect whether or not it
+	// applies to a particular project.
+	Buildpack interface {
+		BuildTarget
+		// Detect returns true if this buildpack applies to the source code
+		// described by the SourceContext.
+		Detect(*SourceContext) (bool, error)
+	}
+	// Tester is implemented by buildpacks which know how to run a project's
+	// tests inside its compile image.
+	Tester interface {
+		// TestCommand returns the command which runs the tests.
+		TestCommand(*BuildContext) []string
+	}
+	// Buildpacks is a collection of buildpacks keyed by name.
+	Buildpacks map[string]Buildpack
+	// NoBuildpackError is returned when no buildpack applies to a project.
+	NoBuildpackError struct {
+		// Dir is the directory of the project.
+		Dir string
+		// Tried is a list of the buildpacks which were tried.
+		Tried []string
+	}
+)
+
+// RegisteredBuildpacks contains all the buildpacks available to Sous. Each
+// buildpack registers itself here in an init func.
+var RegisteredBuildpacks = Buildpacks{}
+
+// DefaultArtefactDir is the directory inside compile containers where
+// buildpacks must leave their artefacts.
+const DefaultArtefactDir = "/artefacts"
+
+func (err NoBuildpackError) Error() string {
+	return fmt.Sprintf("no buildpack applies to %s (tried %v)", err.Dir, err.Tried)
+}
+
+// SortedKeys returns the names of these buildpacks in alphabetical order.
+func (bs Buildpacks) SortedKeys() []string {
+	keys := make([]string, 0, len(bs))
+	for k := range bs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Allowed returns the subset of these buildpacks named in names, or all of
+// them if names is empty. Names of buildpacks which are not in bs are ignored.
+func (bs Buildpacks) Allowed(names []string) Buildpacks {
+	if len(names) == 0 {
+		return bs
+	}
+	allowed := Buildpacks{}
+	for _, name := range names {
+		if b, ok := bs[name]; ok {
+			allowed[name] = b
+		}
+	}
+	return allowed
+}
+
+// Detect returns the subset of these buildpacks which apply to the source code
+// described by s.
+func (bs Buildpacks) Detect(s *SourceContext) (Buildpacks, error) {
+	applicable := Buildpacks{}
+	for name, b := range bs {
+		ok, err := b.Detect(s)
+		if err != nil {
+			return nil, fmt.Errorf("buildpack %s: %s", name, err)
+		}
+		if ok {
+			applicable[name] = b
+		}
+	}
+	return applicable, nil
+}
+
+// Plan creates a BuildPlan by detecting which of these buildpacks apply to the
+// source code in c, and then allowing each of them, in alphabetical order, to
+// contribute instructions to the compile and app Dockerfiles. If more than one
+// of them is a Tester, the last one provides the test command. It returns a
+// NoBuildpackError if none of them apply.
+func (bs Buildpacks) Plan(c *BuildContext) (*BuildPlan, error) {
+	applicable, err := bs.Detect(&c.Source)
+	if err != nil {
+		return nil, err
+	}
+	if len(applicable) == 0 {
+		return nil, NoBuildpackError{c.Source.SourceDir(), bs.SortedKeys()}
+	}
+	p := &BuildPlan{ArtefactDir: DefaultArtefactDir}
+	for _, name := range applicable.SortedKeys() {
+		b := applicable[name]
+		if err := contribute(name, &p.Compile, b.BuildImage, c); err != nil {
+			return nil, err
+		}
+		if err := contribute(name, &p.App, b.BuildContainer, c); err != nil {
+			return nil, err
+		}
+		if t, ok := b.(Tester); ok {
+			p.Test = t.TestCommand(c)
+		}
+	}
+	return p, nil
+}
+
+// contribute calls f on file, and ensures that f did not try to change the
+// base image of file, if another buildpack already set it.
+func contribute(name string, file *docker.File,
+	f func(*BuildContext, *docker.File) error, c *BuildContext) error {
+	from := file.From
+	if err := f(c, file); err != nil {
+		return fmt.Errorf("buildpack %s: %s", name, err)
+	}
+	if from != "" && file.From != from {
+		return fmt.Errorf("buildpack %s: tried to change base image from %q to %q",
+			name, from, file.From)
+	}
+	return nil
+}
@@ -1,8 +1,256 @@
 package sous
 
-type BuildState struct {
-}
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type (
+	// BuildState is a store of information about builds performed by the
+	// current user on the current machine. It keeps one BuildRecord for each
+	// repository and offset directory, recording the last successful build.
+	BuildState struct {
+		// Dir is the directory where build records are stored.
+		Dir string
+	}
+	// BuildRecord records a successful build of a single project.
+	BuildRecord struct {
+		// RootDir and OffsetDir identify the project that was built.
+		RootDir, OffsetDir string
+		// Revision and Tag are the revision and nearest tag that were built.
+		Revision, Tag string
+		// FileHashes is a map of tracked file paths to the SHA1 hash of their
+		// contents at the time of the build.
+		FileHashes map[string]string
+		// SousVersion is the version of Sous which performed the build.
+		SousVersion string
+		// Targets contains the most recent result of each target built.
+		Targets TargetResults
+		// Time is when the build finished.
+		Time time.Time
+	}
+)
 
+// NewBuildState returns a BuildState storing records in c.BuildStateDir,
+// creating that directory if necessary.
 func NewBuildState(c Config) (*BuildState, error) {
-	return nil, nil
+	if c.BuildStateDir == "" {
+		return nil, fmt.Errorf("build state dir not set")
+	}
+	if err := os.MkdirAll(c.BuildStateDir, 0755); err != nil {
+		return nil, err
+	}
+	return &BuildState{Dir: c.BuildStateDir}, nil
+}
+
+// NewBuildRecord creates a BuildRecord for the source code in c, hashing all of
+// its tracked files.
+func NewBuildRecord(c *BuildContext, sousVersion string) (*BuildRecord, error) {
+	s := c.Source
+	hashes, err := hashFiles(s.SourceDir(), s.Files)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildRecord{
+		RootDir:     s.RootDir,
+		OffsetDir:   s.OffsetDir,
+		Revision:    s.Revision,
+		Tag:         s.NearestTagName,
+		FileHashes:  hashes,
+		SousVersion: sousVersion,
+	}, nil
+}
+
+// LastBuild returns the record of the last successful build of the source code
+// described by s, or nil if it has not been built before.
+func (bs *BuildState) LastBuild(s *SourceContext) (*BuildRecord, error) {
+	f, err := os.Open(bs.recordPath(s.RootDir, s.OffsetDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r *BuildRecord
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("reading build state: %s", err)
+	}
+	return r, nil
+}
+
+// All returns the records of the last successful build of every project, most
+// recent first.
+func (bs *BuildState) All() ([]*BuildRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(bs.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*BuildRecord, 0, len(paths))
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r := &BuildRecord{}
+		if err := json.Unmarshal(b, r); err != nil {
+			return nil, fmt.Errorf("reading build state %s: %s", path, err)
+		}
+		records = append(records, r)
+	}
+	sort.Sort(byTimeDesc(records))
+	return records, nil
+}
+
+type byTimeDesc []*BuildRecord
+
+func (rs byTimeDesc) Len() int           { return len(rs) }
+func (rs byTimeDesc) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byTimeDesc) Less(i, j int) bool { return rs[i].Time.After(rs[j].Time) }
+
+// Record stores r as the last successful build of its project, replacing
+// any previous record.
+func (bs *BuildState) Record(r *BuildRecord) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := bs.recordPath(r.RootDir, r.OffsetDir)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DetectChanges sets c.Changes by comparing the source code in c with the
+// last build of the same project. It returns the last build record, which is
+// nil if this project has not been built before.
+func (bs *BuildState) DetectChanges(c *BuildContext, sousVersion string) (*BuildRecord, error) {
+	last, err := bs.LastBuild(&c.Source)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, nil
+	}
+	current, err := NewBuildRecord(c, sousVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.Changes = last.ChangesTo(current)
+	return last, nil
+}
+
+// Cached implements TargetCache, returning the image last built for the named
+// target, if it had the same digest. It is safe to call on a nil record.
+func (r *BuildRecord) Cached(name, digest string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	t, ok := r.Targets[name]
+	if !ok || t.Digest != digest {
+		return "", false
+	}
+	return t.Image, true
+}
+
+// ChangesTo returns the Changes between r and a later build record.
+func (r *BuildRecord) ChangesTo(later *BuildRecord) Changes {
+	c := Changes{}
+	if r.SousVersion != later.SousVersion {
+		c.SousUpdated = []string{r.SousVersion, later.SousVersion}
+	}
+	if r.Revision != later.Revision {
+		c.NewCommit = []string{r.Revision, later.Revision}
+	}
+	if r.Tag != later.Tag {
+		c.NewTag = []string{r.Tag, later.Tag}
+	}
+	for path, hash := range later.FileHashes {
+		previous, ok := r.FileHashes[path]
+		if !ok {
+			c.NewFiles = append(c.NewFiles, path)
+		} else if previous != hash {
+			c.ChangedFiles = append(c.ChangedFiles, path)
+		}
+	}
+	for path := range r.FileHashes {
+		if _, ok := later.FileHashes[path]; !ok {
+			c.ChangedFiles = append(c.ChangedFiles, path)
+		}
+	}
+	sort.Strings(c.NewFiles)
+	sort.Strings(c.ChangedFiles)
+	return c
+}
+
+// Any returns true if there are any changes at all.
+func (c Changes) Any() bool {
+	return len(c.SousUpdated)+len(c.NewCommit)+len(c.NewTag)+
+		len(c.NewFiles)+len(c.ChangedFiles) != 0
+}
+
+// Reasons returns a human readable explanation of each kind of change.
+func (c Changes) Reasons() []string {
+	reasons := []string{}
+	if len(c.SousUpdated) == 2 {
+		reasons = append(reasons, fmt.Sprintf("sous updated from %s to %s",
+			c.SousUpdated[0], c.SousUpdated[1]))
+	}
+	if len(c.NewCommit) == 2 {
+		reasons = append(reasons, fmt.Sprintf("new commit %s (last built %s)",
+			c.NewCommit[1], c.NewCommit[0]))
+	}
+	if len(c.NewTag) == 2 {
+		reasons = append(reasons, fmt.Sprintf("new tag %q (last built %q)",
+			c.NewTag[1], c.NewTag[0]))
+	}
+	if len(c.NewFiles) != 0 {
+		reasons = append(reasons, fmt.Sprintf("new files: %v", c.NewFiles))
+	}
+	if len(c.ChangedFiles) != 0 {
+		reasons = append(reasons, fmt.Sprintf("changed files: %v", c.ChangedFiles))
+	}
+	return reasons
+}
+
+// recordPath returns the path of the build record for a project. The name is
+// a hash of the project's location, so that it is a valid file name.
+func (bs *BuildState) recordPath(rootDir, offsetDir string) string {
+	key := filepath.Join(rootDir, offsetDir)
+	return filepath.Join(bs.Dir, fmt.Sprintf("%x.json", sha1.Sum([]byte(key))))
+}
+
+// hashFiles returns a map of each file path to the hash of its contents. Files
+// which do not exist are omitted.
+func hashFiles(dir string, files []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(files))
+	for _, path := range files {
+		f, err := os.Open(filepath.Join(dir, path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		h := sha1.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		hashes[path] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return hashes, nil
 }
@@ -0,0 +1,76 @@
+package sous
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildStateDetectChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-buildstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, src, "a.txt", "a")
+	writeTestFile(t, src, "b.txt", "b")
+
+	bs, err := NewBuildState(Config{BuildStateDir: filepath.Join(dir, "state")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &BuildContext{Source: SourceContext{
+		RootDir: src, OffsetDir: ".", Revision: "abc", Files: []string{"a.txt", "b.txt"},
+	}}
+
+	last, err := bs.DetectChanges(c, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != nil {
+		t.Fatalf("got last build %+v; want nil", last)
+	}
+	r, err := NewBuildRecord(c, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Record(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bs.DetectChanges(c, "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Changes.Any() {
+		t.Errorf("got changes %+v; want none", c.Changes)
+	}
+
+	writeTestFile(t, src, "b.txt", "changed")
+	writeTestFile(t, src, "c.txt", "c")
+	c.Source.Files = append(c.Source.Files, "c.txt")
+	c.Source.Revision = "def"
+	if _, err := bs.DetectChanges(c, "1.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	expected := Changes{
+		SousUpdated:  []string{"1.0.0", "1.0.1"},
+		NewCommit:    []string{"abc", "def"},
+		NewFiles:     []string{"c.txt"},
+		ChangedFiles: []string{"b.txt"},
+	}
+	if !reflect.DeepEqual(c.Changes, expected) {
+		t.Errorf("got changes %+v; want %+v", c.Changes, expected)
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, contents string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	// ClusterDriver deploys applications to a single cluster, by translating
+	// deployments into the terms of that cluster's scheduler. There is one
+	// implementation for each Kind of cluster, so that the rest of Sous does
+	// not depend on any particular scheduler.
+	ClusterDriver interface {
+		// Observe returns the deployments managed by Sous which are currently
+		// running in the cluster. Anything not deployed by Sous is ignored.
+		Observe() (ClusterDeployments, error)
+		// Apply performs each action in p, in order, stopping at the first
+		// which fails.
+		Apply(p ClusterPlan) error
+		// Health returns an error if the cluster cannot be used, e.g. because
+		// its scheduler is unreachable.
+		Health() error
+		// Describe describes the cluster in a few words, e.g. "Singularity at
+		// http://singularity.example.com".
+		Describe() string
+	}
+	// ClusterKind creates drivers for clusters of one Kind. It is passed the
+	// shared config, for settings which are not specific to the cluster,
+	// e.g. the docker registry.
+	ClusterKind func(c Cluster, sc *SharedConfig) (ClusterDriver, error)
+	// ClusterDrivers are drivers for a set of clusters, keyed by cluster
+	// name.
+	ClusterDrivers map[string]ClusterDriver
+)
+
+// ClusterKinds are the kinds of cluster Sous can deploy to, keyed by their
+// Kind in lower case. Packages which provide a driver add their kind to it in
+// an init func.
+var ClusterKinds = map[string]ClusterKind{}
+
+// NewClusterDriver returns a driver for c, created by the ClusterKind
+// registered for c.Kind, which is not case sensitive.
+func NewClusterDriver(c Cluster, sc *SharedConfig) (ClusterDriver, error) {
+	kind, ok := ClusterKinds[strings.ToLower(c.Kind)]
+	if !ok {
+		kinds := make([]string, 0, len(ClusterKinds))
+		for k := range ClusterKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("cluster %s: unknown kind %q, must be one of: %s",
+			c.Name, c.Kind, strings.Join(kinds, ", "))
+	}
+	return kind(c, sc)
+}
+
+// NewClusterDrivers returns a driver for each cluster in sc.
+func NewClusterDrivers(sc *SharedConfig) (ClusterDrivers, error) {
+	ds := ClusterDrivers{}
+	for _, c := range sc.Clusters {
+		d, err := NewClusterDriver(c, sc)
+		if err != nil {
+			return nil, err
+		}
+		ds[c.Name] = d
+	}
+	return ds, nil
+}
+
+// Observe observes every cluster, returning their deployments keyed by
+// cluster name, for Resolve.
+func (ds ClusterDrivers) Observe() (map[string]ClusterDeployments, error) {
+	observed := map[string]ClusterDeployments{}
+	for _, name := range ds.names() {
+		o, err := ds[name].Observe()
+		if err != nil {
+			return nil, fmt.Errorf("observing cluster %s: %s", name, err)
+		}
+		observed[name] = o
+	}
+	return observed, nil
+}
+
+// Apply applies each cluster's part of p using its driver, in cluster name
+// order, stopping at the first error.
+func (ds ClusterDrivers) Apply(p *Plan) error {
+	for _, cp := range p.Clusters {
+		d, ok := ds[cp.Cluster.Name]
+		if !ok {
+			return fmt.Errorf("no driver for cluster %s", cp.Cluster.Name)
+		}
+		if err := d.Apply(cp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds ClusterDrivers) names() []string {
+	names := make([]string, 0, len(ds))
+	for name := range ds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,73 @@
+package sous
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewClusterDriver(t *testing.T) {
+	sc := &SharedConfig{Clusters: Clusters{
+		{Name: "dev-a", Kind: "Local"},
+		{Name: "dev-b", Kind: "local"},
+	}}
+	ds, err := NewClusterDrivers(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds["dev-a"] != LocalClusterNamed("dev-a") || ds["dev-b"] != LocalClusterNamed("dev-b") {
+		t.Errorf("got drivers %v; want the local clusters", ds)
+	}
+	_, err = NewClusterDriver(Cluster{Name: "x", Kind: "marathon"}, sc)
+	if err == nil || !strings.Contains(err.Error(), `unknown kind "marathon"`) {
+		t.Errorf("got error %v; want unknown kind", err)
+	}
+}
+
+func TestLocalCluster(t *testing.T) {
+	c := Cluster{Name: "test-local", Kind: "local", DefaultEnv: EnvVars{"DC": "local"}}
+	sc := &SharedConfig{Clusters: Clusters{c}}
+	ds, err := NewClusterDrivers(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Source{RepoURL: "github.com/opentable/a"}
+	gdm := &GDM{Applications: Applications{
+		{Source: a, Deployments: Deployments{c.Name: {Version: "1.0.0", NumInstances: 1}}},
+	}}
+	resolve := func() *Plan {
+		observed, err := ds.Observe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := Resolve(gdm, observed, sc.Clusters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Apply(plan); err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+	resolve()
+	observed, err := ds[c.Name].Observe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := gdm.Effective(c); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("observed %v; want %v", observed, expected)
+	}
+	if plan := resolve(); !plan.Empty() {
+		t.Errorf("got plan %+v after applying; want empty", plan)
+	}
+	if d := ds[c.Name].Describe(); d != "local in-memory cluster, 1 deployments" {
+		t.Errorf("got description %q", d)
+	}
+
+	// Actions which do not match the cluster's state fail.
+	err = ds[c.Name].Apply(ClusterPlan{Cluster: c, Actions: []Action{{Kind: ActionCreate, Source: a,
+		Desired: &Deployment{Version: "1.0.0"}}}})
+	if err == nil {
+		t.Error("creating an existing deployment: got nil error")
+	}
+}
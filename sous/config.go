@@ -10,9 +10,33 @@ type (
 		// Server is the location of a Sous Server which this sous instance
 		// considers the master. If this is not set, this node is considered
 		// to be a master.
-		Server string `env:"SOUS_SERVER"`
+		Server string `env:"SOUS_SERVER" format:"uri"`
 		// BuildStateLocation is a directory where information about builds
 		// performed by this user on this machine are stored.
 		BuildStateDir string `env:"SOUS_BUILD_STATE_DIR"`
+		// ContractRecordsDir is a directory where signed records of contract
+		// results are stored, see ContractRecords.
+		ContractRecordsDir string `env:"SOUS_CONTRACT_RECORDS_DIR"`
+		// ContractSigningKey is the PEM encoded ECDSA private key contract
+		// records are signed with, e.g. generated with "openssl ecparam -name
+		// prime256v1 -genkey". Only those who record contract results need
+		// it; records are verified with SharedConfig.ContractVerificationKey.
+		ContractSigningKey string `env:"SOUS_CONTRACT_SIGNING_KEY" secret:"true"`
+		// EventLog is the file the Sous engine's event log is kept in, see
+		// FileEventStore. If it is empty, events are not kept.
+		EventLog string `env:"SOUS_EVENT_LOG"`
+		// LogFile is a file which every message Sous sends, at every level,
+		// is appended to, as JSON, one message per line. If it is empty,
+		// messages are only written to the terminal.
+		LogFile string `env:"SOUS_LOG_FILE"`
+		// Policy contains organisation-wide rules, e.g. for linting
+		// Dockerfiles.
+		Policy Policy
 	}
 )
+
+// Validate returns an error if c configures something which does not exist,
+// see Policy.Validate.
+func (c *Config) Validate() error {
+	return c.Policy.Validate()
+}
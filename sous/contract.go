@@ -0,0 +1,152 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Contracts is a list of contracts.
+	Contracts []Contract
+	// Contract is a set of checks which a Docker image must pass to behave
+	// appropriately on the platform. Its string fields are templates,
+	// rendered with ContractValues before each run, so that they can refer
+	// to e.g. the port the container listens on, as {{.Port0}}.
+	Contract struct {
+		// Name identifies the contract, e.g. "http-service".
+		Name string
+		// Description says what the contract ensures.
+		Description string `yaml:",omitempty"`
+		// Env is the environment variables to set in the container, in
+		// addition to PORT0.
+		Env EnvVars `yaml:",omitempty"`
+		// Checks are the checks the image must pass, see ContractCheck.
+		Checks []ContractCheck
+	}
+	// ContractCheck is a single check in a contract. Checks of the running
+	// container run first, then stops checks, then the checks which need the
+	// container stopped, each in the order they are declared. The kinds of
+	// check are:
+	//
+	//	listens  the container accepts TCP connections on $PORT0
+	//	http     GET Path on $PORT0 responds with Status
+	//	stops    the container exits cleanly on SIGTERM, with code 0 or 143
+	//	logs     the container writes to stdout, matching Pattern if set
+	ContractCheck struct {
+		// Kind is the kind of check, see above.
+		Kind string
+		// Path is the path requested by http checks, e.g. "/health".
+		Path string `yaml:",omitempty"`
+		// Status is the response status expected by http checks, 200 if
+		// zero.
+		Status int `yaml:",omitempty"`
+		// Pattern is a regular expression which logs checks expect stdout to
+		// match.
+		Pattern string `yaml:",omitempty"`
+		// Timeout is how long the check may take, e.g. "30s". It is
+		// DefaultContractTimeout if empty.
+		Timeout string `yaml:",omitempty"`
+	}
+	// ContractValues are the values available to contract templates, which
+	// differ for each run.
+	ContractValues struct {
+		// Image is the image under test.
+		Image string
+		// Container is the name of the container running Image.
+		Container string
+		// Host is the host the container's port is published on.
+		Host string
+		// Port0 is the port the container is expected to listen on, which is
+		// also its PORT0 environment variable.
+		Port0 int
+	}
+)
+
+// DefaultContractTimeout is the timeout of checks which do not set one.
+const DefaultContractTimeout = 10 * time.Second
+
+// Named returns the contract named name, and whether it exists.
+func (cs Contracts) Named(name string) (Contract, bool) {
+	for _, c := range cs {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Contract{}, false
+}
+
+// Validate returns an error describing every problem with cs: missing or
+// duplicate names, contracts with no checks, and invalid checks.
+func (cs Contracts) Validate() error {
+	var problems []string
+	seen := map[string]bool{}
+	for i, c := range cs {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("contract %d", i+1)
+			problems = append(problems, name+": no name")
+		} else if seen[name] {
+			problems = append(problems, name+": defined more than once")
+		}
+		seen[name] = true
+		if len(c.Checks) == 0 {
+			problems = append(problems, name+": no checks")
+		}
+		for j, check := range c.Checks {
+			if err := check.validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: check %d: %s", name, j+1, err))
+			}
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid contracts:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// validate checks the parts of c which are not templates.
+func (c ContractCheck) validate() error {
+	if _, ok := contractChecks[c.Kind]; !ok {
+		kinds := make([]string, 0, len(contractChecks))
+		for k := range contractChecks {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return fmt.Errorf("unknown kind %q, must be one of: %s", c.Kind, strings.Join(kinds, ", "))
+	}
+	if c.Status < 0 {
+		return fmt.Errorf("negative status %d", c.Status)
+	}
+	if !strings.Contains(c.Timeout, "{{") {
+		if _, err := c.timeout(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c ContractCheck) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return DefaultContractTimeout, nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", c.Timeout)
+	}
+	return d, nil
+}
+
+// LoadContracts reads a YAML or JSON file containing a list of contracts, and
+// validates them.
+func LoadContracts(path string) (Contracts, error) {
+	var cs Contracts
+	if err := readYAML(path, &cs); err != nil {
+		return nil, err
+	}
+	if err := cs.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cs, nil
+}
@@ -0,0 +1,114 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	// ContractGate refuses plans which would deploy images to clusters
+	// before they have passed the contracts those clusters require, see
+	// Cluster.RequiredContracts.
+	ContractGate struct {
+		// Records are the contract results of each image.
+		Records *ContractRecords
+		// Digest returns the digest of the image built for version of s.
+		Digest func(s Source, version string) (string, error)
+	}
+	// ContractRefusal is an action refused by a ContractGate.
+	ContractRefusal struct {
+		// Cluster is the name of the cluster the action would deploy to.
+		Cluster string
+		// Source and Version identify the image the action would deploy.
+		Source  Source
+		Version string
+		// Missing are the contracts required by Cluster which the image has
+		// not passed.
+		Missing []string
+		// Err is why the image's contract results could not be checked, if
+		// they could not be.
+		Err error
+	}
+	// ContractGateError is returned by ContractGate.Check for plans with
+	// refused actions.
+	ContractGateError struct {
+		Refusals []ContractRefusal
+	}
+)
+
+// Check returns a *ContractGateError listing every create and update action in
+// p whose image has not passed all the contracts required by the action's
+// cluster, according to the last signed record of each contract run against
+// the image's digest. Scales and deletes deploy no image, and are always
+// allowed.
+func (g *ContractGate) Check(p *Plan) error {
+	cerr := &ContractGateError{}
+	passed := map[string]map[string]bool{}
+	for _, cp := range p.Clusters {
+		required := cp.Cluster.RequiredContracts
+		if len(required) == 0 {
+			continue
+		}
+		for _, a := range cp.Actions {
+			if a.Kind != ActionCreate && a.Kind != ActionUpdate {
+				continue
+			}
+			refusal := ContractRefusal{Cluster: cp.Cluster.Name, Source: a.Source, Version: a.Desired.Version}
+			key := a.Source.String() + "@" + a.Desired.Version
+			results, ok := passed[key]
+			if !ok {
+				var err error
+				results, err = g.passed(a.Source, a.Desired.Version)
+				if err != nil {
+					refusal.Err = err
+					cerr.Refusals = append(cerr.Refusals, refusal)
+					continue
+				}
+				passed[key] = results
+			}
+			for _, name := range required {
+				if !results[name] {
+					refusal.Missing = append(refusal.Missing, name)
+				}
+			}
+			if len(refusal.Missing) != 0 {
+				cerr.Refusals = append(cerr.Refusals, refusal)
+			}
+		}
+	}
+	if len(cerr.Refusals) != 0 {
+		return cerr
+	}
+	return nil
+}
+
+// passed returns whether the image for version of s last passed each contract
+// run against it.
+func (g *ContractGate) passed(s Source, version string) (map[string]bool, error) {
+	if g.Records.VerificationKey == nil {
+		return nil, fmt.Errorf("contract verification key not set, so contract results cannot be verified")
+	}
+	digest, err := g.Digest(s, version)
+	if err != nil {
+		return nil, err
+	}
+	return g.Records.Passed(digest)
+}
+
+func (e *ContractGateError) Error() string {
+	lines := make([]string, 0, len(e.Refusals))
+	for _, r := range e.Refusals {
+		lines = append(lines, r.String())
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("%d deployments refused:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+func (r ContractRefusal) String() string {
+	what := fmt.Sprintf("%s version %s in %s", r.Source, r.Version, r.Cluster)
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %s", what, r.Err)
+	}
+	return fmt.Sprintf("%s: has not passed required contracts %s", what, strings.Join(r.Missing, ", "))
+}
@@ -0,0 +1,280 @@
+package sous
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// ContractRecords is an append-only store of contract results, keyed by
+	// the digest of the image tested. Each result is stored as a signed
+	// ContractRecord, in a file which is never changed or removed, so the
+	// history of every image's contract runs is kept.
+	ContractRecords struct {
+		// Dir is the directory where records are stored.
+		Dir string
+		// SigningKey is the private key new records are signed with. If it
+		// is nil, no records can be made.
+		SigningKey *ecdsa.PrivateKey
+		// VerificationKey is the public key records are verified with.
+		// Records whose signature was not made with the matching private
+		// key are ignored.
+		VerificationKey *ecdsa.PublicKey
+	}
+	// ContractRecord is the signed record of a single contract run against
+	// an image.
+	ContractRecord struct {
+		// Digest is the digest of the image tested, e.g. "sha256:1234...".
+		Digest string
+		// Result is the result of the contract run.
+		Result ContractResult
+		// Signature is the hex encoded ECDSA signature of the SHA-256 of the
+		// record's other fields, see Sign.
+		Signature string
+	}
+)
+
+// digestPattern matches docker image digests and IDs.
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+:[a-f0-9]{32,}$`)
+
+// NewContractRecords returns a ContractRecords storing records in
+// c.ContractRecordsDir, creating that directory if necessary. Records are
+// signed with c.ContractSigningKey, if it is set, and verified with
+// sc.ContractVerificationKey, or, if that is not set, the public half of
+// c.ContractSigningKey.
+func NewContractRecords(c Config, sc *SharedConfig) (*ContractRecords, error) {
+	if c.ContractRecordsDir == "" {
+		return nil, fmt.Errorf("contract records dir not set")
+	}
+	if err := os.MkdirAll(c.ContractRecordsDir, 0755); err != nil {
+		return nil, err
+	}
+	rs := &ContractRecords{Dir: c.ContractRecordsDir}
+	if c.ContractSigningKey != "" {
+		key, err := ParseContractSigningKey(c.ContractSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		rs.SigningKey, rs.VerificationKey = key, &key.PublicKey
+	}
+	if sc != nil && sc.ContractVerificationKey != "" {
+		key, err := ParseContractVerificationKey(sc.ContractVerificationKey)
+		if err != nil {
+			return nil, err
+		}
+		rs.VerificationKey = key
+	}
+	return rs, nil
+}
+
+// ParseContractSigningKey parses a PEM encoded ECDSA private key, like those
+// generated by "openssl ecparam -name prime256v1 -genkey".
+func ParseContractSigningKey(s string) (*ecdsa.PrivateKey, error) {
+	b, err := pemBlock(s, "EC PRIVATE KEY")
+	if err != nil {
+		return nil, fmt.Errorf("contract signing key: %s", err)
+	}
+	key, err := x509.ParseECPrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("contract signing key: %s", err)
+	}
+	return key, nil
+}
+
+// ParseContractVerificationKey parses a PEM encoded ECDSA public key, like
+// those output by "openssl ec -pubout".
+func ParseContractVerificationKey(s string) (*ecdsa.PublicKey, error) {
+	b, err := pemBlock(s, "PUBLIC KEY")
+	if err != nil {
+		return nil, fmt.Errorf("contract verification key: %s", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("contract verification key: %s", err)
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("contract verification key: got a %T; want an ECDSA key", key)
+	}
+	return ecKey, nil
+}
+
+// pemBlock returns the contents of the first PEM block of type t in s.
+func pemBlock(s, t string) ([]byte, error) {
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM encoded %s found", t)
+		}
+		if block.Type == t {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// Record signs and stores r as a result for the image with digest. It is an
+// error if no signing key is set.
+func (rs *ContractRecords) Record(digest string, r *ContractResult) (*ContractRecord, error) {
+	dir, err := rs.digestDir(digest)
+	if err != nil {
+		return nil, err
+	}
+	record := &ContractRecord{Digest: digest, Result: *r}
+	if record.Result.Time.IsZero() {
+		record.Result.Time = time.Now()
+	}
+	record.Result.Time = record.Result.Time.UTC()
+	if err := record.Sign(rs.SigningKey); err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, strconv.FormatInt(record.Result.Time.UnixNano(), 10)+".json")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return nil, fmt.Errorf("recording contract %s for %s: %s", r.Contract, digest, err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return record, f.Close()
+}
+
+// ForDigest returns the records for the image with digest whose signatures
+// are valid, oldest first. It is an error if no verification key is set.
+func (rs *ContractRecords) ForDigest(digest string) ([]*ContractRecord, error) {
+	if rs.VerificationKey == nil {
+		return nil, fmt.Errorf("contract verification key not set")
+	}
+	dir, err := rs.digestDir(digest)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*ContractRecord, 0, len(paths))
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r := &ContractRecord{}
+		if err := json.Unmarshal(b, r); err != nil {
+			return nil, fmt.Errorf("reading contract record %s: %s", path, err)
+		}
+		if r.Digest != digest || r.Verify(rs.VerificationKey) != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Sort(byResultTime(records))
+	return records, nil
+}
+
+// Passed returns whether the image with digest passed each contract run
+// against it, the last time it was run, keyed by contract name.
+func (rs *ContractRecords) Passed(digest string) (map[string]bool, error) {
+	records, err := rs.ForDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	passed := map[string]bool{}
+	for _, r := range records {
+		passed[r.Result.Contract] = r.Result.Passed
+	}
+	return passed, nil
+}
+
+// digestDir returns the directory containing the records for digest, e.g.
+// Dir/sha256/1234....
+func (rs *ContractRecords) digestDir(digest string) (string, error) {
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("invalid image digest %q", digest)
+	}
+	parts := strings.SplitN(digest, ":", 2)
+	return filepath.Join(rs.Dir, parts[0], parts[1]), nil
+}
+
+// Sign sets r.Signature to the ECDSA signature, using key, of the SHA-256 of
+// r's other fields.
+func (r *ContractRecord) Sign(key *ecdsa.PrivateKey) error {
+	if key == nil {
+		return fmt.Errorf("contract signing key not set")
+	}
+	digest, err := r.digest()
+	if err != nil {
+		return err
+	}
+	sig, err := key.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(sig)
+	return nil
+}
+
+// Verify returns an error unless r.Signature was made by signing r with the
+// private key matching key.
+func (r *ContractRecord) Verify(key *ecdsa.PublicKey) error {
+	if key == nil {
+		return fmt.Errorf("contract verification key not set")
+	}
+	digest, err := r.digest()
+	if err != nil {
+		return err
+	}
+	var sig struct{ R, S *big.Int }
+	b, err := hex.DecodeString(r.Signature)
+	if err == nil {
+		_, err = asn1.Unmarshal(b, &sig)
+	}
+	if err != nil || !ecdsa.Verify(key, digest, sig.R, sig.S) {
+		return fmt.Errorf("contract record for %s: invalid signature", r.Digest)
+	}
+	return nil
+}
+
+// digest returns the SHA-256 of the JSON encoding of r, without its signature.
+func (r *ContractRecord) digest() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+type byResultTime []*ContractRecord
+
+func (rs byResultTime) Len() int           { return len(rs) }
+func (rs byResultTime) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byResultTime) Less(i, j int) bool { return rs[i].Result.Time.Before(rs[j].Result.Time) }
@@ -0,0 +1,169 @@
+package sous
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newTestContractRecords(t *testing.T) *ContractRecords {
+	dir, err := ioutil.TempDir("", "sous-contract-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	rs, err := NewContractRecords(Config{ContractRecordsDir: dir, ContractSigningKey: string(signingKey)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestContractRecords(t *testing.T) {
+	rs := newTestContractRecords(t)
+	defer os.RemoveAll(rs.Dir)
+	start := time.Now()
+	results := []*ContractResult{
+		{Contract: "http", Passed: false, Time: start},
+		{Contract: "http", Passed: true, Time: start.Add(time.Second)},
+		{Contract: "logs", Passed: true, Time: start.Add(2 * time.Second)},
+	}
+	for _, r := range results {
+		if _, err := rs.Record(testDigest, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rs.Record(testDigest, results[0]); err == nil {
+		t.Errorf("recording over an existing record succeeded; want an error")
+	}
+
+	passed, err := rs.Passed(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !passed["http"] || !passed["logs"] || len(passed) != 2 {
+		t.Errorf("got %v; want http and logs passed", passed)
+	}
+
+	// Tamper with the passing http record, so it fails verification.
+	paths, _ := filepath.Glob(filepath.Join(rs.Dir, "sha256", "*", "*.json"))
+	if len(paths) != 3 {
+		t.Fatalf("got %d record files; want 3", len(paths))
+	}
+	tampered := &ContractRecord{}
+	b, _ := ioutil.ReadFile(paths[1])
+	json.Unmarshal(b, tampered)
+	tampered.Result.Contract = "logs"
+	tampered.Result.Time = start.Add(3 * time.Second)
+	b, _ = json.Marshal(tampered)
+	os.Chmod(paths[1], 0644)
+	if err := ioutil.WriteFile(paths[1], b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := rs.ForDigest(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("got %d verified records; want 2", len(records))
+	}
+	passed, _ = rs.Passed(testDigest)
+	if passed["http"] {
+		t.Errorf("http passed using a tampered record")
+	}
+
+	other := newTestContractRecords(t)
+	defer os.RemoveAll(other.Dir)
+	b, err = x509.MarshalPKIXPublicKey(&other.SigningKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verificationKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b})
+	verifier, err := NewContractRecords(Config{ContractRecordsDir: rs.Dir},
+		&SharedConfig{ContractVerificationKey: string(verificationKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := verifier.ForDigest(testDigest); len(records) != 0 {
+		t.Errorf("got %d records verified with the wrong key; want 0", len(records))
+	}
+	if _, err := verifier.Record(testDigest, results[0]); err == nil {
+		t.Errorf("recording without a signing key succeeded")
+	}
+	if _, err := rs.Record("latest", results[0]); err == nil {
+		t.Errorf("recording against an invalid digest succeeded")
+	}
+}
+
+func TestContractGate(t *testing.T) {
+	rs := newTestContractRecords(t)
+	defer os.RemoveAll(rs.Dir)
+	if _, err := rs.Record(testDigest, &ContractResult{Contract: "http", Passed: true}); err != nil {
+		t.Fatal(err)
+	}
+	app := Source{RepoURL: "github.com/opentable/app"}
+	v1, v2 := Deployment{Version: "1.0.0", NumInstances: 1}, Deployment{Version: "2.0.0", NumInstances: 2}
+	plan := &Plan{Clusters: []ClusterPlan{
+		{Cluster{Name: "dev"}, []Action{{Kind: ActionCreate, Source: app, Desired: &v2}}},
+		{Cluster{Name: "prod", RequiredContracts: []string{"http", "logs"}}, []Action{
+			{Kind: ActionUpdate, Source: app, Observed: &v1, Desired: &v2},
+		}},
+	}}
+	gate := &ContractGate{
+		Records: rs,
+		Digest: func(s Source, version string) (string, error) {
+			if version != "2.0.0" {
+				return "", fmt.Errorf("no image for %s", version)
+			}
+			return testDigest, nil
+		},
+	}
+	err := gate.Check(plan)
+	gerr, ok := err.(*ContractGateError)
+	if !ok {
+		t.Fatalf("got error %v; want a *ContractGateError", err)
+	}
+	if len(gerr.Refusals) != 1 || gerr.Refusals[0].Cluster != "prod" ||
+		strings.Join(gerr.Refusals[0].Missing, ",") != "logs" {
+		t.Errorf("got refusals %+v; want logs missing in prod", gerr.Refusals)
+	}
+
+	if _, err := rs.Record(testDigest, &ContractResult{Contract: "logs", Passed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.Check(plan); err != nil {
+		t.Errorf("got %v; want no error once every contract passed", err)
+	}
+
+	// Scaling deploys no image, so is allowed.
+	scaled := v1
+	scaled.NumInstances = 3
+	plan.Clusters[1].Actions[0] = Action{Kind: ActionScale, Source: app, Observed: &v1, Desired: &scaled}
+	if err := gate.Check(plan); err != nil {
+		t.Errorf("got %v; want scales allowed", err)
+	}
+	plan.Clusters[1].Actions[0] = Action{Kind: ActionCreate, Source: app, Desired: &v1}
+	if err := gate.Check(plan); err == nil || !strings.Contains(err.Error(), "no image for 1.0.0") {
+		t.Errorf("got %v; want the digest error", err)
+	}
+}
@@ -0,0 +1,312 @@
+package sous
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentable/sous/ext/docker"
+	"github.com/opentable/sous/util/yaml"
+)
+
+type (
+	// ContractTarget is a running container, under test by a contract.
+	ContractTarget interface {
+		// Stop sends SIGTERM to the container, followed by SIGKILL if it has
+		// not exited after timeout, and returns its exit code.
+		Stop(timeout time.Duration) (int, error)
+		// Logs returns what the container has written to stdout and stderr.
+		Logs() (stdout, stderr string, err error)
+		// Remove removes the container, stopping it if necessary.
+		Remove() error
+	}
+	// ContractRunner runs contracts against images.
+	ContractRunner struct {
+		// Host is the host that started containers publish their ports on.
+		Host string
+		// Start starts a container running v.Image, called v.Container, with
+		// env set, and v.Port0 published on Host.
+		Start func(v ContractValues, env EnvVars) (ContractTarget, error)
+		// Poll is how often listens and http checks retry until they pass,
+		// or time out. It is DefaultContractPoll if zero.
+		Poll time.Duration
+	}
+	// ContractResult is the result of running a contract against an image.
+	ContractResult struct {
+		// Contract is the name of the contract.
+		Contract string
+		// Image is the image under test.
+		Image string
+		// Passed is true if every check passed.
+		Passed bool
+		// Checks are the result of each check, in the order they ran.
+		Checks []ContractCheckResult
+		// Time is when the contract finished running.
+		Time time.Time
+	}
+	// ContractCheckResult is the result of a single check.
+	ContractCheckResult struct {
+		Kind    string
+		Passed  bool
+		Message string
+	}
+	// contractCheck runs a single kind of check.
+	contractCheck struct {
+		// phase is when the check runs, see the contractPhase constants.
+		phase contractPhase
+		run   func(r *contractRun, c ContractCheck, timeout time.Duration) (string, error)
+	}
+	// contractPhase is a stage in the life of a container under test.
+	contractPhase int
+	// contractRun is the state of a single run of a contract.
+	contractRun struct {
+		*ContractRunner
+		values ContractValues
+		target ContractTarget
+	}
+)
+
+// DefaultContractPoll is the default ContractRunner.Poll.
+const DefaultContractPoll = 250 * time.Millisecond
+
+// Contract checks run in phases, so that each sees the container in the state
+// it needs: first while it runs, then as it stops, then once it has stopped.
+const (
+	phaseRunning contractPhase = iota
+	phaseStopping
+	phaseStopped
+)
+
+// contractChecks are the kinds of ContractCheck, keyed by Kind.
+var contractChecks = map[string]contractCheck{
+	"listens": {phaseRunning, checkListens},
+	"http":    {phaseRunning, checkHTTP},
+	"stops":   {phaseStopping, checkStops},
+	"logs":    {phaseStopped, checkLogs},
+}
+
+// NewDockerContractRunner returns a runner which starts containers using d,
+// whose ports are published on host, e.g. "localhost".
+func NewDockerContractRunner(d *docker.Client, host string) *ContractRunner {
+	return &ContractRunner{
+		Host: host,
+		Start: func(v ContractValues, env EnvVars) (ContractTarget, error) {
+			if err := d.Start(v.Container, v.Image, env, v.Port0); err != nil {
+				return nil, err
+			}
+			return dockerTarget{d, v.Container}, nil
+		},
+	}
+}
+
+// RunAll runs each contract in cs against image, returning a result for each.
+// It stops at the first contract which cannot be run at all, e.g. because the
+// image does not exist.
+func (r *ContractRunner) RunAll(cs Contracts, image string) ([]*ContractResult, error) {
+	results := make([]*ContractResult, 0, len(cs))
+	for _, c := range cs {
+		result, err := r.Run(c, image)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Run starts image in a new container, and runs the checks of c against it.
+// The container is removed afterwards. It returns an error only if the
+// contract cannot be run, failing checks are reported in the result.
+func (r *ContractRunner) Run(c Contract, image string) (*ContractResult, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	values := ContractValues{
+		Image:     image,
+		Container: containerName(image, "contract-"+invalidImageNameChars.ReplaceAllString(strings.ToLower(c.Name), "-")),
+		Host:      r.Host,
+		Port0:     port,
+	}
+	rendered := Contract{}
+	if err := yaml.InjectTemplatePipeline(c, &rendered, values); err != nil {
+		return nil, fmt.Errorf("contract %s: %s", c.Name, err)
+	}
+	env := EnvVars{}
+	for k, v := range rendered.Env {
+		env[k] = v
+	}
+	env["PORT0"] = strconv.Itoa(port)
+	target, err := r.Start(values, env)
+	if err != nil {
+		return nil, fmt.Errorf("contract %s: starting %s: %s", c.Name, image, err)
+	}
+	defer target.Remove()
+	run := &contractRun{r, values, target}
+	result := &ContractResult{Contract: c.Name, Image: image, Passed: true}
+	stopped := false
+	for _, phase := range []contractPhase{phaseRunning, phaseStopping, phaseStopped} {
+		if phase == phaseStopped && !stopped {
+			// There was no stops check, but the remaining checks need the
+			// container stopped.
+			target.Stop(DefaultContractTimeout)
+		}
+		for _, check := range rendered.Checks {
+			if contractChecks[check.Kind].phase != phase {
+				continue
+			}
+			cr := run.check(check)
+			result.Checks = append(result.Checks, cr)
+			result.Passed = result.Passed && cr.Passed
+			stopped = stopped || phase == phaseStopping
+		}
+	}
+	result.Time = time.Now()
+	return result, nil
+}
+
+// check runs a single check, returning its result.
+func (r *contractRun) check(c ContractCheck) ContractCheckResult {
+	result := ContractCheckResult{Kind: c.Kind}
+	kind, ok := contractChecks[c.Kind]
+	if !ok {
+		result.Message = fmt.Sprintf("unknown kind %q", c.Kind)
+		return result
+	}
+	timeout, err := c.timeout()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Message, err = kind.run(r, c, timeout)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// poll calls f until it returns nil, or timeout passes, returning f's last
+// error.
+func (r *contractRun) poll(timeout time.Duration, f func() error) error {
+	deadline := time.Now().Add(timeout)
+	wait := r.Poll
+	if wait == 0 {
+		wait = DefaultContractPoll
+	}
+	for {
+		err := f()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (r *contractRun) addr() string {
+	return net.JoinHostPort(r.values.Host, strconv.Itoa(r.values.Port0))
+}
+
+func checkListens(r *contractRun, c ContractCheck, timeout time.Duration) (string, error) {
+	err := r.poll(timeout, func() error {
+		conn, err := net.DialTimeout("tcp", r.addr(), timeout)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("not listening on PORT0 (%d) after %s", r.values.Port0, timeout)
+	}
+	return fmt.Sprintf("listening on PORT0 (%d)", r.values.Port0), nil
+}
+
+func checkHTTP(r *contractRun, c ContractCheck, timeout time.Duration) (string, error) {
+	expected := c.Status
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	path := c.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := "http://" + r.addr() + path
+	client := &http.Client{Timeout: timeout}
+	err := r.poll(timeout, func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			return fmt.Errorf("GET %s responded %s, want %d", path, resp.Status, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("GET %s responded %d", path, expected), nil
+}
+
+func checkStops(r *contractRun, c ContractCheck, timeout time.Duration) (string, error) {
+	code, err := r.target.Stop(timeout)
+	if err != nil {
+		return "", err
+	}
+	// 143 is the exit code of a process terminated by SIGTERM.
+	if code != 0 && code != 143 {
+		return "", fmt.Errorf("exited with code %d after SIGTERM, want 0 or 143 within %s", code, timeout)
+	}
+	return fmt.Sprintf("exited with code %d after SIGTERM", code), nil
+}
+
+func checkLogs(r *contractRun, c ContractCheck, timeout time.Duration) (string, error) {
+	stdout, stderr, err := r.target.Logs()
+	if err != nil {
+		return "", err
+	}
+	if stdout == "" {
+		return "", fmt.Errorf("nothing written to stdout (%d bytes written to stderr)", len(stderr))
+	}
+	if c.Pattern == "" {
+		return fmt.Sprintf("%d bytes written to stdout", len(stdout)), nil
+	}
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %s", err)
+	}
+	if !re.MatchString(stdout) {
+		return "", fmt.Errorf("stdout does not match %q", c.Pattern)
+	}
+	return fmt.Sprintf("stdout matches %q", c.Pattern), nil
+}
+
+// freePort returns a TCP port which is not in use on this machine.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// dockerTarget is a ContractTarget running in docker.
+type dockerTarget struct {
+	docker    *docker.Client
+	container string
+}
+
+func (t dockerTarget) Stop(timeout time.Duration) (int, error) {
+	return t.docker.Stop(t.container, timeout)
+}
+
+func (t dockerTarget) Logs() (string, string, error) { return t.docker.Logs(t.container) }
+
+func (t dockerTarget) Remove() error { return t.docker.Remove(t.container) }
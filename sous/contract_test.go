@@ -0,0 +1,178 @@
+package sous
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTarget is a ContractTarget serving HTTP in-process.
+type fakeTarget struct {
+	listener       net.Listener
+	exitCode       int
+	stdout, stderr string
+	stopped        bool
+}
+
+func (t *fakeTarget) Stop(time.Duration) (int, error) {
+	t.stopped = true
+	t.listener.Close()
+	return t.exitCode, nil
+}
+
+func (t *fakeTarget) Logs() (string, string, error) { return t.stdout, t.stderr, nil }
+
+func (t *fakeTarget) Remove() error {
+	t.listener.Close()
+	return nil
+}
+
+// fakeRunner returns a runner whose containers serve /health, but only if
+// their HEALTH_PATH env var is /health, and configure is called with each
+// target before it starts.
+func fakeRunner(t *testing.T, configure func(*fakeTarget)) *ContractRunner {
+	return &ContractRunner{
+		Host: "127.0.0.1",
+		Poll: 10 * time.Millisecond,
+		Start: func(v ContractValues, env EnvVars) (ContractTarget, error) {
+			if env["PORT0"] != fmt.Sprint(v.Port0) {
+				t.Errorf("got PORT0=%q; want %d", env["PORT0"], v.Port0)
+			}
+			l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", v.Port0))
+			if err != nil {
+				return nil, err
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc(env["HEALTH_PATH"], func(http.ResponseWriter, *http.Request) {})
+			go http.Serve(l, mux)
+			target := &fakeTarget{listener: l}
+			configure(target)
+			return target, nil
+		},
+	}
+}
+
+var testContract = Contract{
+	Name: "service",
+	Env:  EnvVars{"HEALTH_PATH": "/health", "SELF": "{{.Host}}:{{.Port0}}"},
+	Checks: []ContractCheck{
+		{Kind: "logs", Pattern: "^started"},
+		{Kind: "stops", Timeout: "1s"},
+		{Kind: "listens", Timeout: "1s"},
+		{Kind: "http", Path: "/health", Timeout: "1s"},
+	},
+}
+
+func TestContractRunner_Pass(t *testing.T) {
+	var target *fakeTarget
+	r := fakeRunner(t, func(ft *fakeTarget) {
+		target = ft
+		ft.stdout = "started on port 1234"
+	})
+	result, err := r.Run(testContract, "test:1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Errorf("got failing result %+v", result)
+	}
+	var kinds []string
+	for _, c := range result.Checks {
+		kinds = append(kinds, c.Kind)
+	}
+	// Checks of the running container run first.
+	if strings.Join(kinds, ",") != "listens,http,stops,logs" {
+		t.Errorf("checks ran in order %v", kinds)
+	}
+	if !target.stopped {
+		t.Error("container was not stopped")
+	}
+}
+
+func TestContractRunner_Fail(t *testing.T) {
+	r := fakeRunner(t, func(ft *fakeTarget) {
+		ft.exitCode = 137
+		ft.stderr = "started"
+	})
+	c := testContract
+	c.Env = EnvVars{"HEALTH_PATH": "/other"}
+	c.Checks = append(c.Checks, ContractCheck{Kind: "listens", Timeout: "1s"})
+	result, err := r.Run(c, "test:1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed {
+		t.Fatal("got passing result")
+	}
+	passed := map[string]bool{}
+	for _, c := range result.Checks {
+		passed[c.Kind] = c.Passed
+	}
+	expected := map[string]bool{"listens": true, "http": false, "stops": false, "logs": false}
+	for kind, p := range expected {
+		if passed[kind] != p {
+			t.Errorf("%s check: got passed %v; want %v", kind, passed[kind], p)
+		}
+	}
+	if m := result.Checks[len(result.Checks)-1].Message; m != "nothing written to stdout (7 bytes written to stderr)" {
+		t.Errorf("got logs message %q", m)
+	}
+}
+
+func TestContracts_Validate(t *testing.T) {
+	if err := (Contracts{testContract}).Validate(); err != nil {
+		t.Error(err)
+	}
+	cs := Contracts{
+		testContract,
+		testContract,
+		{Name: "empty"},
+		{Name: "bad", Checks: []ContractCheck{{Kind: "smells"}, {Kind: "http", Timeout: "soon"}}},
+	}
+	err := cs.Validate()
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	for _, problem := range []string{
+		"service: defined more than once",
+		"empty: no checks",
+		`bad: check 1: unknown kind "smells"`,
+		`bad: check 2: invalid timeout "soon"`,
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %q does not contain %q", err, problem)
+		}
+	}
+}
+
+func TestLoadContracts(t *testing.T) {
+	f, err := ioutil.TempFile("", "contracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`
+- Name: http-service
+  Env:
+    HEALTH_URL: http://{{.Host}}:{{.Port0}}/health
+  Checks:
+  - Kind: listens
+  - Kind: http
+    Path: /health
+    Timeout: 30s
+`)
+	f.Close()
+	cs, err := LoadContracts(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := cs.Named("http-service")
+	if !ok || c.Env["HEALTH_URL"] != "http://{{.Host}}:{{.Port0}}/health" || len(c.Checks) != 2 || c.Checks[1].Timeout != "30s" {
+		t.Errorf("got contracts %+v", cs)
+	}
+}
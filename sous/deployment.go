@@ -1,16 +1,86 @@
 package sous
 
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/samsalisbury/semv"
+)
+
 type (
 	// Clusters is a collection of clusters.
 	Clusters []Cluster
 	// Cluster represents a logical deployment cluster.
 	Cluster struct {
+		// Name identifies this cluster, e.g. "us-west-1".
+		Name string
 		// Kind is the kind of cluster, e.g. "Singularity"
 		Kind string
 		// URL is the base URL for this cluster
 		URL string
 		// DefaultEnv is the default environment variables to set for all tasks
 		// running in this cluster.
-		DefaultEnv EnvVars
+		DefaultEnv EnvVars `yaml:",omitempty"`
+		// RequiredContracts are the names of the contracts an image must
+		// have passed before it may be deployed to this cluster.
+		RequiredContracts []string `yaml:",omitempty"`
+	}
+	// Deployments are the deployments of an application, keyed by cluster
+	// name.
+	Deployments map[string]Deployment
+	// Deployment is an application deployed to a single cluster.
+	Deployment struct {
+		// Version is the semver version of the application to deploy.
+		Version string
+		// NumInstances is the number of instances to run.
+		NumInstances int
+		// Env is the environment variables to set, in addition to the
+		// cluster's DefaultEnv, which they override.
+		Env EnvVars `yaml:",omitempty"`
+		// Resources are the resources reserved for each instance.
+		Resources Resources
+	}
+	// Resources are the resources reserved for a single instance of a
+	// deployment.
+	Resources struct {
+		// CPUs is the number of CPUs, which may be fractional.
+		CPUs float64
+		// MemoryMB is the memory, in megabytes.
+		MemoryMB int
+		// Ports is the number of ports to allocate.
+		Ports int
 	}
 )
+
+// Named returns the cluster named name, and whether it exists.
+func (cs Clusters) Named(name string) (Cluster, bool) {
+	for _, c := range cs {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Cluster{}, false
+}
+
+// Validate returns an error if d is not a valid deployment.
+func (d Deployment) Validate() error {
+	if _, err := semv.ParseExactSemver2(d.Version); err != nil {
+		return fmt.Errorf("version %q is not a semver version: %s", d.Version, err)
+	}
+	if d.NumInstances < 0 {
+		return fmt.Errorf("NumInstances must not be negative")
+	}
+	r := d.Resources
+	if r.CPUs < 0 || r.MemoryMB < 0 || r.Ports < 0 {
+		return fmt.Errorf("resources must not be negative")
+	}
+	return nil
+}
+
+// Equal is true if d and other are the same, treating nil and empty Env alike.
+func (d Deployment) Equal(other Deployment) bool {
+	if len(d.Env) == 0 && len(other.Env) == 0 {
+		d.Env, other.Env = nil, nil
+	}
+	return reflect.DeepEqual(d, other)
+}
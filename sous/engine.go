@@ -3,9 +3,21 @@ package sous
 type (
 	Engine struct {
 		MessageHandler func(Message)
+		// Events is the log of what has happened, from which the GDM is
+		// derived.
+		Events EventStore
 	}
 )
 
+// GDM returns the GDM derived by replaying every event in e.Events.
+func (e *Engine) GDM() (*GDM, error) {
+	events, err := e.Events.Since(0)
+	if err != nil {
+		return nil, err
+	}
+	return ReplayGDM(events)
+}
+
 func (e *Engine) GetSourceContext() (*SourceContext, error) {
 	return nil, nil
 }
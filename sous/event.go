@@ -0,0 +1,199 @@
+package sous
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// Event is a single entry in the event log, recording something which
+	// happened, e.g. a build finishing or a deployment being requested.
+	// Events are never changed once they are in the log, and the state of
+	// Sous, e.g. the GDM, can be rebuilt by replaying them in order.
+	//
+	// The JSON encoding of an event is stable: it is an object with the
+	// fields Seq, Time, Kind and Data, where Data is the JSON encoding of the
+	// EventData, whose type is determined by Kind. Event data types may gain
+	// fields, but their existing fields are never renamed or removed.
+	Event struct {
+		// Seq is the position of the event in the log, starting at 1. Each
+		// event's Seq is greater than those of the events before it.
+		Seq uint64
+		// Time is when the event was appended to the log.
+		Time time.Time
+		// Data is what happened.
+		Data EventData
+	}
+	// EventData is the data of a single kind of event.
+	EventData interface {
+		// EventKind identifies the type of the data.
+		EventKind() EventKind
+	}
+	// EventKind identifies the type of an event's data, e.g.
+	// "BuildStarted".
+	EventKind string
+
+	// BuildStarted records the start of a build.
+	BuildStarted struct {
+		Source   Source
+		Revision string
+		Version  string
+	}
+	// BuildFinished records the end of a build, successful or not.
+	BuildFinished struct {
+		Source   Source
+		Revision string
+		Version  string
+		// Image is the image built, if the build succeeded.
+		Image string `json:",omitempty"`
+		// Error says why the build failed, if it did.
+		Error string `json:",omitempty"`
+	}
+	// ImagePushed records an image being pushed to a registry.
+	ImagePushed struct {
+		Source  Source
+		Version string
+		Image   string
+		// Digest is the digest of the image, e.g. "sha256:1234...".
+		Digest string
+	}
+	// ContractRun records a contract being run against an image, see
+	// ContractRunner.
+	ContractRun struct {
+		Image    string
+		Digest   string
+		Contract string
+		Passed   bool
+	}
+	// DeploymentRequested records a deployment being added to or changed in
+	// the GDM.
+	DeploymentRequested struct {
+		Source     Source
+		Cluster    string
+		Deployment Deployment
+	}
+	// DeploymentRemoved records a deployment being removed from the GDM.
+	DeploymentRemoved struct {
+		Source  Source
+		Cluster string
+	}
+
+	// eventJSON is the JSON encoding of an Event.
+	eventJSON struct {
+		Seq  uint64
+		Time time.Time
+		Kind EventKind
+		Data json.RawMessage
+	}
+)
+
+// eventKinds returns new, empty event data of each kind, keyed by kind.
+var eventKinds = map[EventKind]func() EventData{
+	"BuildStarted":        func() EventData { return &BuildStarted{} },
+	"BuildFinished":       func() EventData { return &BuildFinished{} },
+	"ImagePushed":         func() EventData { return &ImagePushed{} },
+	"ContractRun":         func() EventData { return &ContractRun{} },
+	"DeploymentRequested": func() EventData { return &DeploymentRequested{} },
+	"DeploymentRemoved":   func() EventData { return &DeploymentRemoved{} },
+}
+
+func (*BuildStarted) EventKind() EventKind        { return "BuildStarted" }
+func (*BuildFinished) EventKind() EventKind       { return "BuildFinished" }
+func (*ImagePushed) EventKind() EventKind         { return "ImagePushed" }
+func (*ContractRun) EventKind() EventKind         { return "ContractRun" }
+func (*DeploymentRequested) EventKind() EventKind { return "DeploymentRequested" }
+func (*DeploymentRemoved) EventKind() EventKind   { return "DeploymentRemoved" }
+
+// MarshalJSON encodes e as described on Event.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	if e.Data == nil {
+		return nil, fmt.Errorf("event %d has no data", e.Seq)
+	}
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(eventJSON{e.Seq, e.Time, e.Data.EventKind(), data})
+}
+
+// UnmarshalJSON decodes e as described on Event. It returns an error if the
+// event's kind is unknown.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	ej := eventJSON{}
+	if err := json.Unmarshal(b, &ej); err != nil {
+		return err
+	}
+	newData, ok := eventKinds[ej.Kind]
+	if !ok {
+		return fmt.Errorf("event %d: unknown kind %q", ej.Seq, ej.Kind)
+	}
+	data := newData()
+	if err := json.Unmarshal(ej.Data, data); err != nil {
+		return fmt.Errorf("event %d: %s", ej.Seq, err)
+	}
+	e.Seq, e.Time, e.Data = ej.Seq, ej.Time, data
+	return nil
+}
+
+// ReplayGDM returns the GDM which results from applying events, in order, to
+// an empty GDM. It returns an error if the events are out of order.
+func ReplayGDM(events []*Event) (*GDM, error) {
+	g := &GDM{}
+	var last uint64
+	for _, e := range events {
+		if e.Seq <= last {
+			return nil, fmt.Errorf("event %d follows event %d", e.Seq, last)
+		}
+		last = e.Seq
+		if err := g.Reduce(e); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Reduce applies e to g, so that g reflects deployments requested and removed.
+// Other kinds of event do not change the GDM, and are ignored.
+func (g *GDM) Reduce(e *Event) error {
+	switch d := e.Data.(type) {
+	case *DeploymentRequested:
+		if err := d.Deployment.Validate(); err != nil {
+			return fmt.Errorf("event %d: %s in %s: %s", e.Seq, d.Source, d.Cluster, err)
+		}
+		a := g.application(d.Source)
+		if a.Deployments == nil {
+			a.Deployments = Deployments{}
+		}
+		a.Deployments[d.Cluster] = d.Deployment
+	case *DeploymentRemoved:
+		if i := g.applicationIndex(d.Source); i >= 0 {
+			delete(g.Applications[i].Deployments, d.Cluster)
+		}
+	}
+	return nil
+}
+
+// application returns the application built from s, adding it to g if it is
+// not there already.
+func (g *GDM) application(s Source) *Application {
+	i := g.applicationIndex(s)
+	if i < 0 {
+		g.Applications = append(g.Applications, Application{Source: s})
+		sort.Sort(g.Applications)
+		i = g.applicationIndex(s)
+	}
+	return &g.Applications[i]
+}
+
+// applicationIndex returns the index of the application built from s, or -1
+// if there is none.
+func (g *GDM) applicationIndex(s Source) int {
+	for i, a := range g.Applications {
+		if a.Source == s {
+			return i
+		}
+	}
+	return -1
+}
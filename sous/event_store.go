@@ -0,0 +1,177 @@
+package sous
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type (
+	// EventStore is an append-only log of events.
+	EventStore interface {
+		// Append adds an event for each of data to the end of the log, in
+		// order, giving each the next sequence number, and returns them.
+		Append(data ...EventData) ([]*Event, error)
+		// Since returns the events with Seq greater than seq, in order, so
+		// Since(0) returns the whole log.
+		Since(seq uint64) ([]*Event, error)
+	}
+	// MemoryEventStore is an EventStore which keeps events in memory, for
+	// tests.
+	MemoryEventStore struct {
+		sync.Mutex
+		events []*Event
+	}
+	// FileEventStore is an EventStore which keeps events in a file, as one
+	// JSON encoded event per line. It is safe for concurrent use, including
+	// by several processes sharing the file, which it locks with flock(2).
+	FileEventStore struct {
+		sync.Mutex
+		// Path is the path of the file.
+		Path string
+	}
+)
+
+// NewMemoryEventStore returns a MemoryEventStore with no events.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{events: []*Event{}}
+}
+
+// Append implements EventStore.
+func (s *MemoryEventStore) Append(data ...EventData) ([]*Event, error) {
+	s.Lock()
+	defer s.Unlock()
+	events := newEvents(uint64(len(s.events)), data)
+	s.events = append(s.events, events...)
+	return events, nil
+}
+
+// Since implements EventStore.
+func (s *MemoryEventStore) Since(seq uint64) ([]*Event, error) {
+	s.Lock()
+	defer s.Unlock()
+	if seq > uint64(len(s.events)) {
+		return []*Event{}, nil
+	}
+	events := make([]*Event, len(s.events)-int(seq))
+	copy(events, s.events[seq:])
+	return events, nil
+}
+
+// NewFileEventStore returns a FileEventStore keeping events in the file at
+// path, which is created, along with its directory, when the first event is
+// appended.
+func NewFileEventStore(path string) *FileEventStore {
+	return &FileEventStore{Path: path}
+}
+
+// Append implements EventStore. The file is locked exclusively while the last
+// sequence number is read from it and the events are appended, so that stores
+// in other processes number their events after these. The events are written
+// with a single write, so that a crash can at worst leave a partial last line,
+// which Since reports as an error.
+func (s *FileEventStore) Append(data ...EventData) ([]*Event, error) {
+	s.Lock()
+	defer s.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, fmt.Errorf("locking %s: %s", s.Path, err)
+	}
+	existing, err := s.readEvents(f)
+	if err != nil {
+		return nil, err
+	}
+	var last uint64
+	if len(existing) != 0 {
+		last = existing[len(existing)-1].Seq
+	}
+	events := newEvents(last, data)
+	buf := &bytes.Buffer{}
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Since implements EventStore. The file is locked shared while it is read, so
+// that it does not see events being appended.
+func (s *FileEventStore) Since(seq uint64) ([]*Event, error) {
+	s.Lock()
+	defer s.Unlock()
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return []*Event{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, fmt.Errorf("locking %s: %s", s.Path, err)
+	}
+	events, err := s.readEvents(f)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range events {
+		if e.Seq > seq {
+			return events[i:], nil
+		}
+	}
+	return []*Event{}, nil
+}
+
+// readEvents reads every event in r, the file, checking that their sequence
+// numbers increase.
+func (s *FileEventStore) readEvents(r io.Reader) ([]*Event, error) {
+	events := []*Event{}
+	var last uint64
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", s.Path, line, err)
+		}
+		if e.Seq <= last {
+			return nil, fmt.Errorf("%s:%d: event %d follows event %d", s.Path, line, e.Seq, last)
+		}
+		last = e.Seq
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// newEvents returns an event for each of data, numbered from after last.
+func newEvents(last uint64, data []EventData) []*Event {
+	now := time.Now().UTC()
+	events := make([]*Event, len(data))
+	for i, d := range data {
+		events[i] = &Event{Seq: last + uint64(i) + 1, Time: now, Data: d}
+	}
+	return events
+}
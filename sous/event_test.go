@@ -0,0 +1,178 @@
+package sous
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvent_JSON(t *testing.T) {
+	e := &Event{
+		Seq:  7,
+		Time: time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data: &ContractRun{Image: "app:1.0.0", Digest: "sha256:abc", Contract: "http", Passed: true},
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Seq":7,"Time":"2016-05-01T12:00:00Z","Kind":"ContractRun",` +
+		`"Data":{"Image":"app:1.0.0","Digest":"sha256:abc","Contract":"http","Passed":true}}`
+	if string(b) != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", b, expected)
+	}
+	decoded := &Event{}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, e) {
+		t.Errorf("decoded %+v; want %+v", decoded, e)
+	}
+	if err := json.Unmarshal([]byte(`{"Seq":1,"Kind":"Unknown","Data":{}}`), decoded); err == nil {
+		t.Errorf("decoding an unknown kind succeeded")
+	}
+}
+
+func TestReplayGDM(t *testing.T) {
+	app := Source{RepoURL: "github.com/opentable/app"}
+	other := Source{RepoURL: "github.com/opentable/other"}
+	v1 := Deployment{Version: "1.0.0", NumInstances: 1}
+	v2 := Deployment{Version: "2.0.0", NumInstances: 3}
+	s := NewMemoryEventStore()
+	if _, err := s.Append(
+		&BuildStarted{Source: app, Version: "1.0.0"},
+		&DeploymentRequested{Source: other, Cluster: "west", Deployment: v1},
+		&DeploymentRequested{Source: app, Cluster: "west", Deployment: v1},
+		&DeploymentRequested{Source: app, Cluster: "east", Deployment: v1},
+		&DeploymentRequested{Source: app, Cluster: "west", Deployment: v2},
+		&DeploymentRemoved{Source: app, Cluster: "east"},
+		&DeploymentRemoved{Source: Source{RepoURL: "github.com/opentable/gone"}, Cluster: "east"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	engine := &Engine{Events: s}
+	gdm, err := engine.GDM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &GDM{Applications: Applications{
+		{Source: app, Deployments: Deployments{"west": v2}},
+		{Source: other, Deployments: Deployments{"west": v1}},
+	}}
+	if !reflect.DeepEqual(gdm, expected) {
+		t.Errorf("got %+v; want %+v", gdm, expected)
+	}
+
+	events, _ := s.Since(0)
+	events[1], events[2] = events[2], events[1]
+	if _, err := ReplayGDM(events); err == nil {
+		t.Errorf("replaying events out of order succeeded")
+	}
+	invalid := []*Event{{Seq: 1, Data: &DeploymentRequested{Source: app, Cluster: "west"}}}
+	if _, err := ReplayGDM(invalid); err == nil {
+		t.Errorf("replaying an invalid deployment succeeded")
+	}
+}
+
+func TestEventStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.json")
+	stores := map[string]func() EventStore{
+		"memory": func() EventStore { return NewMemoryEventStore() },
+		// Each call opens the file afresh, to check Seq continues from the
+		// events already in it.
+		"file": func() EventStore { return NewFileEventStore(path) },
+	}
+	for name, newStore := range stores {
+		s := newStore()
+		if events, err := s.Since(0); err != nil || len(events) != 0 {
+			t.Errorf("%s: got %v, %v; want no events", name, events, err)
+		}
+		first, err := s.Append(&BuildStarted{Version: "1.0.0"}, &BuildFinished{Version: "1.0.0", Image: "app:1.0.0"})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if name == "file" {
+			s = newStore()
+		}
+		second, err := s.Append(&ImagePushed{Version: "1.0.0", Image: "app:1.0.0"})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if first[0].Seq != 1 || first[1].Seq != 2 || second[0].Seq != 3 {
+			t.Errorf("%s: got seqs %d, %d, %d; want 1, 2, 3", name, first[0].Seq, first[1].Seq, second[0].Seq)
+		}
+		all, err := s.Since(0)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(all, append(first, second...)) {
+			t.Errorf("%s: got %+v; want the appended events", name, all)
+		}
+		since, _ := s.Since(2)
+		if len(since) != 1 || since[0].Seq != 3 {
+			t.Errorf("%s: Since(2) returned %+v; want event 3", name, since)
+		}
+		if since, _ := s.Since(3); len(since) != 0 {
+			t.Errorf("%s: Since(3) returned %+v; want none", name, since)
+		}
+	}
+
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"Seq":4,"Kind":"Buil`)
+	f.Close()
+	if _, err := NewFileEventStore(path).Since(0); err == nil {
+		t.Errorf("reading a truncated event succeeded")
+	}
+}
+
+func TestFileEventStore_Shared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+	// Each store stands in for a separate process sharing the file.
+	a, b := NewFileEventStore(path), NewFileEventStore(path)
+	for _, s := range []*FileEventStore{a, b, a} {
+		if _, err := s.Append(&BuildStarted{Version: "1.0.0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const appends = 20
+	errs := make(chan error, 2*appends)
+	for _, s := range []*FileEventStore{a, b} {
+		go func(s *FileEventStore) {
+			for i := 0; i < appends; i++ {
+				_, err := s.Append(&BuildFinished{Version: "1.0.0"})
+				errs <- err
+			}
+		}(s)
+	}
+	for i := 0; i < 2*appends; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := NewFileEventStore(path).Since(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3+2*appends {
+		t.Fatalf("got %d events; want %d", len(events), 3+2*appends)
+	}
+	for i, e := range events {
+		if e.Seq != uint64(i+1) {
+			t.Errorf("event %d has Seq %d", i+1, e.Seq)
+		}
+	}
+}
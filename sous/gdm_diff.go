@@ -0,0 +1,117 @@
+package sous
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DeploymentDiff is a difference between two GDMs in the deployment of one
+// application to one cluster.
+type DeploymentDiff struct {
+	// Source is the source of the application.
+	Source Source
+	// Cluster is the name of the cluster.
+	Cluster string
+	// Before is the deployment in the first GDM, or nil if it was added.
+	Before *Deployment
+	// After is the deployment in the second GDM, or nil if it was removed.
+	After *Deployment
+}
+
+// DiffGDM returns the deployments which differ between before and after,
+// sorted by source and then cluster.
+func DiffGDM(before, after *GDM) []DeploymentDiff {
+	b, a := before.deployments(), after.deployments()
+	keys := map[deploymentKey]bool{}
+	for k := range b {
+		keys[k] = true
+	}
+	for k := range a {
+		keys[k] = true
+	}
+	diffs := []DeploymentDiff{}
+	for k := range keys {
+		bd, inBefore := b[k]
+		ad, inAfter := a[k]
+		if inBefore && inAfter && bd.Equal(ad) {
+			continue
+		}
+		d := DeploymentDiff{Source: k.Source, Cluster: k.Cluster}
+		if inBefore {
+			d.Before = &bd
+		}
+		if inAfter {
+			d.After = &ad
+		}
+		diffs = append(diffs, d)
+	}
+	sort.Sort(byDeploymentKey(diffs))
+	return diffs
+}
+
+// String describes d on a single line, e.g.
+// "~ github.com/user/repo in east: Version 1.0.0 -> 1.1.0".
+func (d DeploymentDiff) String() string {
+	where := fmt.Sprintf("%s in %s", d.Source, d.Cluster)
+	switch {
+	case d.Before == nil:
+		return fmt.Sprintf("+ %s: %s", where, d.After)
+	case d.After == nil:
+		return fmt.Sprintf("- %s: %s", where, d.Before)
+	}
+	return fmt.Sprintf("~ %s: %s", where, strings.Join(d.Before.changes(*d.After), "; "))
+}
+
+// String describes d briefly, e.g. "version 1.0.0, 2 instances".
+func (d Deployment) String() string {
+	return fmt.Sprintf("version %s, %d instances", d.Version, d.NumInstances)
+}
+
+// changes lists the fields which differ between d and other, e.g.
+// "NumInstances 1 -> 2".
+func (d Deployment) changes(other Deployment) []string {
+	var cs []string
+	add := func(name string, before, after interface{}) {
+		if !reflect.DeepEqual(before, after) {
+			cs = append(cs, fmt.Sprintf("%s %v -> %v", name, before, after))
+		}
+	}
+	add("Version", d.Version, other.Version)
+	add("NumInstances", d.NumInstances, other.NumInstances)
+	if len(d.Env) != 0 || len(other.Env) != 0 {
+		add("Env", d.Env, other.Env)
+	}
+	add("CPUs", d.Resources.CPUs, other.Resources.CPUs)
+	add("MemoryMB", d.Resources.MemoryMB, other.Resources.MemoryMB)
+	add("Ports", d.Resources.Ports, other.Resources.Ports)
+	return cs
+}
+
+type deploymentKey struct {
+	Source  Source
+	Cluster string
+}
+
+// deployments returns every deployment in g, keyed by source and cluster.
+func (g *GDM) deployments() map[deploymentKey]Deployment {
+	ds := map[deploymentKey]Deployment{}
+	for _, a := range g.Applications {
+		for cluster, d := range a.Deployments {
+			ds[deploymentKey{a.Source, cluster}] = d
+		}
+	}
+	return ds
+}
+
+type byDeploymentKey []DeploymentDiff
+
+func (ds byDeploymentKey) Len() int      { return len(ds) }
+func (ds byDeploymentKey) Swap(i, j int) { ds[i], ds[j] = ds[j], ds[i] }
+func (ds byDeploymentKey) Less(i, j int) bool {
+	if ds[i].Source != ds[j].Source {
+		return ds[i].Source.String() < ds[j].Source.String()
+	}
+	return ds[i].Cluster < ds[j].Cluster
+}
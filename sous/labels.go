@@ -0,0 +1,104 @@
+package sous
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type (
+	// ImageSource describes where an image came from, and how it was built.
+	// It is recovered from the labels Sous applies to each image it builds.
+	ImageSource struct {
+		RepoURL, OffsetDir, Revision, Branch, NearestTagName string
+		DirtyWorkingTree                                     bool
+		BuiltBy, BuiltOn, SousVersion                        string
+		BuildTime                                            time.Time
+	}
+)
+
+// LabelPrefix is the namespace of all labels applied by Sous.
+const LabelPrefix = "com.opentable.sous."
+
+// The names of each label applied by Sous, without LabelPrefix.
+const (
+	LabelRepoURL     = "repo_url"
+	LabelOffsetDir   = "repo_offset"
+	LabelRevision    = "revision"
+	LabelBranch      = "branch"
+	LabelNearestTag  = "nearest_tag"
+	LabelDirty       = "dirty"
+	LabelBuiltBy     = "built_by"
+	LabelBuiltOn     = "built_on"
+	LabelSousVersion = "sous_version"
+	LabelBuildTime   = "build_time"
+)
+
+// Labels returns the full set of labels to apply to an image built from c at
+// buildTime. All label names are prefixed with LabelPrefix.
+func Labels(c *BuildContext, buildTime time.Time) map[string]string {
+	s := c.Source
+	return map[string]string{
+		LabelPrefix + LabelRepoURL:     s.RemoteURL,
+		LabelPrefix + LabelOffsetDir:   s.OffsetDir,
+		LabelPrefix + LabelRevision:    s.Revision,
+		LabelPrefix + LabelBranch:      s.Branch,
+		LabelPrefix + LabelNearestTag:  s.NearestTagName,
+		LabelPrefix + LabelDirty:       strconv.FormatBool(s.DirtyWorkingTree),
+		LabelPrefix + LabelBuiltBy:     c.User.Username,
+		LabelPrefix + LabelBuiltOn:     c.Machine.FullHost,
+		LabelPrefix + LabelSousVersion: c.SousVersion,
+		LabelPrefix + LabelBuildTime:   buildTime.UTC().Format(time.RFC3339),
+	}
+}
+
+// ParseLabels recovers an ImageSource from the labels of an image, for example
+// as reported by docker inspect. Labels not applied by Sous are ignored. It
+// returns an error if there are no Sous labels, or if any are malformed.
+func ParseLabels(labels map[string]string) (*ImageSource, error) {
+	found := false
+	get := func(name string) string {
+		v, ok := labels[LabelPrefix+name]
+		found = found || ok
+		return v
+	}
+	is := &ImageSource{
+		RepoURL:        get(LabelRepoURL),
+		OffsetDir:      get(LabelOffsetDir),
+		Revision:       get(LabelRevision),
+		Branch:         get(LabelBranch),
+		NearestTagName: get(LabelNearestTag),
+		BuiltBy:        get(LabelBuiltBy),
+		BuiltOn:        get(LabelBuiltOn),
+		SousVersion:    get(LabelSousVersion),
+	}
+	if dirty := get(LabelDirty); dirty != "" {
+		var err error
+		if is.DirtyWorkingTree, err = strconv.ParseBool(dirty); err != nil {
+			return nil, fmt.Errorf("label %s%s: %s", LabelPrefix, LabelDirty, err)
+		}
+	}
+	if t := get(LabelBuildTime); t != "" {
+		var err error
+		if is.BuildTime, err = time.Parse(time.RFC3339, t); err != nil {
+			return nil, fmt.Errorf("label %s%s: %s", LabelPrefix, LabelBuildTime, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no labels with prefix %q; image not built by sous", LabelPrefix)
+	}
+	return is, nil
+}
+
+// SourceContext returns a partial SourceContext for the source code the image
+// was built from. Only fields recorded in labels are set.
+func (is *ImageSource) SourceContext() *SourceContext {
+	return &SourceContext{
+		RemoteURL:        is.RepoURL,
+		OffsetDir:        is.OffsetDir,
+		Branch:           is.Branch,
+		Revision:         is.Revision,
+		NearestTagName:   is.NearestTagName,
+		DirtyWorkingTree: is.DirtyWorkingTree,
+	}
+}
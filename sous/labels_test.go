@@ -0,0 +1,52 @@
+package sous
+
+import (
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestLabelsRoundTrip(t *testing.T) {
+	buildTime := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	c := &BuildContext{
+		Source: SourceContext{
+			RemoteURL:        "https://github.com/opentable/sous.git",
+			OffsetDir:        "cli",
+			Revision:         "cabba9e",
+			Branch:           "master",
+			NearestTagName:   "v1.0.0",
+			DirtyWorkingTree: true,
+		},
+		User:        user.User{Username: "someone"},
+		Machine:     Machine{FullHost: "build01.example.com"},
+		SousVersion: "1.0.0-alpha",
+	}
+	labels := Labels(c, buildTime)
+	labels["com.example.other"] = "ignored"
+
+	is, err := ParseLabels(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ImageSource{
+		RepoURL:          "https://github.com/opentable/sous.git",
+		OffsetDir:        "cli",
+		Revision:         "cabba9e",
+		Branch:           "master",
+		NearestTagName:   "v1.0.0",
+		DirtyWorkingTree: true,
+		BuiltBy:          "someone",
+		BuiltOn:          "build01.example.com",
+		SousVersion:      "1.0.0-alpha",
+		BuildTime:        buildTime,
+	}
+	if *is != expected {
+		t.Errorf("got % +v; want % +v", *is, expected)
+	}
+}
+
+func TestParseLabelsNotSous(t *testing.T) {
+	if _, err := ParseLabels(map[string]string{"maintainer": "someone"}); err == nil {
+		t.Errorf("expected an error parsing labels not applied by sous")
+	}
+}
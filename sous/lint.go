@@ -0,0 +1,261 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opentable/sous/ext/docker"
+)
+
+type (
+	// Severity is how serious a lint finding is.
+	Severity string
+	// LintFinding is a single problem found by a lint rule.
+	LintFinding struct {
+		// Dockerfile names the Dockerfile that was linted.
+		Dockerfile string
+		// Rule is the name of the rule which produced this finding.
+		Rule string
+		// Severity is the severity of the rule, according to policy.
+		Severity Severity
+		// Instruction is the offending instruction, it may be empty if the
+		// finding concerns the Dockerfile as a whole.
+		Instruction string
+		// Message describes the problem.
+		Message string
+	}
+	// LintFindings is a list of lint findings.
+	LintFindings []LintFinding
+	// dockerfileRule is a single rule checked by LintDockerfile.
+	dockerfileRule struct {
+		// severity is the default severity of this rule.
+		severity Severity
+		// check returns a finding for each problem with f, with only the
+		// Instruction and Message fields set.
+		check func(f docker.File, p DockerfilePolicy) LintFindings
+	}
+)
+
+const (
+	// SeverityError findings should prevent the Dockerfile being used.
+	SeverityError Severity = "error"
+	// SeverityWarning findings should be fixed, but do not prevent the
+	// Dockerfile being used.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo findings are advice.
+	SeverityInfo Severity = "info"
+	// SeverityOff disables a rule.
+	SeverityOff Severity = "off"
+)
+
+// dockerfileRules are the rules checked by LintDockerfile, keyed by name:
+//
+//	latest-tag          base images must have a tag other than "latest"
+//	require-user        the final stage must set a USER other than root
+//	remote-add          ADD must not fetch remote URLs
+//	required-labels     the final stage must set all RequiredLabels
+//	allowed-registries  base images must come from AllowedRegistries
+var dockerfileRules = map[string]dockerfileRule{
+	"latest-tag":         {SeverityError, checkLatestTag},
+	"require-user":       {SeverityWarning, checkRequireUser},
+	"remote-add":         {SeverityError, checkRemoteAdd},
+	"required-labels":    {SeverityError, checkRequiredLabels},
+	"allowed-registries": {SeverityError, checkAllowedRegistries},
+}
+
+// LintDockerfile checks f against each of dockerfileRules, with severities
+// and parameters according to p. name identifies f in the findings.
+func LintDockerfile(name string, f docker.File, p DockerfilePolicy) LintFindings {
+	findings := LintFindings{}
+	for _, r := range dockerfileRuleNames() {
+		rule := dockerfileRules[r]
+		severity := rule.severity
+		if s, ok := p.Severities[r]; ok {
+			severity = s
+		}
+		if severity == SeverityOff {
+			continue
+		}
+		for _, finding := range rule.check(f, p) {
+			finding.Dockerfile, finding.Rule, finding.Severity = name, r, severity
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// dockerfileRuleNames returns the names of dockerfileRules, sorted.
+func dockerfileRuleNames() []string {
+	rules := make([]string, 0, len(dockerfileRules))
+	for r := range dockerfileRules {
+		rules = append(rules, r)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// Errors returns the number of findings with SeverityError.
+func (fs LintFindings) Errors() int {
+	n := 0
+	for _, f := range fs {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+func (f LintFinding) String() string {
+	if f.Instruction == "" {
+		return fmt.Sprintf("%s: %s: %s: %s", f.Dockerfile, f.Severity, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s (%s)", f.Dockerfile, f.Severity, f.Rule,
+		f.Message, f.Instruction)
+}
+
+func checkLatestTag(f docker.File, p DockerfilePolicy) LintFindings {
+	findings := LintFindings{}
+	for _, from := range baseImages(f) {
+		if _, tag := splitImage(from.Image); tag == "latest" {
+			findings = append(findings, LintFinding{
+				Instruction: "FROM " + from.String(),
+				Message:     fmt.Sprintf("base image %q should have a specific tag", from.Image),
+			})
+		}
+	}
+	return findings
+}
+
+func checkRequireUser(f docker.File, p DockerfilePolicy) LintFindings {
+	user := ""
+	for _, i := range finalStage(f) {
+		if i.Name == "USER" {
+			user = i.Args.String()
+		}
+	}
+	switch strings.SplitN(user, ":", 2)[0] {
+	case "":
+		return LintFindings{{Message: "no USER set, containers will run as root"}}
+	case "root", "0":
+		return LintFindings{{Instruction: "USER " + user, Message: "containers should not run as root"}}
+	}
+	return nil
+}
+
+func checkRemoteAdd(f docker.File, p DockerfilePolicy) LintFindings {
+	findings := LintFindings{}
+	for _, i := range f.Instructions {
+		c, ok := i.Args.(docker.CopyArgs)
+		if !ok || i.Name != "ADD" {
+			continue
+		}
+		for _, s := range c.Sources {
+			if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+				findings = append(findings, LintFinding{
+					Instruction: i.String(),
+					Message:     fmt.Sprintf("ADD should not fetch %s, download it in a RUN instruction and verify it", s),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func checkRequiredLabels(f docker.File, p DockerfilePolicy) LintFindings {
+	labels := map[string]bool{}
+	for _, i := range finalStage(f) {
+		if i.Name != "LABEL" {
+			continue
+		}
+		switch a := i.Args.(type) {
+		case docker.KeyValueArgs:
+			for k := range a {
+				labels[k] = true
+			}
+		case docker.KeyValuePairs:
+			for _, kv := range a {
+				labels[kv.Key] = true
+			}
+		}
+	}
+	findings := LintFindings{}
+	for _, l := range p.RequiredLabels {
+		if !labels[l] {
+			findings = append(findings, LintFinding{Message: fmt.Sprintf("missing label %q", l)})
+		}
+	}
+	return findings
+}
+
+func checkAllowedRegistries(f docker.File, p DockerfilePolicy) LintFindings {
+	if len(p.AllowedRegistries) == 0 {
+		return nil
+	}
+	findings := LintFindings{}
+	for _, from := range baseImages(f) {
+		registry, _ := splitImage(from.Image)
+		allowed := false
+		for _, r := range p.AllowedRegistries {
+			allowed = allowed || r == registry
+		}
+		if !allowed {
+			findings = append(findings, LintFinding{
+				Instruction: "FROM " + from.String(),
+				Message: fmt.Sprintf("base image %q is from registry %s, allowed registries are: %s",
+					from.Image, registry, strings.Join(p.AllowedRegistries, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+// baseImages returns the FROM arguments of each stage of f, except those based
+// on an earlier stage, or on scratch.
+func baseImages(f docker.File) []docker.FromArgs {
+	froms := []docker.FromArgs{{Image: f.From, Stage: f.Stage}}
+	for _, i := range f.Instructions {
+		if from, ok := i.Args.(docker.FromArgs); ok {
+			froms = append(froms, from)
+		}
+	}
+	stages := map[string]bool{"scratch": true}
+	images := []docker.FromArgs{}
+	for _, from := range froms {
+		if !stages[from.Image] {
+			images = append(images, from)
+		}
+		if from.Stage != "" {
+			stages[from.Stage] = true
+		}
+	}
+	return images
+}
+
+// finalStage returns the instructions of the last stage of f.
+func finalStage(f docker.File) docker.Instructions {
+	for n := len(f.Instructions) - 1; n >= 0; n-- {
+		if f.Instructions[n].Name == "FROM" {
+			return f.Instructions[n+1:]
+		}
+	}
+	return f.Instructions
+}
+
+// splitImage returns the registry and tag of a docker image reference. Images
+// without a registry are on Docker Hub, "docker.io". Images without a tag or
+// digest are "latest"; images with a digest return the digest as their tag.
+func splitImage(image string) (registry, tag string) {
+	registry, name := "docker.io", image
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry, name = parts[0], parts[1]
+	}
+	if i := strings.Index(name, "@"); i != -1 {
+		return registry, name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		return registry, name[i+1:]
+	}
+	return registry, "latest"
+}
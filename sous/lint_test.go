@@ -0,0 +1,77 @@
+package sous
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opentable/sous/ext/docker"
+)
+
+const lintTestDockerfile = `
+FROM golang AS build
+COPY ["main.go", "/go/src/app/"]
+RUN go build -o /app .
+
+FROM registry.example.com/base/alpine:3.3
+ADD ["https://example.com/app.tar.gz", "/tmp/"]
+COPY --from=build ["/app", "/app"]
+LABEL com.example.team=infra
+USER root
+`
+
+func TestLintDockerfile(t *testing.T) {
+	f, err := docker.ParseFile(strings.NewReader(lintTestDockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := DockerfilePolicy{
+		RequiredLabels:    []string{"com.example.team", "com.example.owner"},
+		AllowedRegistries: []string{"registry.example.com"},
+		Severities:        map[string]Severity{"remote-add": SeverityInfo},
+	}
+	findings := LintDockerfile("Dockerfile", *f, policy)
+	expected := []string{
+		`Dockerfile: error: allowed-registries: base image "golang" is from registry docker.io, allowed registries are: registry.example.com (FROM golang AS build)`,
+		`Dockerfile: error: latest-tag: base image "golang" should have a specific tag (FROM golang AS build)`,
+		`Dockerfile: info: remote-add: ADD should not fetch https://example.com/app.tar.gz, download it in a RUN instruction and verify it (ADD ["https://example.com/app.tar.gz","/tmp/"])`,
+		`Dockerfile: warning: require-user: containers should not run as root (USER root)`,
+		`Dockerfile: error: required-labels: missing label "com.example.owner"`,
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("got %d findings:\n%v\nwant %d", len(findings), findings, len(expected))
+	}
+	for i, f := range findings {
+		if f.String() != expected[i] {
+			t.Errorf("got finding %q; want %q", f, expected[i])
+		}
+	}
+	if n := findings.Errors(); n != 3 {
+		t.Errorf("got %d errors; want 3", n)
+	}
+
+	policy = DockerfilePolicy{Severities: map[string]Severity{
+		"latest-tag": SeverityOff, "require-user": SeverityOff, "remote-add": SeverityOff,
+	}}
+	if findings := LintDockerfile("Dockerfile", *f, policy); len(findings) != 0 {
+		t.Errorf("got findings %v; want none", findings)
+	}
+}
+
+func TestDockerfilePolicy_Validate(t *testing.T) {
+	valid := DockerfilePolicy{Severities: map[string]Severity{
+		"require-user": SeverityOff,
+		"latest-tag":   SeverityWarning,
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid policy: %s", err)
+	}
+	for _, severities := range []map[string]Severity{
+		{"require-usr": SeverityError},
+		{"require-user": "err"},
+	} {
+		p := Policy{Dockerfile: DockerfilePolicy{Severities: severities}}
+		if err := p.Validate(); err == nil {
+			t.Errorf("policy with severities %v is valid; want an error", severities)
+		}
+	}
+}
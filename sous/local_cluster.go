@@ -0,0 +1,84 @@
+package sous
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LocalCluster is a cluster of Kind "local", which exists only in memory, for
+// development and tests. Actions take effect immediately, and nothing runs.
+// There is one LocalCluster for each cluster name in each process, so every
+// driver for a cluster sees the same deployments.
+type LocalCluster struct {
+	sync.Mutex
+	// Name is the name of the cluster.
+	Name string
+	// Deployments are the deployments in the cluster.
+	Deployments ClusterDeployments
+}
+
+var localClusters = struct {
+	sync.Mutex
+	m map[string]*LocalCluster
+}{m: map[string]*LocalCluster{}}
+
+func init() {
+	ClusterKinds["local"] = func(c Cluster, _ *SharedConfig) (ClusterDriver, error) {
+		return LocalClusterNamed(c.Name), nil
+	}
+}
+
+// LocalClusterNamed returns the local cluster named name, creating it, with
+// no deployments, if necessary.
+func LocalClusterNamed(name string) *LocalCluster {
+	localClusters.Lock()
+	defer localClusters.Unlock()
+	c, ok := localClusters.m[name]
+	if !ok {
+		c = &LocalCluster{Name: name, Deployments: ClusterDeployments{}}
+		localClusters.m[name] = c
+	}
+	return c
+}
+
+// Observe returns a copy of the cluster's deployments.
+func (c *LocalCluster) Observe() (ClusterDeployments, error) {
+	c.Lock()
+	defer c.Unlock()
+	ds := ClusterDeployments{}
+	for s, d := range c.Deployments {
+		ds[s] = d
+	}
+	return ds, nil
+}
+
+// Apply performs each action in p. Like a real scheduler, it refuses to
+// create deployments which exist, or change those which do not.
+func (c *LocalCluster) Apply(p ClusterPlan) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, a := range p.Actions {
+		_, exists := c.Deployments[a.Source]
+		switch {
+		case a.Kind == ActionCreate && exists:
+			return fmt.Errorf("create %s in %s: already deployed", a.Source, c.Name)
+		case a.Kind != ActionCreate && !exists:
+			return fmt.Errorf("%s %s in %s: not deployed", a.Kind, a.Source, c.Name)
+		case a.Kind == ActionDelete:
+			delete(c.Deployments, a.Source)
+		default:
+			c.Deployments[a.Source] = *a.Desired
+		}
+	}
+	return nil
+}
+
+// Health always returns nil: a local cluster is always available.
+func (c *LocalCluster) Health() error { return nil }
+
+// Describe says how many deployments c has.
+func (c *LocalCluster) Describe() string {
+	c.Lock()
+	defer c.Unlock()
+	return fmt.Sprintf("local in-memory cluster, %d deployments", len(c.Deployments))
+}
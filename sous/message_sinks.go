@@ -0,0 +1,214 @@
+package sous
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentable/sous/util/cmdr"
+	"github.com/opentable/sous/util/cmdr/style"
+)
+
+type (
+	// TerminalSink writes messages to a terminal, one per line, prefixed and
+	// styled according to their level. It has an Output of its own, since
+	// Send is called from the Messenger's delivery goroutine, and Outputs are
+	// not safe for concurrent use.
+	TerminalSink struct {
+		sync.Mutex
+		out *cmdr.Output
+		// ShowFields adds each message's fields to the end of its line, as
+		// key=value pairs.
+		ShowFields bool
+	}
+	// JSONFileSink appends messages to a file as JSON, one object per line.
+	JSONFileSink struct {
+		file *os.File
+		w    *bufio.Writer
+	}
+	// MemorySink keeps messages in memory, for tests.
+	MemorySink struct {
+		sync.Mutex
+		messages []Message
+	}
+)
+
+// levelStyles are the styles TerminalSink writes each level in.
+var levelStyles = map[Level]style.Style{
+	ErrorLevel:   {style.Red},
+	WarningLevel: {style.Yellow},
+	InfoLevel:    style.DefaultStyle(),
+	DebugLevel:   {style.Dim},
+}
+
+// NewTerminalSink returns a TerminalSink writing to w.
+func NewTerminalSink(w io.Writer) *TerminalSink {
+	return &TerminalSink{out: cmdr.NewOutput(w)}
+}
+
+// Send writes m as "<level>: <body>", except for info messages, which are
+// written as just their body.
+func (s *TerminalSink) Send(m Message) error {
+	level := LevelOf(m)
+	line := m.Body()
+	if level != InfoLevel {
+		line = level.String() + ": " + line
+	}
+	if s.ShowFields {
+		fields := m.Fields()
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			line += fmt.Sprintf(" %s=%v", k, fields[k])
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	if st, ok := levelStyles[level]; ok {
+		s.out.PushStyle(st)
+		defer s.out.PopStyle()
+	}
+	s.out.Println(line)
+	return nil
+}
+
+// Flush returns the first error writing encountered, if any.
+func (s *TerminalSink) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.out.Errors) != 0 {
+		return s.out.Errors[0]
+	}
+	return nil
+}
+
+// Close flushes s, it does not close the writer.
+func (s *TerminalSink) Close() error { return s.Flush() }
+
+// NewJSONFileSink returns a sink appending to the file at path, which is
+// created if necessary.
+func NewJSONFileSink(path string) (*JSONFileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONFileSink{file: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Send writes m as a JSON object, see MessageJSON.
+func (s *JSONFileSink) Send(m Message) error {
+	return json.NewEncoder(s.w).Encode(MessageJSON(m))
+}
+
+// MessageJSON returns m as a flat object which log aggregators can index
+// without configuration. It has the keys:
+//
+//	time            when m was sent, in RFC 3339 format, in UTC
+//	level           "error", "warning", "info" or "debug"
+//	sender          who sent m
+//	message         the body of m
+//	trace_id        the correlation ID of the invocation m was sent during
+//	span_id         the span m was sent in, and its parent and name, see Span
+//	parent_span_id
+//	span_name
+//
+// and each of m's fields. Fields whose keys clash with those above are
+// prefixed with "field.", and values which cannot be encoded as JSON are
+// formatted as strings, as are errors.
+func MessageJSON(m Message) map[string]interface{} {
+	span := m.Span()
+	o := map[string]interface{}{
+		"time":    m.Time().UTC().Format(time.RFC3339Nano),
+		"level":   LevelOf(m).String(),
+		"sender":  m.Sender(),
+		"message": m.Body(),
+	}
+	for k, v := range map[string]string{
+		"trace_id":       span.TraceID,
+		"span_id":        span.ID,
+		"parent_span_id": span.ParentID,
+		"span_name":      span.Name,
+	} {
+		if v != "" {
+			o[k] = v
+		}
+	}
+	for k, v := range m.Fields() {
+		if messageJSONKeys[k] {
+			k = "field." + k
+		}
+		o[k] = jsonValue(v)
+	}
+	return o
+}
+
+// messageJSONKeys are the keys MessageJSON uses for everything but fields.
+var messageJSONKeys = map[string]bool{
+	"time": true, "level": true, "sender": true, "message": true,
+	"trace_id": true, "span_id": true, "parent_span_id": true, "span_name": true,
+}
+
+// jsonValue returns v if it can be encoded as JSON, otherwise v formatted as
+// a string. Errors are always formatted, as they usually encode as {}.
+func jsonValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// Flush writes buffered messages to the file, and syncs it.
+func (s *JSONFileSink) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close flushes s, and closes the file.
+func (s *JSONFileSink) Close() error {
+	err := s.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewMemorySink returns a MemorySink with no messages.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{messages: []Message{}}
+}
+
+// Send appends m to the messages.
+func (s *MemorySink) Send(m Message) error {
+	s.Lock()
+	defer s.Unlock()
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+// Messages returns the messages sent so far, in order.
+func (s *MemorySink) Messages() []Message {
+	s.Lock()
+	defer s.Unlock()
+	ms := make([]Message, len(s.messages))
+	copy(ms, s.messages)
+	return ms
+}
+
+// Flush does nothing: messages are available as soon as they are sent.
+func (s *MemorySink) Flush() error { return nil }
+
+// Close does nothing.
+func (s *MemorySink) Close() error { return nil }
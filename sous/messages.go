@@ -2,7 +2,10 @@ package sous
 
 import (
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/opentable/sous/util/cmdr"
 )
 
 type (
@@ -10,43 +13,315 @@ type (
 		Time() time.Time
 		Sender() string
 		Body() string
+		// Fields are structured data describing the message.
+		Fields() Fields
+		// Span is the operation the message was sent during.
+		Span() Span
 	}
 	// Message is a message sent from Sous Engine
 	message struct {
 		time       time.Time
 		from, body string
+		fields     Fields
+		span       Span
 	}
 	Error   struct{ Message }
 	Warning struct{ Message }
 	Info    struct{ Message }
 	Debug   struct{ Message }
-	// Messenger creates and sends messages. It has an internal queue, and tries
-	// hard not to block.
+	// Fields are structured data attached to messages, keyed by name, e.g.
+	// {"image": "app:1.0.0"}. Values should be strings, numbers, booleans,
+	// or other values which encode as JSON.
+	Fields map[string]interface{}
+	// Level is the importance of a message, from ErrorLevel, the most
+	// important, to DebugLevel.
+	Level int
+	// Messenger creates messages and delivers them to sinks. Messages are
+	// queued, and delivered in order by a single goroutine, so sending
+	// rarely blocks. Call Close before exiting, so queued messages are not
+	// lost.
+	//
+	// Each message is sent in the Messenger's span, with its fields. Use
+	// Child to send messages about a part of the work in a new span, and With
+	// to add fields. Messengers derived this way share their sinks.
 	Messenger struct {
-		Owner   string
-		Queue   chan Message
-		Handler func(Message)
+		Owner string
+		// Span is the span messages are sent in.
+		Span Span
+		// Fields are added to every message sent.
+		Fields Fields
+		*pipeline
+	}
+	// pipeline queues messages, and delivers them to sinks.
+	pipeline struct {
+		queue chan Message
+		// done is closed once the delivery goroutine has exited, after
+		// setting err to the first error since the last flush.
+		done chan struct{}
+		err  error
+		// mu guards closed, and is read locked while sending to queue, so
+		// queue is not closed during a send.
+		mu     sync.RWMutex
+		closed bool
+		// sinksMu guards sinks.
+		sinksMu sync.Mutex
+		sinks   []messageSink
+	}
+	// MessageSink is somewhere messages are delivered, e.g. the terminal.
+	// A Messenger calls a sink's methods from a single goroutine.
+	MessageSink interface {
+		// Send delivers m.
+		Send(m Message) error
+		// Flush ensures every message sent so far has been written.
+		Flush() error
+		// Close flushes the sink, and releases its resources.
+		Close() error
+	}
+	// messageSink is a sink, and the verbosity of the messages it receives.
+	messageSink struct {
+		MessageSink
+		verbosity cmdr.Verbosity
 	}
+	// flushMessage asks the delivery goroutine to flush each sink, and
+	// report the first error on done.
+	flushMessage struct {
+		Message
+		done chan error
+	}
+)
+
+const (
+	// ErrorLevel messages report failures, they are shown at Quiet
+	// verbosity and above.
+	ErrorLevel Level = iota
+	// WarningLevel messages report problems which do not stop Sous working,
+	// they are shown at Normal verbosity and above.
+	WarningLevel
+	// InfoLevel messages report progress, they are shown at Loud verbosity
+	// and above.
+	InfoLevel
+	// DebugLevel messages report internal operations, they are shown only at
+	// Debug verbosity.
+	DebugLevel
 )
 
+// verbosityLevels are the most detailed level shown at each verbosity, -1 for
+// none.
+var verbosityLevels = map[cmdr.Verbosity]Level{
+	cmdr.Silent: -1,
+	cmdr.Quiet:  ErrorLevel,
+	cmdr.Normal: WarningLevel,
+	cmdr.Loud:   InfoLevel,
+	cmdr.Debug:  DebugLevel,
+}
+
 func (m message) Time() time.Time { return m.time }
 func (m message) Sender() string  { return m.from }
 func (m message) Body() string    { return m.body }
+func (m message) Fields() Fields  { return m.fields }
+func (m message) Span() Span      { return m.span }
 
-func NewMessenger(owner string, handler func(Message)) *Messenger {
-	q := make(chan Message, 256)
-	go func() {
-		for m := range q {
-			handler(m)
-		}
-	}()
-	return &Messenger{Owner: owner, Queue: q, Handler: handler}
+func (Error) Level() Level   { return ErrorLevel }
+func (Warning) Level() Level { return WarningLevel }
+func (Info) Level() Level    { return InfoLevel }
+func (Debug) Level() Level   { return DebugLevel }
+
+// LevelOf returns the level of m, which is InfoLevel unless m is an Error,
+// Warning or Debug.
+func LevelOf(m Message) Level {
+	if l, ok := m.(interface {
+		Level() Level
+	}); ok {
+		return l.Level()
+	}
+	return InfoLevel
+}
+
+func (l Level) String() string {
+	switch l {
+	case ErrorLevel:
+		return "error"
+	case WarningLevel:
+		return "warning"
+	case InfoLevel:
+		return "info"
+	case DebugLevel:
+		return "debug"
+	}
+	return fmt.Sprintf("level %d", int(l))
+}
+
+// ShownAt returns true if messages of level l are shown at verbosity v. An
+// unknown verbosity is treated as Normal.
+func (l Level) ShownAt(v cmdr.Verbosity) bool {
+	most, ok := verbosityLevels[v]
+	if !ok {
+		most = verbosityLevels[cmdr.Normal]
+	}
+	return l <= most
+}
+
+// NewMessenger returns a Messenger with no sinks, whose messages are sent by
+// owner, in the root span of a new trace, named owner.
+func NewMessenger(owner string) *Messenger {
+	p := &pipeline{
+		queue: make(chan Message, 256),
+		done:  make(chan struct{}),
+	}
+	go p.deliver()
+	return &Messenger{Owner: owner, Span: NewTrace(owner), pipeline: p}
+}
+
+// Child returns a Messenger sending to the same sinks in a new span named
+// name, which is a child of m's span. Its messages have m's fields, and
+// fields.
+func (m *Messenger) Child(name string, fields Fields) *Messenger {
+	child := m.With(fields)
+	child.Span = m.Span.Child(name)
+	return child
+}
+
+// With returns a Messenger sending to the same sinks in the same span, whose
+// messages have m's fields, and fields, which take precedence.
+func (m *Messenger) With(fields Fields) *Messenger {
+	merged := Fields{}
+	for k, v := range m.Fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	with := *m
+	with.Fields = merged
+	return &with
+}
+
+// Join returns a Messenger sending to the same sinks in a new span named name,
+// which continues a trace started elsewhere, e.g. in another process. Its
+// parent is the span described by traceparent, see ParseTraceParent. If
+// traceparent is not valid, Join returns m.Child(name, nil).
+func (m *Messenger) Join(traceparent, name string) *Messenger {
+	parent, ok := ParseTraceParent(traceparent)
+	if !ok {
+		return m.Child(name, nil)
+	}
+	joined := m.With(nil)
+	joined.Span = parent.Child(name)
+	return joined
+}
+
+// AddSink adds s to the sinks messages are delivered to. It receives only
+// messages shown at verbosity v, see Level.ShownAt.
+func (p *pipeline) AddSink(s MessageSink, v cmdr.Verbosity) {
+	p.sinksMu.Lock()
+	defer p.sinksMu.Unlock()
+	p.sinks = append(p.sinks, messageSink{s, v})
 }
 
 func Messagef(from, format string, v ...interface{}) Message {
-	return message{time.Now(), from, fmt.Sprintf(format, v...)}
+	return message{time: time.Now(), from: from, body: fmt.Sprintf(format, v...)}
+}
+
+// messagef returns a message from m, in its span, with its fields.
+func (m *Messenger) messagef(format string, v ...interface{}) Message {
+	return message{time.Now(), m.Owner, fmt.Sprintf(format, v...), m.Fields, m.Span}
 }
 
 func (m *Messenger) Errorf(format string, v ...interface{}) {
-	m.Queue <- Error{Messagef(m.Owner, format, v...)}
+	m.Send(Error{m.messagef(format, v...)})
+}
+
+func (m *Messenger) Warnf(format string, v ...interface{}) {
+	m.Send(Warning{m.messagef(format, v...)})
+}
+
+func (m *Messenger) Infof(format string, v ...interface{}) {
+	m.Send(Info{m.messagef(format, v...)})
+}
+
+func (m *Messenger) Debugf(format string, v ...interface{}) {
+	m.Send(Debug{m.messagef(format, v...)})
+}
+
+// Send queues msg for delivery. Messages sent after Close are dropped.
+func (p *pipeline) Send(msg Message) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	p.queue <- msg
+}
+
+// Flush waits until every message sent before it has been delivered, and each
+// sink flushed. It returns the first error any sink returned since the last
+// flush.
+func (p *pipeline) Flush() error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil
+	}
+	done := make(chan error, 1)
+	p.queue <- flushMessage{done: done}
+	p.mu.RUnlock()
+	return <-done
+}
+
+// Close delivers every queued message, then closes each sink. It returns the
+// first error any sink returned since the last flush. Calling Close more
+// than once has no effect.
+func (p *pipeline) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	<-p.done
+	err := p.err
+	p.sinksMu.Lock()
+	defer p.sinksMu.Unlock()
+	for _, s := range p.sinks {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// deliver delivers each queued message to each sink which shows its level,
+// until the queue is closed.
+func (p *pipeline) deliver() {
+	var err error
+	defer func() {
+		p.err = err
+		close(p.done)
+	}()
+	for msg := range p.queue {
+		p.sinksMu.Lock()
+		sinks := p.sinks
+		p.sinksMu.Unlock()
+		if f, ok := msg.(flushMessage); ok {
+			for _, s := range sinks {
+				if ferr := s.Flush(); err == nil {
+					err = ferr
+				}
+			}
+			f.done <- err
+			err = nil
+			continue
+		}
+		level := LevelOf(msg)
+		for _, s := range sinks {
+			if !level.ShownAt(s.verbosity) {
+				continue
+			}
+			if serr := s.Send(msg); err == nil {
+				err = serr
+			}
+		}
+	}
 }
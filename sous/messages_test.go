@@ -0,0 +1,200 @@
+package sous
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opentable/sous/util/cmdr"
+)
+
+func TestLevel_ShownAt(t *testing.T) {
+	cases := []struct {
+		v     cmdr.Verbosity
+		shown []Level
+	}{
+		{cmdr.Silent, nil},
+		{cmdr.Quiet, []Level{ErrorLevel}},
+		{cmdr.Normal, []Level{ErrorLevel, WarningLevel}},
+		{cmdr.Loud, []Level{ErrorLevel, WarningLevel, InfoLevel}},
+		{cmdr.Debug, []Level{ErrorLevel, WarningLevel, InfoLevel, DebugLevel}},
+	}
+	for _, c := range cases {
+		shown := map[Level]bool{}
+		for _, l := range c.shown {
+			shown[l] = true
+		}
+		for _, l := range []Level{ErrorLevel, WarningLevel, InfoLevel, DebugLevel} {
+			if l.ShownAt(c.v) != shown[l] {
+				t.Errorf("%s shown at %s: got %t; want %t", l, c.v, l.ShownAt(c.v), shown[l])
+			}
+		}
+	}
+}
+
+func TestMessenger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sous.log")
+	file, err := NewJSONFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normal, debug := NewMemorySink(), NewMemorySink()
+	m := NewMessenger("test")
+	m.AddSink(normal, cmdr.Normal)
+	m.AddSink(debug, cmdr.Debug)
+	m.AddSink(file, cmdr.Debug)
+
+	m.Errorf("error %d", 1)
+	m.Warnf("warning %d", 2)
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(normal.Messages()); got != 2 {
+		t.Errorf("got %d messages after Flush; want 2", got)
+	}
+	m.Infof("info %d", 3)
+	// Send enough messages to fill the queue, to check none are lost.
+	for i := 0; i < 1000; i++ {
+		m.Debugf("debug %d", i)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m.Errorf("after close")
+	if err := m.Close(); err != nil {
+		t.Errorf("second Close returned %s", err)
+	}
+
+	ms := normal.Messages()
+	if len(ms) != 2 || ms[0].Body() != "error 1" || LevelOf(ms[1]) != WarningLevel {
+		t.Errorf("normal sink got %v; want the error and the warning", ms)
+	}
+	if got := len(debug.Messages()); got != 1003 {
+		t.Errorf("debug sink got %d messages; want 1003", got)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		if lines != 2 {
+			continue
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded["level"] != "warning" || decoded["sender"] != "test" || decoded["message"] != "warning 2" {
+			t.Errorf("got %s; want the warning", scanner.Text())
+		}
+	}
+	if lines != 1003 {
+		t.Errorf("log file has %d lines; want 1003", lines)
+	}
+}
+
+func TestMessenger_Spans(t *testing.T) {
+	sink := NewMemorySink()
+	m := NewMessenger("test")
+	m.AddSink(sink, cmdr.Debug)
+	build := m.Child("build", Fields{"repo": "github.com/opentable/app"})
+	build.With(Fields{"repo": "overridden", "step": 1}).Infof("step")
+	joined := m.Join(build.Span.TraceParent(), "server")
+	joined.Infof("joined")
+	m.Join("nonsense", "server").Infof("not joined")
+	m.Infof("root")
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := sink.Messages()
+	step, root := ms[0], ms[3]
+	if root.Span().ParentID != "" || root.Span().Name != "test" || len(root.Span().TraceID) != 32 {
+		t.Errorf("got root span %+v", root.Span())
+	}
+	if s := step.Span(); s.TraceID != root.Span().TraceID || s.ParentID != root.Span().ID || s.Name != "build" {
+		t.Errorf("got step span %+v; want a child of %+v", s, root.Span())
+	}
+	if f := step.Fields(); f["repo"] != "overridden" || f["step"] != 1 {
+		t.Errorf("got step fields %v", f)
+	}
+	if len(build.Fields) != 1 || build.Fields["repo"] != "github.com/opentable/app" {
+		t.Errorf("With changed its parent's fields: %v", build.Fields)
+	}
+	if s := ms[1].Span(); s.TraceID != root.Span().TraceID || s.ParentID != build.Span.ID {
+		t.Errorf("got joined span %+v; want a child of %+v", s, build.Span)
+	}
+	if s := ms[2].Span(); s.ParentID != root.Span().ID {
+		t.Errorf("got span %+v for an invalid traceparent; want a child of the root", s)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	span := NewTrace("test")
+	parsed, ok := ParseTraceParent(span.TraceParent())
+	if !ok || parsed.TraceID != span.TraceID || parsed.ID != span.ID {
+		t.Errorf("parsed %q as %+v, %t", span.TraceParent(), parsed, ok)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+	} {
+		if _, ok := ParseTraceParent(invalid); ok {
+			t.Errorf("parsed invalid traceparent %q", invalid)
+		}
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	m := message{
+		time:   time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC),
+		from:   "sous",
+		body:   "pushed",
+		fields: Fields{"image": "app:1.0.0", "level": "clash", "error": fmt.Errorf("oops"), "f": func() {}},
+		span:   Span{TraceID: "t", ID: "s", Name: "push"},
+	}
+	b, err := json.Marshal(MessageJSON(Warning{m}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"error":"oops","f":"` + fmt.Sprint(m.fields["f"]) + `","field.level":"clash",` +
+		`"image":"app:1.0.0","level":"warning","message":"pushed","sender":"sous",` +
+		`"span_id":"s","span_name":"push","time":"2016-05-01T12:00:00Z","trace_id":"t"}`
+	if string(b) != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", b, expected)
+	}
+}
+
+func TestTerminalSink(t *testing.T) {
+	out := &bytes.Buffer{}
+	m := NewMessenger("test")
+	m.AddSink(NewTerminalSink(out), cmdr.Normal)
+	m.Warnf("careful")
+	m.Infof("not shown")
+	m.Errorf("failed")
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "warning: careful\nerror: failed\n"; out.String() != expected {
+		t.Errorf("got %q; want %q", out, expected)
+	}
+}
@@ -0,0 +1,189 @@
+package sous
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// ClusterDeployments are the deployments in a single cluster, keyed by
+	// the source of the application deployed.
+	ClusterDeployments map[Source]Deployment
+	// ActionKind is the kind of change an Action makes to a cluster.
+	ActionKind string
+	// Action is a single change to make to a cluster, so that a deployment
+	// there matches the GDM.
+	Action struct {
+		Kind   ActionKind
+		Source Source
+		// Observed is the deployment as it is now, nil for ActionCreate.
+		Observed *Deployment `json:",omitempty"`
+		// Desired is the deployment as it should be, nil for ActionDelete.
+		Desired *Deployment `json:",omitempty"`
+	}
+	// ClusterPlan is the ordered actions needed to make one cluster match the
+	// GDM.
+	ClusterPlan struct {
+		Cluster Cluster
+		Actions []Action
+	}
+	// Plan is the ordered actions needed to make every cluster match the
+	// GDM, in cluster name order.
+	Plan struct {
+		Clusters []ClusterPlan
+	}
+)
+
+// Actions are applied in the order they are declared: new deployments are
+// created before anything is removed, so capacity moves rather than shrinks.
+const (
+	// ActionCreate deploys an application the cluster is not running.
+	ActionCreate ActionKind = "create"
+	// ActionUpdate changes a deployment's version, environment or resources,
+	// and possibly its number of instances.
+	ActionUpdate ActionKind = "update"
+	// ActionScale changes only a deployment's number of instances.
+	ActionScale ActionKind = "scale"
+	// ActionDelete removes a deployment which is not in the GDM.
+	ActionDelete ActionKind = "delete"
+)
+
+var actionOrder = map[ActionKind]int{
+	ActionCreate: 0, ActionUpdate: 1, ActionScale: 2, ActionDelete: 3,
+}
+
+// Cluster returns the deployments g declares for the cluster named name.
+func (g *GDM) Cluster(name string) ClusterDeployments {
+	ds := ClusterDeployments{}
+	for _, a := range g.Applications {
+		if d, ok := a.Deployments[name]; ok {
+			ds[a.Source] = d
+		}
+	}
+	return ds
+}
+
+// Effective returns the deployments g declares for c, as they should run
+// there, i.e. with c.DefaultEnv added to each deployment's Env.
+func (g *GDM) Effective(c Cluster) ClusterDeployments {
+	ds := g.Cluster(c.Name)
+	if len(c.DefaultEnv) == 0 {
+		return ds
+	}
+	for s, d := range ds {
+		env := EnvVars{}
+		for k, v := range c.DefaultEnv {
+			env[k] = v
+		}
+		for k, v := range d.Env {
+			env[k] = v
+		}
+		d.Env = env
+		ds[s] = d
+	}
+	return ds
+}
+
+// Resolve returns the plan to make each of clusters match desired, given the
+// deployments observed in each cluster, keyed by cluster name. Observed
+// deployments are compared with those desired as they should run in that
+// cluster, see GDM.Effective. Every cluster
+// must have been observed, even if it is running nothing. It returns an error
+// if desired deploys to a cluster which is not in clusters.
+func Resolve(desired *GDM, observed map[string]ClusterDeployments, clusters Clusters) (*Plan, error) {
+	for _, a := range desired.Applications {
+		for name := range a.Deployments {
+			if _, ok := clusters.Named(name); !ok {
+				return nil, fmt.Errorf("%s: no cluster named %q", a.Source, name)
+			}
+		}
+	}
+	sorted := make(Clusters, len(clusters))
+	copy(sorted, clusters)
+	sort.Sort(byClusterName(sorted))
+	plan := &Plan{Clusters: []ClusterPlan{}}
+	for _, c := range sorted {
+		o, ok := observed[c.Name]
+		if !ok {
+			return nil, fmt.Errorf("cluster %q was not observed", c.Name)
+		}
+		plan.Clusters = append(plan.Clusters, ClusterPlan{
+			Cluster: c,
+			Actions: resolveCluster(desired.Effective(c), o),
+		})
+	}
+	return plan, nil
+}
+
+// resolveCluster returns the ordered actions which make observed match
+// desired.
+func resolveCluster(desired, observed ClusterDeployments) []Action {
+	actions := []Action{}
+	for s, d := range desired {
+		d := d
+		o, ok := observed[s]
+		switch {
+		case !ok:
+			actions = append(actions, Action{Kind: ActionCreate, Source: s, Desired: &d})
+		case o.Equal(d):
+		default:
+			kind := ActionUpdate
+			if o.NumInstances != d.NumInstances {
+				scaled := o
+				scaled.NumInstances = d.NumInstances
+				if scaled.Equal(d) {
+					kind = ActionScale
+				}
+			}
+			actions = append(actions, Action{Kind: kind, Source: s, Observed: &o, Desired: &d})
+		}
+	}
+	for s, o := range observed {
+		o := o
+		if _, ok := desired[s]; !ok {
+			actions = append(actions, Action{Kind: ActionDelete, Source: s, Observed: &o})
+		}
+	}
+	sort.Sort(byActionOrder(actions))
+	return actions
+}
+
+// Empty is true if p has no actions, i.e. every cluster already matches the
+// GDM.
+func (p *Plan) Empty() bool {
+	for _, c := range p.Clusters {
+		if len(c.Actions) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Changes describes the fields the action changes, e.g. "NumInstances 1 -> 2",
+// or, for creates and deletes, the deployment created or deleted.
+func (a Action) Changes() []string {
+	switch {
+	case a.Observed == nil:
+		return []string{a.Desired.String()}
+	case a.Desired == nil:
+		return []string{a.Observed.String()}
+	}
+	return a.Observed.changes(*a.Desired)
+}
+
+type byClusterName Clusters
+
+func (cs byClusterName) Len() int           { return len(cs) }
+func (cs byClusterName) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+func (cs byClusterName) Less(i, j int) bool { return cs[i].Name < cs[j].Name }
+
+type byActionOrder []Action
+
+func (as byActionOrder) Len() int      { return len(as) }
+func (as byActionOrder) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
+func (as byActionOrder) Less(i, j int) bool {
+	if as[i].Kind != as[j].Kind {
+		return actionOrder[as[i].Kind] < actionOrder[as[j].Kind]
+	}
+	return as[i].Source.String() < as[j].Source.String()
+}
@@ -0,0 +1,73 @@
+package sous
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	a := Source{RepoURL: "github.com/opentable/a"}
+	b := Source{RepoURL: "github.com/opentable/b"}
+	c := Source{RepoURL: "github.com/opentable/c"}
+	d := Source{RepoURL: "github.com/opentable/d"}
+	v1 := Deployment{Version: "1.0.0", NumInstances: 1}
+	v1x3 := Deployment{Version: "1.0.0", NumInstances: 3}
+	v2 := Deployment{Version: "2.0.0", NumInstances: 3}
+
+	clusters := Clusters{{Name: "west"}, {Name: "east"}}
+	desired := &GDM{Applications: Applications{
+		{Source: a, Deployments: Deployments{"east": v1, "west": v1}},
+		{Source: b, Deployments: Deployments{"east": v1x3}},
+		{Source: c, Deployments: Deployments{"east": v2}},
+	}}
+	observed := map[string]ClusterDeployments{
+		"east": {a: v1, b: v1, c: v1, d: v1},
+		"west": {},
+	}
+
+	plan, err := Resolve(desired, observed, clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Clusters) != 2 || plan.Clusters[0].Cluster.Name != "east" || plan.Clusters[1].Cluster.Name != "west" {
+		t.Fatalf("got clusters %+v; want east, west", plan.Clusters)
+	}
+	var east []string
+	for _, action := range plan.Clusters[0].Actions {
+		east = append(east, string(action.Kind)+" "+action.Source.String())
+	}
+	expected := []string{
+		"update github.com/opentable/c",
+		"scale github.com/opentable/b",
+		"delete github.com/opentable/d",
+	}
+	if !reflect.DeepEqual(east, expected) {
+		t.Errorf("got east actions %q; want %q", east, expected)
+	}
+	west := plan.Clusters[1].Actions
+	if len(west) != 1 || west[0].Kind != ActionCreate || !reflect.DeepEqual(*west[0].Desired, v1) || west[0].Observed != nil {
+		t.Errorf("got west actions %+v; want create a", west)
+	}
+	if changes := plan.Clusters[0].Actions[0].Changes(); !reflect.DeepEqual(changes,
+		[]string{"Version 1.0.0 -> 2.0.0", "NumInstances 1 -> 3"}) {
+		t.Errorf("got changes %q", changes)
+	}
+	if plan.Empty() {
+		t.Error("plan is empty")
+	}
+
+	observed["west"] = ClusterDeployments{a: v1}
+	observed["east"] = desired.Cluster("east")
+	observed["east"][a] = Deployment{Version: "1.0.0", NumInstances: 1, Env: EnvVars{}}
+	if plan, err := Resolve(desired, observed, clusters); err != nil || !plan.Empty() {
+		t.Errorf("resolving matching clusters: got %+v, %v; want empty plan", plan, err)
+	}
+
+	delete(observed, "west")
+	if _, err := Resolve(desired, observed, clusters); err == nil {
+		t.Error("resolving unobserved cluster: got nil error")
+	}
+	if _, err := Resolve(desired, observed, clusters[1:]); err == nil {
+		t.Error("resolving deployment to unknown cluster: got nil error")
+	}
+}
@@ -0,0 +1,54 @@
+package sous
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Policy contains organisation-wide rules that Sous applies to the
+	// things it builds and deploys.
+	Policy struct {
+		// Dockerfile configures the rules checked when linting Dockerfiles.
+		Dockerfile DockerfilePolicy
+	}
+	// DockerfilePolicy configures the rules checked by LintDockerfile. The
+	// zero value checks the default rules at their default severities.
+	DockerfilePolicy struct {
+		// RequiredLabels are label keys that every image must have.
+		RequiredLabels []string
+		// AllowedRegistries are the only registries base images may come
+		// from. Images on Docker Hub are in the registry "docker.io". If
+		// empty, base images may come from any registry.
+		AllowedRegistries []string
+		// Severities overrides the severity of rules, keyed by rule name.
+		// Setting a rule's severity to "off" disables it.
+		Severities map[string]Severity
+	}
+)
+
+// Validate returns an error if p configures rules which do not exist.
+func (p Policy) Validate() error {
+	if err := p.Dockerfile.Validate(); err != nil {
+		return fmt.Errorf("Policy.Dockerfile: %s", err)
+	}
+	return nil
+}
+
+// Validate returns an error if Severities names a rule which does not exist,
+// or a severity other than error, warning, info or off.
+func (p DockerfilePolicy) Validate() error {
+	for r, s := range p.Severities {
+		if _, ok := dockerfileRules[r]; !ok {
+			return fmt.Errorf("Severities: unknown rule %q, the rules are %s",
+				r, strings.Join(dockerfileRuleNames(), ", "))
+		}
+		switch s {
+		case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+		default:
+			return fmt.Errorf("Severities: rule %s has unknown severity %q, "+
+				"use error, warning, info or off", r, s)
+		}
+	}
+	return nil
+}
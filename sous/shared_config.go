@@ -0,0 +1,25 @@
+package sous
+
+type (
+	// SharedConfig is organisation-wide configuration, published by the Sous
+	// server named in Config.Server.
+	SharedConfig struct {
+		// Clusters are the clusters applications may be deployed to.
+		Clusters Clusters `yaml:",omitempty"`
+		// Buildpacks names the registered buildpacks which may be used to
+		// build projects. If it is empty, all of them may be used. Names
+		// unknown to this version of Sous are ignored.
+		Buildpacks []string `yaml:",omitempty"`
+		// Contracts are the platform contracts images may be required to
+		// pass.
+		Contracts Contracts `yaml:",omitempty"`
+		// ContractVerificationKey is the PEM encoded ECDSA public key
+		// contract records are verified with, the public half of the
+		// ContractSigningKey of those who record contract results, e.g.
+		// output by "openssl ec -pubout".
+		ContractVerificationKey string `yaml:",omitempty"`
+		// DockerRegistry is the registry clusters pull images from, e.g.
+		// docker.example.com. See ImageRef.
+		DockerRegistry string `yaml:",omitempty"`
+	}
+)
@@ -1,5 +1,7 @@
 package sous
 
+import "path/filepath"
+
 type (
 	// SourceContext contains contextual information about the source code being
 	// built.
@@ -9,9 +11,45 @@ type (
 		Tags                                 []Tag
 		NearestTagName                       string
 		DirtyWorkingTree                     bool
+		// RemoteURL is the URL of the origin remote, if there is one.
+		RemoteURL string
+		// NearestSemverTagName is the name of the nearest tag reachable from
+		// Revision which is a semver version, e.g. "v1.2.3". It is empty if
+		// there is no such tag.
+		NearestSemverTagName string
+		// CommitsSinceSemverTag is the number of commits since
+		// NearestSemverTagName, or since the first commit if there is no such
+		// tag.
+		CommitsSinceSemverTag int
 	}
 	// Tag represents a revision control commit tag.
 	Tag struct {
 		Name, Revision string
 	}
 )
+
+// Source returns the Source identifying this source code: its remote URL, and
+// its offset within the repository.
+func (s *SourceContext) Source() Source {
+	dir := s.OffsetDir
+	if dir == "." {
+		dir = ""
+	}
+	return Source{RepoURL: RepoURL(s.RemoteURL), RepoDir: dir}
+}
+
+// SourceDir returns the directory containing the source code, that is OffsetDir
+// inside RootDir.
+func (s *SourceContext) SourceDir() string {
+	return filepath.Join(s.RootDir, s.OffsetDir)
+}
+
+// HasFile returns true if path is one of the tracked Files.
+func (s *SourceContext) HasFile(path string) bool {
+	for _, f := range s.Files {
+		if f == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package sous
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// Span is a single operation, e.g. a shell command or an HTTP request, within
+// a trace: all the work done on behalf of one invocation of Sous, which may
+// span several processes. Spans form a tree, each span but the root having a
+// parent, so the messages about one sous build or deployment can be found by
+// their trace ID, and ordered by their spans.
+type Span struct {
+	// TraceID identifies the trace, it is the correlation ID shared by every
+	// span in it: 32 hex digits.
+	TraceID string
+	// ID identifies the span within the trace: 16 hex digits.
+	ID string
+	// ParentID is the ID of the span's parent, empty for the root span.
+	ParentID string
+	// Name describes the operation, e.g. "GET /gdm".
+	Name string
+}
+
+// traceParentPattern matches W3C Trace Context traceparent values, capturing
+// the trace ID and parent span ID.
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// NewTrace returns the root span of a new trace, named name.
+func NewTrace(name string) Span {
+	return Span{TraceID: randomHex(16), ID: randomHex(8), Name: name}
+}
+
+// Child returns a new span in the same trace as s, named name, whose parent is
+// s.
+func (s Span) Child(name string) Span {
+	return Span{TraceID: s.TraceID, ID: randomHex(8), ParentID: s.ID, Name: name}
+}
+
+// TraceParent returns s as the value of a W3C Trace Context traceparent HTTP
+// header, e.g. "00-<trace ID>-<span ID>-01", so that the receiver can
+// continue the trace in child spans of s. Sous also passes it to commands it
+// runs, in the TRACEPARENT environment variable.
+func (s Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.ID)
+}
+
+// ParseTraceParent returns the span described by a traceparent value, see
+// TraceParent. Its name and parent ID are unknown, so are empty. It returns
+// false if traceparent is not valid.
+func ParseTraceParent(traceparent string) (Span, bool) {
+	m := traceParentPattern.FindStringSubmatch(traceparent)
+	if m == nil || m[1] == zeroHex(32) || m[2] == zeroHex(16) {
+		return Span{}, false
+	}
+	return Span{TraceID: m[1], ID: m[2]}, true
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %s", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func zeroHex(digits int) string {
+	return fmt.Sprintf("%0*d", digits, 0)
+}
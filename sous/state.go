@@ -0,0 +1,282 @@
+package sous
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opentable/sous/util/yaml"
+)
+
+type (
+	// State is Sous State: the organisation's shared configuration, and the
+	// Global Deployment Manifest.
+	State struct {
+		// Config is the configuration shared with all Sous clients.
+		Config SharedConfig
+		// GDM is the Global Deployment Manifest.
+		GDM GDM
+	}
+	// GDM is the Global Deployment Manifest, which declares every
+	// application the organisation deploys, and where.
+	GDM struct {
+		Applications Applications `yaml:",omitempty"`
+	}
+)
+
+const (
+	// StateConfigFile is the name of the file containing the shared config in
+	// a state tree.
+	StateConfigFile = "config.yaml"
+	// StateManifestsDir is the name of the directory containing a file for
+	// each application in a state tree. Each file is named after the
+	// application's source, see Source.Path.
+	StateManifestsDir = "manifests"
+)
+
+// LoadState loads the state at location, which may be a pre-compiled state
+// file, or a directory containing a state tree. If location is empty, the
+// state is empty. Loaded states have their applications sorted, and are
+// guaranteed to save and load again unchanged.
+func LoadState(location string) (*State, error) {
+	if location == "" {
+		return &State{}, nil
+	}
+	fi, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return LoadStateTree(location)
+	}
+	return LoadStateFile(location)
+}
+
+// SaveState saves s to location. If location is an existing directory, or
+// does not have a .yaml, .yml or .json extension, s is saved as a state tree,
+// otherwise as a pre-compiled state file.
+func SaveState(s *State, location string) error {
+	if fi, err := os.Stat(location); err == nil && fi.IsDir() || !isStateFileName(location) {
+		return SaveStateTree(s, location)
+	}
+	return SaveStateFile(s, location)
+}
+
+func isStateFileName(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// LoadStateFile loads a pre-compiled state file, which may be YAML or JSON.
+func LoadStateFile(path string) (*State, error) {
+	s := &State{}
+	if err := readYAML(path, s); err != nil {
+		return nil, err
+	}
+	sort.Sort(s.GDM.Applications)
+	return s, s.validate(path)
+}
+
+// SaveStateFile saves s as a single YAML file at path.
+func SaveStateFile(s *State, path string) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	return writeYAML(path, s)
+}
+
+// LoadStateTree loads a state tree from dir. The tree contains the shared
+// config in StateConfigFile, and one YAML file for each application in
+// StateManifestsDir. Other files are ignored.
+func LoadStateTree(dir string) (*State, error) {
+	s := &State{}
+	configPath := filepath.Join(dir, StateConfigFile)
+	if _, err := os.Stat(configPath); err == nil {
+		if err := readYAML(configPath, &s.Config); err != nil {
+			return nil, err
+		}
+	}
+	paths, err := manifestFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		a := Application{}
+		if err := readYAML(path, &a); err != nil {
+			return nil, err
+		}
+		expected, err := a.Source.manifestPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if expected != path {
+			return nil, fmt.Errorf("%s: application %s should be in %s", path, a.Source, expected)
+		}
+		s.GDM.Applications = append(s.GDM.Applications, a)
+	}
+	sort.Sort(s.GDM.Applications)
+	return s, s.validate(dir)
+}
+
+// SaveStateTree saves s as a state tree in dir, creating it if necessary. It
+// removes the files of applications which are no longer in s, but leaves all
+// other files alone.
+func SaveStateTree(s *State, dir string) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if err := writeYAML(filepath.Join(dir, StateConfigFile), s.Config); err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, a := range s.GDM.Applications {
+		path, err := a.Source.manifestPath(dir)
+		if err != nil {
+			return err
+		}
+		if err := writeYAML(path, a); err != nil {
+			return err
+		}
+		keep[path] = true
+	}
+	paths, err := manifestFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if keep[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removeEmptyDirs(filepath.Dir(path), filepath.Join(dir, StateManifestsDir))
+	}
+	return nil
+}
+
+// Validate returns an error describing every problem with s: applications
+// with the same source, invalid deployments, deployments to clusters not in
+// s.Config.Clusters, and invalid contracts.
+func (s *State) Validate() error {
+	var problems []string
+	seen := map[Source]bool{}
+	for _, a := range s.GDM.Applications {
+		if seen[a.Source] {
+			problems = append(problems, fmt.Sprintf("%s: defined more than once", a.Source))
+		}
+		seen[a.Source] = true
+		clusters := make([]string, 0, len(a.Deployments))
+		for name := range a.Deployments {
+			clusters = append(clusters, name)
+		}
+		sort.Strings(clusters)
+		for _, name := range clusters {
+			if _, ok := s.Config.Clusters.Named(name); !ok {
+				problems = append(problems, fmt.Sprintf("%s: no cluster named %q", a.Source, name))
+			}
+			if err := a.Deployments[name].Validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s in %s: %s", a.Source, name, err))
+			}
+		}
+	}
+	for _, c := range s.Config.Clusters {
+		for _, name := range c.RequiredContracts {
+			if _, ok := s.Config.Contracts.Named(name); !ok {
+				problems = append(problems, fmt.Sprintf("cluster %s: requires undefined contract %q", c.Name, name))
+			}
+		}
+	}
+	if err := s.Config.Contracts.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid state:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// validate validates s, which was loaded from location.
+func (s *State) validate(location string) error {
+	if err := s.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", location, err)
+	}
+	return nil
+}
+
+// manifestPath returns the path of the file for the application with source s
+// in the state tree in dir.
+func (s Source) manifestPath(dir string) (string, error) {
+	p, err := s.RepoURL.Path()
+	if err != nil {
+		return "", err
+	}
+	if s.RepoDir != "" {
+		p += "/" + s.RepoDir
+	}
+	return filepath.Join(dir, StateManifestsDir, filepath.FromSlash(p)) + ".yaml", nil
+}
+
+// manifestFiles returns the paths of all application files in the state tree
+// in dir.
+func manifestFiles(dir string) ([]string, error) {
+	var paths []string
+	root := filepath.Join(dir, StateManifestsDir)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && filepath.Ext(path) == ".yaml" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// removeEmptyDirs removes dir, and each of its parents up to but not including
+// root, while they are empty.
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func readYAML(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("reading %s: %s", path, err)
+	}
+	return nil
+}
+
+// writeYAML writes v to path atomically, creating its directory if necessary.
+func writeYAML(path string, v interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,145 @@
+package sous
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testState() *State {
+	s := &State{}
+	s.Config.Clusters = Clusters{
+		{Name: "east", Kind: "singularity", URL: "http://east", DefaultEnv: EnvVars{"DC": "east"}},
+		{Name: "west", Kind: "singularity", URL: "http://west"},
+	}
+	s.GDM.Applications = Applications{
+		{
+			Source: Source{RepoURL: "github.com/opentable/a"},
+			Deployments: Deployments{
+				"east": {Version: "1.2.3", NumInstances: 2, Env: EnvVars{"X": "1"},
+					Resources: Resources{CPUs: 0.5, MemoryMB: 256, Ports: 1}},
+				"west": {Version: "1.2.4-rc.1+abc", NumInstances: 1},
+			},
+		},
+		{Source: Source{RepoURL: "github.com/opentable/a", RepoDir: "sub/dir"}},
+		{Source: Source{RepoURL: "github.com/opentable/b"}},
+	}
+	return s
+}
+
+func TestState_RoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	expected := testState()
+	file := filepath.Join(dir, "state.yaml")
+	tree := filepath.Join(dir, "tree")
+	for _, location := range []string{file, tree} {
+		if err := SaveState(expected, location); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := LoadState(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: got %#v; want %#v", location, actual, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tree, "manifests/github.com/opentable/a/sub/dir.yaml")); err != nil {
+		t.Error(err)
+	}
+
+	// A tree saved from a file, and compiled again, is identical.
+	fromTree, err := LoadState(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := filepath.Join(dir, "again.yaml")
+	if err := SaveState(fromTree, again); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ioutil.ReadFile(file)
+	b, _ := ioutil.ReadFile(again)
+	if string(a) != string(b) {
+		t.Errorf("compiled files differ:\n%s\n---\n%s", a, b)
+	}
+}
+
+func TestSaveStateTree_RemovesApplications(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := testState()
+	if err := SaveStateTree(s, dir); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "README.md")
+	if err := ioutil.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.GDM.Applications = s.GDM.Applications[:1]
+	if err := SaveStateTree(s, dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadStateTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.GDM.Applications) != 1 {
+		t.Errorf("got %d applications; want 1", len(loaded.GDM.Applications))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifests/github.com/opentable/a/sub")); !os.IsNotExist(err) {
+		t.Errorf("empty directory not removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file removed")
+	}
+}
+
+func TestState_Validate(t *testing.T) {
+	s := testState()
+	s.GDM.Applications = append(s.GDM.Applications, Application{
+		Source: Source{RepoURL: "github.com/opentable/b"},
+		Deployments: Deployments{
+			"north": {Version: "1.0.0"},
+			"west":  {Version: "latest", NumInstances: -1},
+		},
+	})
+	err := s.Validate()
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	for _, expected := range []string{
+		"github.com/opentable/b: defined more than once",
+		`github.com/opentable/b: no cluster named "north"`,
+		`github.com/opentable/b in west: version "latest" is not a semver version`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error does not contain %q:\n%s", expected, err)
+		}
+	}
+}
+
+func TestRepoURL_Path(t *testing.T) {
+	for url, expected := range map[RepoURL]string{
+		"github.com/opentable/sous":             "github.com/opentable/sous",
+		"git@github.com:opentable/sous.git":     "github.com/opentable/sous",
+		"https://github.com/opentable/sous.git": "github.com/opentable/sous",
+		"ssh://git@github.com/opentable/sous":   "github.com/opentable/sous",
+		"../etc/passwd":                         "",
+		"":                                      "",
+	} {
+		actual, err := url.Path()
+		if actual != expected || (expected == "") != (err != nil) {
+			t.Errorf("%q.Path() = %q, %v; want %q", url, actual, err, expected)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sous
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samsalisbury/semv"
+)
+
+// ParseSemverTag parses a tag name as a semver version, allowing an optional
+// leading "v", e.g. "v1.2.3". It returns false if name is not a valid semver 2
+// version.
+func ParseSemverTag(name string) (semv.Version, bool) {
+	v, err := semv.ParseExactSemver2(strings.TrimPrefix(name, "v"))
+	return v, err == nil
+}
+
+// Version returns the version of the source code in s.
+//
+// If Revision has a semver tag, and the working tree is clean, that is a
+// release, and its version is the tag's version. Where Revision has more than
+// one semver tag, the greatest is used.
+//
+// Otherwise, the version is a prerelease of the next patch version after the
+// nearest semver tag (or 0.0.1 if there is none), e.g. 1.2.4-dev.5+abcdef0,
+// where 5 is the number of commits since that tag and abcdef0 is the short
+// revision. If the working tree is dirty, ".dirty" is added to the build
+// metadata.
+func (s *SourceContext) Version() semv.Version {
+	if v, ok := s.exactSemverTag(); ok && !s.DirtyWorkingTree {
+		return v
+	}
+	base := semv.NewMajorMinorPatch(0, 0, 0)
+	if v, ok := ParseSemverTag(s.NearestSemverTagName); ok {
+		base = v.MajorMinorPatch()
+		// Versions remember the format they were parsed from, reset that so
+		// the prerelease and metadata added below are included.
+		base.DefaultFormat = ""
+	}
+	meta := shortRevision(s.Revision)
+	if s.DirtyWorkingTree {
+		meta += ".dirty"
+	}
+	meta = strings.TrimPrefix(meta, ".")
+	return base.IncrementPatch().
+		SetPre(fmt.Sprintf("dev.%d", s.CommitsSinceSemverTag)).
+		SetMeta(meta)
+}
+
+// exactSemverTag returns the greatest semver version tagged at Revision.
+func (s *SourceContext) exactSemverTag() (semv.Version, bool) {
+	var (
+		greatest semv.Version
+		found    bool
+	)
+	if s.Revision == "" {
+		return greatest, false
+	}
+	for _, t := range s.Tags {
+		if t.Revision != s.Revision {
+			continue
+		}
+		if v, ok := ParseSemverTag(t.Name); ok && (!found || greatest.Less(v)) {
+			greatest, found = v, true
+		}
+	}
+	return greatest, found
+}
+
+// DockerTag returns v formatted as a valid docker tag. Docker tags may not
+// contain "+", so the build metadata separator is replaced with "_".
+func DockerTag(v semv.Version) string {
+	return strings.Replace(v.String(), "+", "_", -1)
+}
+
+// shortRevision returns the abbreviated form of a git revision.
+func shortRevision(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
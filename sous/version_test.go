@@ -0,0 +1,54 @@
+package sous
+
+import "testing"
+
+const testRevision = "1141dde555492ea0a6073a222b2607900d09b0b5"
+
+func TestSourceContext_Version(t *testing.T) {
+	release := []Tag{{Name: "v1.2.3", Revision: testRevision}}
+	cases := []struct {
+		Context   SourceContext
+		Version   string
+		DockerTag string
+	}{
+		{
+			SourceContext{Revision: testRevision, Tags: release, NearestSemverTagName: "v1.2.3"},
+			"1.2.3", "1.2.3",
+		},
+		{
+			SourceContext{Revision: testRevision, Tags: release, NearestSemverTagName: "v1.2.3", DirtyWorkingTree: true},
+			"1.2.4-dev.0+1141dde.dirty", "1.2.4-dev.0_1141dde.dirty",
+		},
+		{
+			SourceContext{Revision: testRevision, NearestSemverTagName: "1.2.3-beta", CommitsSinceSemverTag: 5},
+			"1.2.4-dev.5+1141dde", "1.2.4-dev.5_1141dde",
+		},
+		{
+			SourceContext{Revision: testRevision, CommitsSinceSemverTag: 12},
+			"0.0.1-dev.12+1141dde", "0.0.1-dev.12_1141dde",
+		},
+		{
+			SourceContext{DirtyWorkingTree: true},
+			"0.0.1-dev.0+dirty", "0.0.1-dev.0_dirty",
+		},
+	}
+	for _, c := range cases {
+		v := c.Context.Version()
+		if v.String() != c.Version {
+			t.Errorf("got version %q; want %q", v, c.Version)
+		}
+		if tag := DockerTag(v); tag != c.DockerTag {
+			t.Errorf("got docker tag %q; want %q", tag, c.DockerTag)
+		}
+	}
+}
+
+func TestParseSemverTag(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"v1.2.3": true, "1.2.3-rc.1": true, "1.2": false, "release": false, "": false,
+	} {
+		if _, ok := ParseSemverTag(name); ok != valid {
+			t.Errorf("ParseSemverTag(%q) returned %t; want %t", name, ok, valid)
+		}
+	}
+}
@@ -110,7 +110,7 @@ func (c *CLI) printTip(tip string) {
 	c.Err.PushStyle(style.Style{style.Blue, style.Bold})
 	c.Err.Printf("Tip: ")
 	c.Err.PopStyle()
-	c.Err.Printfln(tip)
+	c.Err.Println(tip)
 }
 
 // ListSubcommands returns a slice of strings with the names of each subcommand
@@ -165,9 +165,9 @@ func (c *CLI) invoke(base Command, args []string, ff []func(*flag.FlagSet)) Resu
 		if err := fs.Parse(args); err != nil {
 			tip := fmt.Sprintf("for help, use `%s`", c.HelpCommand)
 			if err == flag.ErrHelp {
-				return UsageErrorf(tip)
+				return UsageErrorf("%s", tip)
 			}
-			return UsageErrorf(err.Error()).WithTip(tip)
+			return UsageErrorf("%s", err).WithTip(tip)
 		}
 		// get the remaining args
 		args = fs.Args()
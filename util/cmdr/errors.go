@@ -39,6 +39,9 @@ type (
 	// IOErr signifies that something went wrong with io, to files, or across
 	// the network, for example.
 	IOErr struct{ *cliErr }
+	// DataErr signifies that the data the command was asked to process is
+	// invalid, for example a file that fails validation.
+	DataErr struct{ *cliErr }
 	// UnknownErr is the error of last resort, only to be used if none of the
 	// other error types is applicable.
 	UnknownErr struct{ *cliErr }
@@ -78,6 +81,10 @@ func IOErrorf(format string, v ...interface{}) IOErr {
 	return IOErr{newError(format, v...)}
 }
 
+func DataErrorf(format string, v ...interface{}) DataErr {
+	return DataErr{newError(format, v...)}
+}
+
 func UnknownErrorf(format string, v ...interface{}) UnknownErr {
 	return UnknownErr{newError(format, v...)}
 }
@@ -86,6 +93,7 @@ func (e InternalErr) ExitCode() int { return EX_SOFTWARE }
 func (e UsageErr) ExitCode() int    { return EX_USAGE }
 func (e OSErr) ExitCode() int       { return EX_OSERR }
 func (e IOErr) ExitCode() int       { return EX_IOERR }
+func (e DataErr) ExitCode() int     { return EX_DATAERR }
 func (e UnknownErr) ExitCode() int  { return 255 }
 func (e *cliErr) ExitCode() int     { return 255 }
 
@@ -95,6 +103,9 @@ func (e *cliErr) Error() string {
 	if e.Err == nil {
 		return e.Message
 	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
 	return fmt.Sprintf("%s: %s", e.Message, e.Err)
 }
 
@@ -1,82 +1,262 @@
-// The config package provides JSON-based configuration files, with automatic
-// environment variable overriding.
+// The config package provides layered configuration. Values are loaded from
+// defaults in struct tags, JSON, YAML or TOML files, environment variables, and explicit
+// values such as command line flags, each layer overriding the last.
 package configloader
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"reflect"
-	"strconv"
+	"strings"
 )
 
 func New() ConfigLoader {
 	return ConfigLoader{}
 }
 
-// ConfigLoader loads configuration.
-type ConfigLoader struct {
-	// Log is called with debug level logs about how values are resolved.
-	Debug, Info, Warn func(string)
+type (
+	// ConfigLoader loads configuration.
+	ConfigLoader struct {
+		// Debug, Info and Warn are called, if they are not nil, with logs
+		// about how values are resolved. Debug reports which layer supplied
+		// each field, Info reports which files were loaded, and Warn reports
+		// values which were ignored.
+		Debug, Info, Warn func(string)
+	}
+	// Layer is a source of configuration values.
+	Layer interface {
+		// Name describes this layer to the user, e.g. "user file".
+		Name() string
+		// Apply sets each field of target, a pointer to a struct, which this
+		// layer has a value for, and returns the paths of those fields (see
+		// Field.Path).
+		Apply(target interface{}) ([]string, error)
+	}
+	// Validator is implemented by config structs which check their values
+	// further than their Schema can, e.g. that a map key names something
+	// which exists.
+	Validator interface {
+		// Validate returns an error if the values are invalid.
+		Validate() error
+	}
+	// Sources maps the path of each field set by a layer to the name of the
+	// last layer which set it.
+	Sources map[string]string
+	// defaultsLayer sets fields from their default struct tags.
+	defaultsLayer struct{}
+	// fileLayer sets fields from a config file.
+	fileLayer struct{ name, path string }
+	// envLayer sets fields from the environment variables named in their
+	// env struct tags.
+	envLayer struct{}
+	// valuesLayer sets fields from a map of field paths to values.
+	valuesLayer struct {
+		name   string
+		values map[string]string
+	}
+)
+
+// Defaults is a layer which sets fields from their default struct tags, e.g.
+// `default:"30s"`. Values are parsed as by Field.Set.
+func Defaults() Layer { return defaultsLayer{} }
+
+// File is a layer which loads the file at path, which may be JSON, YAML or
+// TOML according to its extension (see FormatOf). Maps in the file are merged
+// with existing values, all other fields are replaced. It is not an error if
+// the file does not exist, or if path is empty. Errors in the file are
+// reported as a *FileError.
+func File(name, path string) Layer { return fileLayer{name, path} }
+
+// Env is a layer which sets fields from the environment variables named in
+// their env struct tags, e.g. `env:"SOUS_SERVER"`. Empty variables are ignored.
+// Values are parsed as by Field.Set.
+func Env() Layer { return envLayer{} }
+
+// Values is a layer which sets fields from values, a map of field paths to
+// values, parsed as by Field.Set. Paths are matched case-insensitively.
+func Values(name string, values map[string]string) Layer {
+	return valuesLayer{name, values}
 }
 
+// Load loads defaults, then the file at filePath, then the environment
+// into target, which must be a pointer to a struct. It is not an error if the
+// file does not exist.
 func (cl ConfigLoader) Load(target interface{}, filePath string) error {
+	_, err := cl.LoadLayers(target, Defaults(), File("file", filePath), Env())
+	return err
+}
+
+// LoadLayers applies each layer to target in order, so that later layers take
+// precedence. It returns the Sources of all fields which were set.
+//
+// Files are validated against the Schema of target before they are applied;
+// invalid files are skipped, and loading continues so that all problems can be
+// reported together as ValidationErrors. The formats of values set by other
+// layers are validated once all layers have been applied, and then, if target
+// is a Validator, so is target itself.
+func (cl ConfigLoader) LoadLayers(target interface{}, layers ...Layer) (Sources, error) {
 	if target == nil {
-		return fmt.Errorf("target was nil, need a value")
+		return nil, fmt.Errorf("target was nil, need a value")
+	}
+	if _, err := Fields(target); err != nil {
+		return nil, err
+	}
+	sources := Sources{}
+	files := map[string]bool{}
+	invalid := ValidationErrors{}
+	for _, l := range layers {
+		if f, ok := l.(fileLayer); ok {
+			files[f.name] = true
+			if err := cl.checkFile(f); err != nil {
+				return sources, err
+			}
+		}
+		if _, ok := l.(envLayer); ok {
+			cl.checkEnv(target)
+		}
+		paths, err := l.Apply(target)
+		if errs, ok := err.(ValidationErrors); ok {
+			invalid = append(invalid, errs...)
+			continue
+		}
+		if err != nil {
+			if fe, ok := err.(*FileError); ok {
+				return sources, fe
+			}
+			return sources, fmt.Errorf("%s: %s", l.Name(), err)
+		}
+		for _, p := range paths {
+			sources[p] = l.Name()
+			cl.log(cl.Debug, "%s set by %s", p, l.Name())
+		}
+	}
+	invalid = append(invalid, checkFields(target, sources, files)...)
+	if len(invalid) != 0 {
+		return sources, invalid
 	}
-	if err := cl.loadJSONFile(target, filePath); err != nil {
-		return err
+	if v, ok := target.(Validator); ok {
+		return sources, v.Validate()
 	}
-	return cl.overrideWithEnv(target)
+	return sources, nil
 }
 
-func (cl ConfigLoader) overrideWithEnv(target interface{}) error {
-	v := reflect.ValueOf(target)
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("target was %T; need a struct", target)
+// checkFile reports whether f exists.
+func (cl ConfigLoader) checkFile(f fileLayer) error {
+	_, exists, err := f.read()
+	if fe, ok := err.(*FileError); ok {
+		return fe
 	}
-	t := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		if err := cl.overrideField(t.Field(i), v.Field(i)); err != nil {
-			return err
-		}
+	if err != nil {
+		return fmt.Errorf("%s: %s", f.name, err)
+	}
+	if !exists && f.path != "" {
+		cl.log(cl.Info, "%s %s not found, skipping", f.name, f.path)
+	}
+	if exists {
+		cl.log(cl.Info, "loading %s %s", f.name, f.path)
 	}
 	return nil
 }
 
-func (cl ConfigLoader) overrideField(sf reflect.StructField, originalVal reflect.Value) error {
-	tag := sf.Tag.Get("env")
-	if tag == "" {
-		return nil
-	}
-	envStr := os.Getenv(tag)
-	if envStr == "" {
-		return nil
-	}
-	var finalVal reflect.Value
-	switch vt := originalVal.Interface().(type) {
-	default:
-		return fmt.Errorf("unable to override fields of type %T", originalVal.Interface())
-	case string:
-		finalVal = reflect.ValueOf(vt)
-	case int:
-		i, err := strconv.Atoi(envStr)
-		if err != nil {
-			return err
+// checkEnv warns about environment variables named by fields of target which
+// are set but empty, since they do not override values from other layers.
+func (cl ConfigLoader) checkEnv(target interface{}) {
+	fields, err := Fields(target)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.Env); f.Env != "" && ok && v == "" {
+			cl.log(cl.Warn, "%s is set but empty, ignoring it", f.Env)
 		}
-		finalVal = reflect.ValueOf(i)
 	}
-	originalVal.Set(finalVal)
-	return nil
 }
 
-func (cl ConfigLoader) loadJSONFile(target interface{}, filePath string) error {
-	if filePath == "" {
-		return fmt.Errorf("filepath was empty")
+func (cl ConfigLoader) log(to func(string), format string, v ...interface{}) {
+	if to != nil {
+		to(fmt.Sprintf(format, v...))
 	}
-	f, err := os.Open(filePath)
+}
+
+func (defaultsLayer) Name() string { return "default" }
+
+func (defaultsLayer) Apply(target interface{}) ([]string, error) {
+	return setFields(target, func(f Field) (string, bool) {
+		return f.Default, f.Default != ""
+	})
+}
+
+func (f fileLayer) Name() string { return f.name }
+
+func (f fileLayer) Apply(target interface{}) ([]string, error) {
+	d, exists, err := f.read()
+	if err != nil || !exists {
+		return nil, err
+	}
+	return d.apply(target)
+}
+
+// read returns the contents of this file, and whether it exists.
+func (f fileLayer) read() (*document, bool, error) {
+	if f.path == "" {
+		return nil, false, nil
+	}
+	return readDocument(f.path)
+}
+
+func (envLayer) Name() string { return "env" }
+
+func (envLayer) Apply(target interface{}) ([]string, error) {
+	return setFields(target, func(f Field) (string, bool) {
+		if f.Env == "" {
+			return "", false
+		}
+		v := os.Getenv(f.Env)
+		return v, v != ""
+	})
+}
+
+func (v valuesLayer) Name() string { return v.name }
+
+func (v valuesLayer) Apply(target interface{}) ([]string, error) {
+	fields, err := Fields(target)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var paths []string
+	for path, value := range v.values {
+		found := false
+		for _, f := range fields {
+			if strings.EqualFold(f.Path, path) {
+				if err := f.Set(value); err != nil {
+					return nil, err
+				}
+				paths = append(paths, f.Path)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such field %q", path)
+		}
+	}
+	return paths, nil
+}
+
+// setFields sets each field of target for which value returns true.
+func setFields(target interface{}, value func(Field) (string, bool)) ([]string, error) {
+	fields, err := Fields(target)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range fields {
+		v, ok := value(f)
+		if !ok {
+			continue
+		}
+		if err := f.Set(v); err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.Path)
 	}
-	return json.NewDecoder(f).Decode(target)
+	return paths, nil
 }
@@ -0,0 +1,107 @@
+package configloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type layeredConfig struct {
+	Server  string `env:"TEST_LAYERED_SERVER" default:"http://default"`
+	Retries int    `default:"1"`
+	Nested  struct {
+		Enabled bool          `default:"true"`
+		Timeout time.Duration `default:"10s"`
+		Names   []string
+		Levels  map[string]string
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	system := filepath.Join(dir, "system.json")
+	user := filepath.Join(dir, "user.json")
+	writeFile(t, system, `{"Retries": 2, "Nested": {"Levels": {"a": "1"}, "Names": ["x"]}}`)
+	writeFile(t, user, `{"retries": 3, "Nested": {"Enabled": false, "Levels": {"b": "2"}}}`)
+	os.Setenv("TEST_LAYERED_SERVER", "http://env")
+	defer os.Unsetenv("TEST_LAYERED_SERVER")
+
+	var logs []string
+	log := func(m string) { logs = append(logs, m) }
+	cl := ConfigLoader{Debug: log, Info: log}
+	c := layeredConfig{}
+	sources, err := cl.LoadLayers(&c,
+		Defaults(),
+		File("system file", system),
+		File("user file", user),
+		File("repo file", filepath.Join(dir, "missing.json")),
+		Env(),
+		Values("flags", map[string]string{"nested.timeout": "1m"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Server != "http://env" || c.Retries != 3 || c.Nested.Enabled ||
+		c.Nested.Timeout != time.Minute || len(c.Nested.Names) != 1 ||
+		c.Nested.Levels["a"] != "1" || c.Nested.Levels["b"] != "2" {
+		t.Errorf("config not loaded correctly: %+v", c)
+	}
+	expected := Sources{
+		"Server":         "env",
+		"Retries":        "user file",
+		"Nested.Enabled": "user file",
+		"Nested.Timeout": "flags",
+		"Nested.Names":   "system file",
+		"Nested.Levels":  "user file",
+	}
+	for path, source := range expected {
+		if sources[path] != source {
+			t.Errorf("got source %q for %s; want %q", sources[path], path, source)
+		}
+	}
+	all := strings.Join(logs, "\n")
+	for _, want := range []string{"loading user file", "missing.json not found", "Server set by env"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("logs do not contain %q:\n%s", want, all)
+		}
+	}
+}
+
+func TestLoadLayers_EmptyEnv(t *testing.T) {
+	os.Setenv("TEST_LAYERED_SERVER", "")
+	defer os.Unsetenv("TEST_LAYERED_SERVER")
+	var warnings []string
+	cl := ConfigLoader{Warn: func(m string) { warnings = append(warnings, m) }}
+	c := layeredConfig{}
+	if _, err := cl.LoadLayers(&c, Defaults(), Env()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "http://default" {
+		t.Errorf("got Server %q; want the default", c.Server)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "TEST_LAYERED_SERVER is set but empty") {
+		t.Errorf("got warnings %q", warnings)
+	}
+}
+
+func TestLoadLayers_UnknownValue(t *testing.T) {
+	c := layeredConfig{}
+	_, err := New().LoadLayers(&c, Values("flags", map[string]string{"Nope": "1"}))
+	if err == nil {
+		t.Fatal("got nil error; want an error for an unknown field")
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
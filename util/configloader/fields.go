@@ -0,0 +1,307 @@
+package configloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a single configurable field of a config struct.
+type Field struct {
+	// Path is the name of the field, prefixed by the names of any structs
+	// containing it, separated by dots, e.g. "Policy.Dockerfile.Severities".
+	Path string
+	// Key is the path of the field in config files. It is like Path, but uses
+	// names from json tags where present. It is empty if the field, or a
+	// struct containing it, is tagged json:"-".
+	Key string
+	// Env is the environment variable which overrides this field, from its
+	// env tag. It may be empty.
+	Env string
+	// Default is the default value of this field, from its default tag. It
+	// may be empty.
+	Default string
+	// Format is the format of this field's value, from its format tag, e.g.
+	// "uri". It may be empty. See NewSchema for the supported formats.
+	Format string
+	// Secret is true if this field is tagged secret:"true". Secret values
+	// are not shown by Redacted, nor written by Dump.
+	Secret bool
+	// Value is the value of the field, it is settable.
+	Value reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Fields returns all the fields of the struct pointed to by target, including
+// the fields of nested structs, but not the structs themselves. Unexported
+// fields are ignored.
+func Fields(target interface{}) ([]Field, error) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("target was %T; need a pointer to a struct", target)
+	}
+	return fields(v.Elem(), "", "", true), nil
+}
+
+// fields returns the fields of v. Paths are prefixed by prefix, and keys by
+// keyPrefix if inFiles is true, otherwise keys are empty.
+func fields(v reflect.Value, prefix, keyPrefix string, inFiles bool) []Field {
+	var fs []Field
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		path := prefix + sf.Name
+		name := jsonName(sf)
+		key := ""
+		if inFiles && name != "" {
+			key = keyPrefix + name
+		}
+		if sf.Type.Kind() == reflect.Struct {
+			fs = append(fs, fields(v.Field(i), path+".", key+".", key != "")...)
+			continue
+		}
+		fs = append(fs, Field{
+			Path:    path,
+			Key:     key,
+			Format:  sf.Tag.Get("format"),
+			Env:     sf.Tag.Get("env"),
+			Default: sf.Tag.Get("default"),
+			Secret:  sf.Tag.Get("secret") == "true",
+			Value:   v.Field(i),
+		})
+	}
+	return fs
+}
+
+// jsonName returns the name of sf in config files, which is its name in its
+// json tag if it has one, or its field name. It returns the empty string if sf
+// is tagged json:"-".
+func jsonName(sf reflect.StructField) string {
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return sf.Name
+	}
+	return name
+}
+
+// Set parses s according to the type of this field, and sets it. Slices are
+// parsed from comma-separated lists, and maps from comma-separated key=value
+// pairs.
+func (f Field) Set(s string) error {
+	v, err := parseValue(f.Value.Type(), s)
+	if err != nil {
+		return fmt.Errorf("%s: %s", f.Path, err)
+	}
+	f.Value.Set(v)
+	return nil
+}
+
+// String returns the value of this field, formatted the way Set parses it.
+func (f Field) String() string {
+	v := f.Value
+	switch v.Kind() {
+	case reflect.Slice:
+		s := make([]string, v.Len())
+		for i := range s {
+			s[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(s, ",")
+	case reflect.Map:
+		s := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			s = append(s, fmt.Sprintf("%v=%v", k.Interface(), v.MapIndex(k).Interface()))
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Redacted is like String, but if this field is secret, and set, it returns
+// "(secret)" instead of its value.
+func (f Field) Redacted() string {
+	s := f.String()
+	if f.Secret && s != "" {
+		return "(secret)"
+	}
+	return s
+}
+
+func parseValue(t reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		v.SetInt(int64(d))
+		return v, err
+	}
+	switch t.Kind() {
+	default:
+		return v, fmt.Errorf("unable to set fields of type %s", t)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, fmt.Errorf("%q is not a boolean", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("%q is not an unsigned integer", s)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(t, 0, 0))
+		for _, item := range splitList(s) {
+			e, err := parseValue(t.Elem(), item)
+			if err != nil {
+				return v, err
+			}
+			v.Set(reflect.Append(v, e))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		for _, item := range splitList(s) {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return v, fmt.Errorf("%q is not a key=value pair", item)
+			}
+			k, err := parseValue(t.Key(), kv[0])
+			if err != nil {
+				return v, err
+			}
+			e, err := parseValue(t.Elem(), kv[1])
+			if err != nil {
+				return v, err
+			}
+			v.SetMapIndex(k, e)
+		}
+	}
+	return v, nil
+}
+
+// splitList splits a comma-separated list, trimming space around each item. An
+// empty string is an empty list.
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// FileHasField returns true if the config file at filePath sets the field at
+// key (see Field.Key). It returns false if the file does not exist.
+func FileHasField(filePath, key string) (bool, error) {
+	d, _, err := readDocument(filePath)
+	if err != nil {
+		return false, err
+	}
+	_, ok := lookupPath(d.values, strings.Split(key, "."))
+	return ok, nil
+}
+
+// SetFileField sets the field at key (see Field.Key) in the config file at
+// filePath to value, leaving all other fields as they are. The file is written
+// in the format given by its extension; comments in YAML and TOML files are not
+// preserved. The file and its directory are created if necessary, and the file
+// is replaced atomically.
+//
+// The updated file is first loaded into target, a pointer to a struct, as by
+// File. If it does not satisfy the Schema of target, or target is a Validator
+// which returns an error, the file is left unchanged and ValidationErrors are
+// returned.
+func SetFileField(target interface{}, filePath, key string, value interface{}) error {
+	d, _, err := readDocument(filePath)
+	if err != nil {
+		return err
+	}
+	names := strings.Split(key, ".")
+	last := len(names) - 1
+	parent := d.values
+	for _, name := range names[:last] {
+		child, ok := lookupPath(parent, []string{name})
+		childMap, isMap := child.(map[string]interface{})
+		if !ok || !isMap {
+			childMap = map[string]interface{}{}
+		}
+		deleteKey(parent, name)
+		parent[name] = childMap
+		parent = childMap
+	}
+	deleteKey(parent, names[last])
+	parent[names[last]] = value
+	// value is a Go value, e.g. a []string, so check a copy of the document
+	// as it will be read back.
+	b, err := json.Marshal(d.values)
+	if err != nil {
+		return err
+	}
+	decoded := *d
+	decoded.values = map[string]interface{}{}
+	if err := json.Unmarshal(b, &decoded.values); err != nil {
+		return err
+	}
+	if _, err := decoded.apply(target); err != nil {
+		return err
+	}
+	if v, ok := target.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return ValidationErrors{{File: d.path, Message: err.Error()}}
+		}
+	}
+	return d.write()
+}
+
+// lookupPath finds the value at path in m. Like encoding/json, it matches
+// keys case-insensitively.
+func lookupPath(m map[string]interface{}, path []string) (interface{}, bool) {
+	for k, v := range m {
+		if !strings.EqualFold(k, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			return v, true
+		}
+		if child, ok := v.(map[string]interface{}); ok {
+			return lookupPath(child, path[1:])
+		}
+	}
+	return nil, false
+}
+
+// deleteKey deletes all keys from m which match name case-insensitively.
+func deleteKey(m map[string]interface{}, name string) {
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			delete(m, k)
+		}
+	}
+}
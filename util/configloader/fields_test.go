@@ -0,0 +1,116 @@
+package configloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Server  string `env:"TEST_SERVER"`
+	Retries int
+	Nested  struct {
+		Enabled bool
+		Timeout time.Duration
+		Names   []string
+		Levels  map[string]string
+	}
+	unexported string
+}
+
+func TestFields_Set(t *testing.T) {
+	c := testConfig{}
+	fields, err := Fields(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"Server":         "http://sous.example.com",
+		"Retries":        "3",
+		"Nested.Enabled": "true",
+		"Nested.Timeout": "1m30s",
+		"Nested.Names":   "a, b",
+		"Nested.Levels":  "x=1,y=2",
+	}
+	if len(fields) != len(values) {
+		t.Fatalf("got %d fields; want %d", len(fields), len(values))
+	}
+	for _, f := range fields {
+		if err := f.Set(values[f.Path]); err != nil {
+			t.Fatal(err)
+		}
+		if f.Path == "Server" && f.Env != "TEST_SERVER" {
+			t.Errorf("got env %q; want TEST_SERVER", f.Env)
+		}
+	}
+	if c.Retries != 3 || !c.Nested.Enabled || c.Nested.Timeout != 90*time.Second ||
+		len(c.Nested.Names) != 2 || c.Nested.Levels["y"] != "2" {
+		t.Errorf("fields not set correctly: %+v", c)
+	}
+	for _, f := range fields {
+		if f.Path == "Nested.Levels" && f.String() != "x=1,y=2" {
+			t.Errorf("got %q; want x=1,y=2", f)
+		}
+		if f.Path == "Retries" {
+			if err := f.Set("three"); err == nil {
+				t.Errorf("setting Retries to three succeeded; want an error")
+			}
+		}
+	}
+}
+
+func TestSetFileField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "config.json")
+	if err := SetFileField(&testConfig{}, path, "Server", "http://a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetFileField(&testConfig{}, path, "Nested.Names", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	for field, expected := range map[string]bool{
+		"Server": true, "nested.names": true, "Nested.Enabled": false, "Retries": false,
+	} {
+		if ok, err := FileHasField(path, field); err != nil || ok != expected {
+			t.Errorf("FileHasField(%q) returned %t, %v; want %t", field, ok, err, expected)
+		}
+	}
+	c := testConfig{}
+	if err := New().Load(&c, path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "http://a" || len(c.Nested.Names) != 1 {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestFields_Secret(t *testing.T) {
+	c := struct {
+		Name     string
+		Password string `secret:"true"`
+	}{"a", "hunter2"}
+	fields, err := Fields(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fields[0].Redacted(); s != "a" {
+		t.Errorf("got %q for Name; want %q", s, "a")
+	}
+	if s := fields[1].Redacted(); s != "(secret)" {
+		t.Errorf("got %q for Password; want it redacted", s)
+	}
+	b, err := Dump(&c, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "hunter2") || strings.Contains(string(b), "Password") {
+		t.Errorf("dump contains the secret field:\n%s", b)
+	}
+}
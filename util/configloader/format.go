@@ -0,0 +1,430 @@
+package configloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opentable/sous/util/yaml"
+)
+
+type (
+	// Format is a config file format.
+	Format string
+	// FileError is an error in a config file.
+	FileError struct {
+		// File is the path of the file.
+		File string
+		// Line is the line the error occurred on, starting at 1. It is 0 if
+		// the line is not known.
+		Line int
+		// Err is the underlying error.
+		Err error
+	}
+	// document is the parsed contents of a config file.
+	document struct {
+		path   string
+		format Format
+		// values are the contents of the file, with nested objects as
+		// map[string]interface{}.
+		values map[string]interface{}
+		// lines maps the lower case path of each key in values to the line
+		// it was defined on, where known.
+		lines map[string]int
+	}
+)
+
+const (
+	// JSON is the format of .json files.
+	JSON Format = "json"
+	// YAML is the format of .yaml and .yml files.
+	YAML Format = "yaml"
+	// TOML is the format of .toml files.
+	TOML Format = "toml"
+)
+
+// Formats are all the supported formats, in the order FindFile prefers them.
+var Formats = []Format{JSON, YAML, TOML}
+
+// FormatOf returns the format of the file at path, according to its extension.
+func FormatOf(path string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	f, err := ParseFormat(strings.TrimPrefix(ext, "."))
+	if err != nil {
+		return "", fmt.Errorf("%s: unsupported config file extension %q, use .json, .yaml, .yml or .toml", path, ext)
+	}
+	return f, nil
+}
+
+// ParseFormat returns the format named by s, which is one of json, yaml, yml or
+// toml.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	case "toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use json, yaml or toml", s)
+}
+
+// FindFile returns the first of base.json, base.yaml, base.yml and base.toml
+// which exists. If none of them exist, it returns base.json.
+func FindFile(base string) string {
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + ".json"
+}
+
+func (e *FileError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+// Dump serialises target, a pointer to a struct, in format f, such that it can
+// be loaded again by File. Durations are written as strings, e.g. "1m30s".
+// Secret fields are left out.
+func Dump(target interface{}, f Format) ([]byte, error) {
+	fields, err := Fields(target)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	for _, field := range fields {
+		if field.Key == "" || field.Secret {
+			continue
+		}
+		names := strings.Split(field.Key, ".")
+		last := len(names) - 1
+		parent := m
+		for _, name := range names[:last] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[name] = child
+			}
+			parent = child
+		}
+		if field.Value.Type() == durationType {
+			parent[names[last]] = field.String()
+		} else {
+			parent[names[last]] = field.Value.Interface()
+		}
+	}
+	return marshal(f, m)
+}
+
+func marshal(f Format, m map[string]interface{}) ([]byte, error) {
+	switch f {
+	case JSON:
+		b, err := json.MarshalIndent(m, "", "  ")
+		return append(b, '\n'), err
+	case YAML:
+		return yaml.Marshal(m)
+	case TOML:
+		return marshalTOML(m)
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// readDocument reads the config file at path, in the format given by its
+// extension. If the file does not exist, it returns an empty document and
+// false.
+func readDocument(path string) (*document, bool, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, false, err
+	}
+	d := &document{path: path, format: format, values: map[string]interface{}{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	switch format {
+	case JSON:
+		err = d.parseJSON(b)
+	case YAML:
+		err = d.parseYAML(b)
+	case TOML:
+		d.values, d.lines, err = parseTOML(b)
+	}
+	if fe, ok := err.(*FileError); ok {
+		fe.File = path
+	}
+	return d, true, err
+}
+
+// write writes this document to its path. The file and its directory are
+// created if necessary, and the file is replaced atomically.
+func (d *document) write() error {
+	b, err := marshal(d.format, d.values)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// apply validates this document against the Schema of target, and sets each
+// field of target which it has a value for, returning their paths.
+func (d *document) apply(target interface{}) ([]string, error) {
+	schema, err := NewSchema(target)
+	if err != nil {
+		return nil, err
+	}
+	if errs := schema.Validate(d.values); len(errs) != 0 {
+		for i := range errs {
+			errs[i].File, errs[i].Line = d.path, d.line(errs[i].Key)
+		}
+		return nil, errs
+	}
+	fields, err := Fields(target)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, field := range fields {
+		if field.Key == "" {
+			continue
+		}
+		v, ok := lookupPath(d.values, strings.Split(field.Key, "."))
+		if !ok {
+			continue
+		}
+		if err := setFromFile(field, v); err != nil {
+			return nil, &FileError{File: d.path, Line: d.line(field.Key), Err: err}
+		}
+		paths = append(paths, field.Path)
+	}
+	return paths, nil
+}
+
+// line returns the line of key in this document, or of the closest containing
+// key whose line is known. Keys may contain indices, e.g. "Names[1]".
+func (d *document) line(key string) int {
+	key = strings.ToLower(key)
+	for key != "" {
+		if i := strings.Index(key, "["); i != -1 {
+			key = key[:i]
+		}
+		if line, ok := d.lines[key]; ok {
+			return line
+		}
+		i := strings.LastIndex(key, ".")
+		if i == -1 {
+			break
+		}
+		key = key[:i]
+	}
+	return 0
+}
+
+func (d *document) parseJSON(b []byte) error {
+	if err := json.Unmarshal(b, &d.values); err != nil {
+		line := 0
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			line = lineAt(b, int(e.Offset))
+		case *json.UnmarshalTypeError:
+			line = lineAt(b, int(e.Offset))
+			err = fmt.Errorf("the file must contain an object, not %s", e.Value)
+		}
+		return &FileError{Line: line, Err: err}
+	}
+	d.lines = jsonLines(b)
+	return nil
+}
+
+// jsonLines returns the line of each object key in b, which must be valid JSON,
+// keyed by its lower case path. Keys within arrays are not recorded.
+func jsonLines(b []byte) map[string]int {
+	type container struct {
+		array bool
+		path  string
+	}
+	var stack []container
+	lines := map[string]int{}
+	key, line := "", 1
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\n':
+			line++
+		case '{', '[':
+			path := ""
+			if n := len(stack); n != 0 && !stack[n-1].array && stack[n-1].path != "-" {
+				path = key
+			} else if n != 0 {
+				path = "-"
+			}
+			stack = append(stack, container{array: b[i] == '[', path: path})
+		case '}', ']':
+			stack = stack[:len(stack)-1]
+		case '"':
+			start, startLine := i, line
+			for i++; i < len(b) && b[i] != '"'; i++ {
+				if b[i] == '\\' {
+					i++
+				}
+			}
+			n := len(stack)
+			if n == 0 || stack[n-1].array || !isJSONKey(b[i+1:]) {
+				continue
+			}
+			var name string
+			if err := json.Unmarshal(b[start:i+1], &name); err != nil {
+				continue
+			}
+			key = strings.ToLower(name)
+			if p := stack[n-1].path; p != "" {
+				key = p + "." + key
+			}
+			if stack[n-1].path != "-" {
+				lines[key] = startLine
+			}
+		}
+	}
+	return lines
+}
+
+// isJSONKey reports whether b, which follows a string, starts with a colon,
+// ignoring whitespace.
+func isJSONKey(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) != 0 && b[0] == ':'
+}
+
+var (
+	yamlError = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+	yamlKey   = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s:#"'-][^:#]*?)\s*:(\s|$)`)
+)
+
+func (d *document) parseYAML(b []byte) error {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		if m := yamlError.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return &FileError{Line: line, Err: fmt.Errorf("%s", m[2])}
+		}
+		return &FileError{Err: err}
+	}
+	if v == nil {
+		d.lines = map[string]int{}
+		return nil
+	}
+	values, ok := normaliseYAML(v).(map[string]interface{})
+	if !ok {
+		return &FileError{Line: 1, Err: fmt.Errorf("the file must contain a mapping")}
+	}
+	d.values, d.lines = values, yamlLines(b)
+	return nil
+}
+
+// normaliseYAML converts the map[interface{}]interface{} values produced by
+// the YAML decoder to map[string]interface{}, and integers to int64, like the
+// values produced by the other decoders.
+func normaliseYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normaliseYAML(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normaliseYAML(e)
+		}
+	case int:
+		return int64(v)
+	case uint64:
+		return float64(v)
+	}
+	return v
+}
+
+// yamlLines returns the line of each block style mapping key in b, keyed by its
+// lower case path. Keys in flow style mappings, and within sequences, are not
+// recorded.
+func yamlLines(b []byte) map[string]int {
+	type key struct {
+		indent int
+		name   string
+	}
+	var stack []key
+	lines := map[string]int{}
+	for i, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		for len(stack) != 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		m := yamlKey.FindStringSubmatch(trimmed)
+		if m == nil {
+			// Ignore everything nested within sequence items.
+			stack = append(stack, key{indent, ""})
+			continue
+		}
+		stack = append(stack, key{indent, strings.ToLower(strings.Trim(m[1], `"'`))})
+		names := make([]string, len(stack))
+		for n, k := range stack {
+			if k.name == "" {
+				names = nil
+				break
+			}
+			names[n] = k.name
+		}
+		if names != nil {
+			lines[strings.Join(names, ".")] = i + 1
+		}
+	}
+	return lines
+}
+
+// lineAt returns the line number of offset in b, starting at 1.
+func lineAt(b []byte, offset int) int {
+	if offset > len(b) {
+		offset = len(b)
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
+
+// setFromFile sets f to v, a value decoded from a config file. Durations may be
+// given as strings, e.g. "1m30s", or as a number of nanoseconds.
+func setFromFile(f Field, v interface{}) error {
+	if s, ok := v.(string); ok && f.Value.Type() == durationType {
+		return f.Set(s)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%s: %s", f.Key, err)
+	}
+	if err := json.Unmarshal(b, f.Value.Addr().Interface()); err != nil {
+		return fmt.Errorf("%s: cannot use %s as %s", f.Key, b, f.Value.Type())
+	}
+	return nil
+}
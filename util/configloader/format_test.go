@@ -0,0 +1,185 @@
+package configloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formatFiles = map[string]string{
+	"config.json": `{
+  "Server": "http://sous",
+  "Retries": 3,
+  "Nested": {
+    "Enabled": true,
+    "Timeout": "1m30s",
+    "Names": ["a", "b"],
+    "Levels": {"x": "1"}
+  }
+}`,
+	"config.yaml": `
+Server: http://sous
+retries: 3
+Nested:
+  Enabled: true
+  Timeout: 1m30s
+  Names:
+  - a
+  - b
+  Levels:
+    x: "1"
+`,
+	"config.toml": `
+# A comment.
+Server = "http://sous"
+retries = 3 # Another comment.
+
+[Nested]
+Enabled = true
+Timeout = '1m30s'
+Names = [
+  "a",
+  "b",
+]
+Levels = { x = "1" }
+`,
+}
+
+func TestFile_Formats(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	expected := testConfig{Server: "http://sous", Retries: 3}
+	expected.Nested.Enabled = true
+	expected.Nested.Timeout = 90 * time.Second
+	expected.Nested.Names = []string{"a", "b"}
+	expected.Nested.Levels = map[string]string{"x": "1"}
+	for name, contents := range formatFiles {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, contents)
+		c := testConfig{}
+		if err := New().Load(&c, path); err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, expected) {
+			t.Errorf("%s: got %+v; want %+v", name, c, expected)
+		}
+	}
+}
+
+func TestFile_Errors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"syntax.json": "{\n  \"Server\": \"a\",\n  oops\n}",
+		"type.json":   "{\n  \"Server\": \"a\",\n  \"Nested\": {\n    \"Enabled\": \"yes\"\n  }\n}",
+		"syntax.yaml": "Server: a\nNested:\n  Enabled: [\n",
+		"type.yaml":   "Server: a\nNested:\n  Names:\n  - a\n  Enabled: maybe\n",
+		"syntax.toml": "Server = \"a\"\n\n[Nested]\nEnabled = \n",
+		"type.toml":   "Server = \"a\"\nRetries = \"three\"\n",
+		"date.toml":   "Server = 2017-01-01\n",
+	}
+	lines := map[string]string{
+		"syntax.json": ":3:",
+		"type.json":   ":4: Nested.Enabled",
+		"syntax.yaml": ":3:",
+		"type.yaml":   ":5: Nested.Enabled",
+		"syntax.toml": ":4: expected value",
+		"type.toml":   ":2: Retries",
+		"date.toml":   ":1: Server: dates and times are not supported",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, contents)
+		err := New().Load(&testConfig{}, path)
+		if err == nil {
+			t.Errorf("%s: got nil error", name)
+			continue
+		}
+		_, isFileErr := err.(*FileError)
+		_, isValidationErr := err.(ValidationErrors)
+		if !isFileErr && !isValidationErr {
+			t.Errorf("%s: got %T; want *FileError or ValidationErrors", name, err)
+		}
+		if want := path + lines[name]; !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: got error %q; want prefix %q", name, err, want)
+		}
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	b := []byte("{\n  \"A\": \"x\\\": {\",\n  \"B\": [{\"C\": 1}],\n  \"D\": {\n    \"E\": true\n  }\n}")
+	expected := map[string]int{"a": 2, "b": 3, "d": 4, "d.e": 5}
+	if lines := jsonLines(b); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %v; want %v", lines, expected)
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := testConfig{Server: "http://\"sous\"", Retries: 3}
+	c.Nested.Timeout = time.Minute
+	c.Nested.Names = []string{"a"}
+	c.Nested.Levels = map[string]string{"x y": "1"}
+	for _, f := range Formats {
+		b, err := Dump(&c, f)
+		if err != nil {
+			t.Errorf("%s: %s", f, err)
+			continue
+		}
+		path := filepath.Join(dir, "dump."+string(f))
+		writeFile(t, path, string(b))
+		loaded := testConfig{}
+		if err := New().Load(&loaded, path); err != nil {
+			t.Errorf("%s: %s\n%s", f, err, b)
+			continue
+		}
+		if !reflect.DeepEqual(loaded, c) {
+			t.Errorf("%s: got %+v; want %+v\n%s", f, loaded, c, b)
+		}
+	}
+}
+
+func TestSetFileField_Formats(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, ext := range []string{"yaml", "toml"} {
+		path := filepath.Join(dir, "config."+ext)
+		if err := SetFileField(&testConfig{}, path, "Nested.Levels", map[string]string{"a": "b"}); err != nil {
+			t.Fatal(err)
+		}
+		c := testConfig{}
+		if err := New().Load(&c, path); err != nil {
+			t.Fatal(err)
+		}
+		if c.Nested.Levels["a"] != "b" {
+			t.Errorf("%s: got %+v", ext, c)
+		}
+	}
+}
+
+func TestFindFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "config")
+	if f := FindFile(base); f != base+".json" {
+		t.Errorf("got %q; want %q", f, base+".json")
+	}
+	writeFile(t, base+".toml", "")
+	if f := FindFile(base); f != base+".toml" {
+		t.Errorf("got %q; want %q", f, base+".toml")
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "configloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
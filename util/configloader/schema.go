@@ -0,0 +1,379 @@
+package configloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xrash/smetrics"
+)
+
+type (
+	// Schema is a JSON Schema describing a config struct, or one of its
+	// fields. Only the parts of JSON Schema needed to describe config structs
+	// are supported.
+	Schema struct {
+		SchemaURI   string             `json:"$schema,omitempty"`
+		Title       string             `json:"title,omitempty"`
+		Description string             `json:"description,omitempty"`
+		Type        []string           `json:"type,omitempty"`
+		Format      string             `json:"format,omitempty"`
+		Pattern     string             `json:"pattern,omitempty"`
+		Minimum     *int               `json:"minimum,omitempty"`
+		Default     interface{}        `json:"default,omitempty"`
+		Items       *Schema            `json:"items,omitempty"`
+		Properties  map[string]*Schema `json:"properties,omitempty"`
+		// AdditionalProperties is the schema of object properties not
+		// listed in Properties. If it is nil, no other properties are
+		// allowed.
+		AdditionalProperties *Schema `json:"-"`
+	}
+	// ValidationError is a single problem with a config value.
+	ValidationError struct {
+		// File is the config file containing the value, if it came from a
+		// file.
+		File string
+		// Line is the line of the value in File, or 0 if it is not known.
+		Line int
+		// Source names the layer which supplied the value, if it did not
+		// come from a file.
+		Source string
+		// Key is the path of the value, e.g. "Policy.Dockerfile".
+		Key string
+		// Message describes the problem.
+		Message string
+	}
+	// ValidationErrors are all the problems found while loading config.
+	ValidationErrors []ValidationError
+)
+
+// SchemaURI identifies the version of JSON Schema generated by NewSchema.
+const SchemaURI = "http://json-schema.org/draft-07/schema#"
+
+// durationPattern matches durations as parsed by time.ParseDuration.
+const durationPattern = `^[-+]?(0|([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// NewSchema returns a JSON Schema for target, a pointer to a struct, which all
+// config files loaded into target must satisfy. Properties are named by their
+// json tags, or their field names, and fields with an env tag say so in their
+// description. Fields may have a format tag; the only format supported is
+// "uri", which requires an absolute URL, or an empty string.
+func NewSchema(target interface{}) (*Schema, error) {
+	if _, err := Fields(target); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(target).Elem()
+	s, err := typeSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	s.SchemaURI, s.Title = SchemaURI, t.Name()
+	return s, nil
+}
+
+func typeSchema(t reflect.Type) (*Schema, error) {
+	if t == durationType {
+		return &Schema{
+			Type:        []string{"string", "integer"},
+			Pattern:     durationPattern,
+			Description: `A duration, e.g. "1m30s", or a number of nanoseconds.`,
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: []string{"string"}}, nil
+	case reflect.Bool:
+		return &Schema{Type: []string{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: []string{"integer"}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0
+		return &Schema{Type: []string{"integer"}, Minimum: &zero}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: []string{"number"}}, nil
+	case reflect.Slice:
+		items, err := typeSchema(t.Elem())
+		return &Schema{Type: []string{"array", "null"}, Items: items}, err
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unable to describe maps with %s keys", t.Key())
+		}
+		values, err := typeSchema(t.Elem())
+		return &Schema{Type: []string{"object", "null"}, AdditionalProperties: values}, err
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return nil, fmt.Errorf("unable to describe fields of type %s", t)
+}
+
+func structSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: []string{"object"}, Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := jsonName(sf)
+		if sf.PkgPath != "" || name == "" {
+			continue
+		}
+		p, err := typeSchema(sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sf.Name, err)
+		}
+		p.Format = sf.Tag.Get("format")
+		if env := sf.Tag.Get("env"); env != "" {
+			p.Description = strings.TrimSpace(fmt.Sprintf(
+				"%s Overridden by the %s environment variable.", p.Description, env))
+		}
+		if d := sf.Tag.Get("default"); d != "" {
+			v, err := parseValue(sf.Type, d)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid default: %s", sf.Name, err)
+			}
+			p.Default = v.Interface()
+			if sf.Type == durationType {
+				p.Default = d
+			}
+		}
+		s.Properties[name] = p
+	}
+	return s, nil
+}
+
+// MarshalJSON marshals s, adding additionalProperties to object schemas.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	v := struct {
+		*schema
+		AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	}{schema: (*schema)(s)}
+	if s.hasType("object") {
+		v.AdditionalProperties = false
+		if s.AdditionalProperties != nil {
+			v.AdditionalProperties = s.AdditionalProperties
+		}
+	}
+	return json.Marshal(v)
+}
+
+func (s *Schema) hasType(t string) bool {
+	for _, st := range s.Type {
+		if st == t || st == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks v, a value decoded from a config file, against s. Object
+// keys are matched to properties case-insensitively, as they are when config is
+// loaded.
+func (s *Schema) Validate(v interface{}) ValidationErrors {
+	errs := ValidationErrors{}
+	s.validate(v, "", &errs)
+	return errs
+}
+
+func (s *Schema) validate(v interface{}, key string, errs *ValidationErrors) {
+	fail := func(format string, a ...interface{}) {
+		*errs = append(*errs, ValidationError{Key: key, Message: fmt.Sprintf(format, a...)})
+	}
+	if t := jsonType(v); len(s.Type) != 0 && !s.hasType(t) {
+		expected := make([]string, 0, len(s.Type))
+		for _, st := range s.Type {
+			if st != "null" {
+				expected = append(expected, describeType(st))
+			}
+		}
+		fail("expected %s, got %s", strings.Join(expected, " or "), describeValue(v))
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(v) {
+			if s.Pattern == durationPattern {
+				fail("%q is not a valid duration, e.g. \"1m30s\"", v)
+			} else {
+				fail("%q does not match %s", v, s.Pattern)
+			}
+		}
+		if msg := checkFormat(s.Format, v); msg != "" {
+			fail("%s", msg)
+		}
+	case float64:
+		if s.Minimum != nil && v < float64(*s.Minimum) {
+			fail("must be at least %d", *s.Minimum)
+		}
+	case int64:
+		if s.Minimum != nil && v < int64(*s.Minimum) {
+			fail("must be at least %d", *s.Minimum)
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range v {
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", key, i), errs)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := strings.TrimPrefix(key+"."+k, ".")
+			if p := s.property(k); p != nil {
+				p.validate(v[k], child, errs)
+				continue
+			}
+			if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(v[k], child, errs)
+				continue
+			}
+			*errs = append(*errs, ValidationError{Key: child, Message: s.unknownKey(k)})
+		}
+	}
+}
+
+// property returns the schema of the property named name, ignoring case.
+func (s *Schema) property(name string) *Schema {
+	for n, p := range s.Properties {
+		if strings.EqualFold(n, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// unknownKey describes an unknown key, suggesting the most similar property.
+func (s *Schema) unknownKey(name string) string {
+	best, score := "", 0.8
+	for n := range s.Properties {
+		if sc := smetrics.JaroWinkler(strings.ToLower(n), strings.ToLower(name), 0.7, 4); sc > score {
+			best, score = n, sc
+		}
+	}
+	if best == "" {
+		return "unknown key"
+	}
+	return fmt.Sprintf("unknown key, did you mean %s?", best)
+}
+
+// checkFormat returns a message describing why s does not have format, or the
+// empty string if it does.
+func checkFormat(format, s string) string {
+	switch format {
+	case "uri":
+		if s == "" {
+			return ""
+		}
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Sprintf("%q is not a valid URL, e.g. \"http://sous.example.com\"", s)
+		}
+	}
+	return ""
+}
+
+// checkFields checks the format of each field of target which was set by a
+// layer other than a file, since files are validated as they are loaded.
+func checkFields(target interface{}, sources Sources, files map[string]bool) ValidationErrors {
+	errs := ValidationErrors{}
+	fields, err := Fields(target)
+	if err != nil {
+		return errs
+	}
+	for _, f := range fields {
+		source, ok := sources[f.Path]
+		if f.Format == "" || files[source] || !ok {
+			continue
+		}
+		if msg := checkFormat(f.Format, f.String()); msg != "" {
+			errs = append(errs, ValidationError{Source: source, Key: f.Path, Message: msg})
+		}
+	}
+	return errs
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func describeType(t string) string {
+	switch t {
+	case "boolean":
+		return "true or false"
+	case "integer":
+		return "a whole number"
+	case "array":
+		return "a list"
+	case "object":
+		return "a mapping"
+	}
+	return "a " + t
+}
+
+func describeValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case bool:
+		return fmt.Sprint(v)
+	case int64, float64:
+		return fmt.Sprintf("the number %v", v)
+	}
+	return describeType(jsonType(v))
+}
+
+func (e ValidationError) Error() string {
+	location := e.Source
+	if e.File != "" {
+		location = e.File
+		if e.Line != 0 {
+			location = fmt.Sprintf("%s:%d", e.File, e.Line)
+		}
+	}
+	msg := e.Message
+	if e.Key != "" {
+		msg = e.Key + ": " + msg
+	}
+	if location == "" {
+		return msg
+	}
+	return location + ": " + msg
+}
+
+func (es ValidationErrors) Error() string {
+	if len(es) == 1 {
+		return es[0].Error()
+	}
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = "  " + e.Error()
+	}
+	return fmt.Sprintf("%d problems with config:\n%s", len(es), strings.Join(lines, "\n"))
+}
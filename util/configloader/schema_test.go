@@ -0,0 +1,143 @@
+package configloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaConfig struct {
+	Server   string `env:"TEST_SCHEMA_SERVER" format:"uri"`
+	Retries  uint   `json:"retries" default:"2"`
+	Timeout  time.Duration
+	Internal string `json:"-"`
+	Nested   struct {
+		Names  []string
+		Levels map[string]int
+	}
+}
+
+func TestNewSchema(t *testing.T) {
+	s, err := NewSchema(&schemaConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["$schema"] != SchemaURI || m["title"] != "schemaConfig" || m["additionalProperties"] != false {
+		t.Errorf("unexpected top level schema: %s", b)
+	}
+	props := m["properties"].(map[string]interface{})
+	if _, ok := props["Internal"]; ok {
+		t.Errorf("fields tagged json:\"-\" should not be in the schema: %s", b)
+	}
+	server := props["Server"].(map[string]interface{})
+	if server["format"] != "uri" || !strings.Contains(server["description"].(string), "TEST_SCHEMA_SERVER") {
+		t.Errorf("unexpected Server schema: %v", server)
+	}
+	retries := props["retries"].(map[string]interface{})
+	if retries["default"] != 2.0 || retries["minimum"] != 0.0 {
+		t.Errorf("unexpected retries schema: %v", retries)
+	}
+	levels := props["Nested"].(map[string]interface{})["properties"].(map[string]interface{})["Levels"].(map[string]interface{})
+	if levels["additionalProperties"].(map[string]interface{})["type"].([]interface{})[0] != "integer" {
+		t.Errorf("unexpected Levels schema: %v", levels)
+	}
+}
+
+func TestLoadLayers_ValidationErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.json")
+	writeFile(t, a, "Server: nope\nRetry: 3\nNested:\n  Names: [1, x]\n")
+	writeFile(t, b, "{\n  \"Timeout\": \"soon\",\n  \"retries\": -1\n}\n")
+	os.Setenv("TEST_SCHEMA_SERVER", "not a url")
+	defer os.Unsetenv("TEST_SCHEMA_SERVER")
+
+	c := schemaConfig{}
+	_, err := New().LoadLayers(&c, Defaults(), File("a", a), File("b", b), Env())
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("got %T %v; want ValidationErrors", err, err)
+	}
+	expected := []string{
+		a + `:4: Nested.Names[0]: expected a string, got the number 1`,
+		a + `:2: Retry: unknown key, did you mean retries?`,
+		a + `:1: Server: "nope" is not a valid URL, e.g. "http://sous.example.com"`,
+		b + `:2: Timeout: "soon" is not a valid duration, e.g. "1m30s"`,
+		b + `:3: retries: must be at least 0`,
+		`env: Server: "not a url" is not a valid URL, e.g. "http://sous.example.com"`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("got %d errors; want %d:\n%s", len(errs), len(expected), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("got error %q; want %q", e, expected[i])
+		}
+	}
+	if !strings.HasPrefix(errs.Error(), "6 problems with config:\n") {
+		t.Errorf("unexpected summary: %s", errs)
+	}
+	if c.Retries != 2 {
+		t.Errorf("invalid files should not be applied, got Retries %d", c.Retries)
+	}
+}
+
+type limitedConfig struct {
+	Retries uint
+}
+
+func (c *limitedConfig) Validate() error {
+	if c.Retries > 5 {
+		return fmt.Errorf("Retries: must be at most 5")
+	}
+	return nil
+}
+
+func TestSetFileField_Invalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := SetFileField(&schemaConfig{}, path, "Server", "http://a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetFileField(&schemaConfig{}, path, "Nested.Levels", map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	err := SetFileField(&schemaConfig{}, path, "Server", "not a url")
+	if _, ok := err.(ValidationErrors); !ok {
+		t.Errorf("got error %v; want ValidationErrors", err)
+	}
+	c := schemaConfig{}
+	if err := New().Load(&c, path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "http://a" {
+		t.Errorf("invalid value was written, got Server %q", c.Server)
+	}
+
+	limited := filepath.Join(dir, "limited.json")
+	err = SetFileField(&limitedConfig{}, limited, "Retries", uint(6))
+	if _, ok := err.(ValidationErrors); !ok {
+		t.Errorf("got error %v setting Retries to 6; want ValidationErrors", err)
+	}
+	if _, err := os.Stat(limited); !os.IsNotExist(err) {
+		t.Errorf("file was written despite failing validation")
+	}
+	_, err = New().LoadLayers(&limitedConfig{}, Values("flags", map[string]string{"Retries": "6"}))
+	if err == nil || err.Error() != "Retries: must be at most 5" {
+		t.Errorf("got error %v from LoadLayers; want Validate error", err)
+	}
+}
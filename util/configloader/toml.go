@@ -0,0 +1,97 @@
+package configloader
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	tomlError = regexp.MustCompile(`^Near line (\d+) \(last key parsed '[^']*'\): (.*)$`)
+	tomlTable = regexp.MustCompile(`^\[\s*([^\[\]]+?)\s*\]`)
+	tomlKey   = regexp.MustCompile(`^("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)\s*=`)
+)
+
+// parseTOML parses b, returning the values it defines and the line of each key.
+// Errors are *FileError with the File field empty.
+func parseTOML(b []byte) (map[string]interface{}, map[string]int, error) {
+	values := map[string]interface{}{}
+	if _, err := toml.Decode(string(b), &values); err != nil {
+		if m := tomlError.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, nil, &FileError{Line: line, Err: fmt.Errorf("%s", m[2])}
+		}
+		return nil, nil, &FileError{Err: err}
+	}
+	lines := tomlLines(b)
+	if key, ok := findTOMLDate(values, ""); ok {
+		d := &document{lines: lines}
+		return nil, nil, &FileError{Line: d.line(key),
+			Err: fmt.Errorf("%s: dates and times are not supported", key)}
+	}
+	return values, lines, nil
+}
+
+// findTOMLDate returns the path of the first date or time in v, if any. Config
+// values are never dates, and letting them through would silently turn them
+// into strings.
+func findTOMLDate(v interface{}, path string) (string, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return path, true
+	case map[string]interface{}:
+		for k, e := range v {
+			if p, ok := findTOMLDate(e, strings.TrimPrefix(path+"."+k, ".")); ok {
+				return p, true
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if p, ok := findTOMLDate(e, fmt.Sprintf("%s[%d]", path, i)); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// tomlLines returns the line of each table header and key in b, keyed by its
+// lower case path. Keys in inline tables, and within arrays of tables, are not
+// recorded.
+func tomlLines(b []byte) map[string]int {
+	lines := map[string]int{}
+	prefix := ""
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "[["):
+			prefix = "-"
+		case tomlTable.MatchString(line):
+			names := strings.Split(tomlTable.FindStringSubmatch(line)[1], ".")
+			for n, name := range names {
+				names[n] = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"'`))
+			}
+			prefix = strings.Join(names, ".")
+			lines[prefix] = i + 1
+			prefix += "."
+		case prefix != "-" && tomlKey.MatchString(line):
+			name := strings.Trim(tomlKey.FindStringSubmatch(line)[1], `"'`)
+			lines[prefix+strings.ToLower(name)] = i + 1
+		}
+	}
+	return lines
+}
+
+// marshalTOML encodes m as TOML. Nested maps are written as tables.
+func marshalTOML(m map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
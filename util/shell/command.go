@@ -121,7 +121,18 @@ func (c *Command) ExitCode() (int, error) {
 // itself exits with an error code. If you need an error to be returned on
 // non-zero exit codes, use SucceedResult instead.
 func (s *Command) Result() (*Result, error) {
+	for _, f := range s.MonitorFuncs {
+		f(s.Name, s.Args)
+	}
+	for _, f := range s.CommandFuncs {
+		f(s)
+	}
 	c := exec.Command(s.Name, s.Args...)
+	c.Dir = s.Dir
+	// A nil Env means the command inherits this process's environment.
+	if len(s.Env) != 0 {
+		c.Env = s.Env
+	}
 	outbuf := &bytes.Buffer{}
 	errbuf := &bytes.Buffer{}
 	combinedbuf := &bytes.Buffer{}
@@ -199,12 +210,37 @@ func (c *Command) FailResult() (*Result, error) {
 		return r, err
 	}
 	if r.Err == nil {
-		return r, fmt.Errorf("command %s succeeded, expected failure")
+		return r, fmt.Errorf("command %s succeeded, expected failure", c)
 	}
 	return r, nil
 }
 
+// String returns the command line, with secrets removed, see RedactArgs.
 func (c *Command) String() string {
-	args := strings.Join(c.Args, " ")
+	args := strings.Join(RedactArgs(c.Args), " ")
 	return fmt.Sprintf("%s %s", c.Name, args)
 }
+
+// redactedFlags are the docker flags whose KEY=value arguments may contain
+// secrets.
+var redactedFlags = map[string]bool{"-e": true, "--env": true, "--build-arg": true}
+
+// RedactArgs returns a copy of args with the value of each KEY=value argument
+// to one of the docker flags -e, --env or --build-arg replaced, e.g. "-e",
+// "TOKEN=abc" becomes "-e", "TOKEN=(redacted)", so that they can be shown.
+func RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, a := range args {
+		redacted[i] = a
+		flag, kv := "", ""
+		if i > 0 && redactedFlags[args[i-1]] {
+			kv = a
+		} else if parts := strings.SplitN(a, "=", 2); len(parts) == 2 && redactedFlags[parts[0]] {
+			flag, kv = parts[0]+"=", parts[1]
+		}
+		if j := strings.Index(kv, "="); j != -1 {
+			redacted[i] = flag + kv[:j] + "=(redacted)"
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommand_Result(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sous-shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The temp dir may be reached through a symlink, which pwd resolves.
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := DefaultInDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.Env = append(sh.Env, "SOUS_SHELL_TEST=value")
+	monitored := []string{}
+	sh.MonitorFuncs = append(sh.MonitorFuncs, func(name string, args []string) {
+		monitored = append(monitored, name+" "+strings.Join(args, " "))
+	})
+
+	lines, err := sh.Lines("sh", "-c", "pwd; echo $SOUS_SHELL_TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{dir, "value"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %q; want %q", lines, expected)
+	}
+	if expected := []string{"sh -c pwd; echo $SOUS_SHELL_TEST"}; !reflect.DeepEqual(monitored, expected) {
+		t.Errorf("monitored %q; want %q", monitored, expected)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"run", "-e", "TOKEN=abc", "--env=KEY=x=y", "-e", "HOME", "--build-arg", "A=1", "app=1"}
+	expected := []string{"run", "-e", "TOKEN=(redacted)", "--env=KEY=(redacted)", "-e", "HOME",
+		"--build-arg", "A=(redacted)", "app=1"}
+	if redacted := RedactArgs(args); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("got %q; want %q", redacted, expected)
+	}
+	if args[2] != "TOKEN=abc" {
+		t.Errorf("RedactArgs changed its argument")
+	}
+}
+
+func TestError_Redacted(t *testing.T) {
+	sh, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := sh.Cmd("false", "--build-arg", "TOKEN=secret")
+	if s := c.String(); strings.Contains(s, "secret") {
+		t.Errorf("String() shows the secret: %q", s)
+	}
+	err = c.Succeed()
+	if err == nil {
+		t.Fatal("false succeeded")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error shows the secret: %q", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type (
@@ -24,6 +25,9 @@ type (
 		// MonitorFuncs is a slice of funcs that are called for each command,
 		// they are passed the command name, and a slice of args.
 		MonitorFuncs []func(string, []string)
+		// CommandFuncs are called with each command just before it runs,
+		// after MonitorFuncs. They may change the command, e.g. its Env.
+		CommandFuncs []func(*Command)
 	}
 )
 
@@ -57,6 +61,8 @@ func (s *Sh) Clone() *Sh {
 	copy(cp.Env, s.Env)
 	cp.MonitorFuncs = make([]func(string, []string), len(s.MonitorFuncs))
 	copy(cp.MonitorFuncs, s.MonitorFuncs)
+	cp.CommandFuncs = make([]func(*Command), len(s.CommandFuncs))
+	copy(cp.CommandFuncs, s.CommandFuncs)
 	return &cp
 }
 
@@ -78,6 +84,22 @@ func (s *Sh) CD(dir string) error {
 	return nil
 }
 
+// SetEnv sets the environment variable key to value. If Env is empty, it is
+// first set to the current process's environment, which commands would
+// otherwise inherit.
+func (s *Sh) SetEnv(key, value string) {
+	if len(s.Env) == 0 {
+		s.Env = os.Environ()
+	}
+	for i, kv := range s.Env {
+		if strings.HasPrefix(kv, key+"=") {
+			s.Env[i] = key + "=" + value
+			return
+		}
+	}
+	s.Env = append(s.Env, key+"="+value)
+}
+
 // Cmd creates a new Command based on this shell.
 func (s *Sh) Cmd(name string, args ...interface{}) *Command {
 	sargs := make([]string, len(args))